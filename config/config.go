@@ -5,26 +5,42 @@ import (
 )
 
 type TLSServerConfig struct {
-	Enable      bool           `help:"Enable server-side TLS."`
-	Refresh     time.Duration  `default:"0s" help:"Interval for refreshing server TLS certificates."`
-	File        TLSServerFiles `embed:"" prefix:"file."`
-	KeyPassword string         `help:"Optional password to decrypt RSA private key."`
+	Enable                bool                `help:"Enable server-side TLS."`
+	Refresh               time.Duration       `default:"0s" help:"Interval for refreshing server TLS certificates."`
+	FileWatch             bool                `help:"Reload server TLS certificates on file system events. Refresh interval is used as a fallback."`
+	File                  TLSServerFiles      `embed:"" prefix:"file."`
+	KeyPassword           string              `help:"Optional password to decrypt RSA private key or the PKCS#12 keystore."`
+	ClientAuth            string              `default:"auto" enum:"auto,none,request,require-any,verify-if-given,require-and-verify" help:"Client authentication mode. With auto, client certificates are required and verified when client CAs are configured. One of: [auto, none, request, require-any, verify-if-given, require-and-verify]"`
+	ClientCRLExpiryPolicy string              `default:"ignore" enum:"ignore,warn,reject" help:"Handling of client certificates when a client CRL is expired or not yet valid. One of: [ignore, warn, reject]"`
+	Validate              TLSServerValidation `embed:"" prefix:"validate."`
+}
+
+type TLSServerValidation struct {
+	MinValidity  time.Duration `placeholder:"DURATION" name:"min-validity" help:"Optional minimum remaining validity of new server certificates. Certificates which are not yet valid are rejected as well."`
+	SANs         []string      `placeholder:"SAN" name:"san" help:"Optional list of DNS names or IP addresses new server certificates must be valid for."`
+	MinRSABits   int           `name:"min-rsa-bits" help:"Optional minimum RSA key size of new server certificates."`
+	MinECDSABits int           `name:"min-ecdsa-bits" help:"Optional minimum ECDSA key size of new server certificates."`
 }
 
 type TLSServerFiles struct {
-	Key       string `placeholder:"FILE" help:"Path to the server TLS key file."`
-	Cert      string `placeholder:"FILE" help:"Path to the server TLS certificate file."`
-	ClientCAs string `placeholder:"FILE" name:"client-ca" help:"Optional path to server client CA file for client verification."`
-	ClientCRL string `placeholder:"FILE" name:"client-crl" help:"TLS X509 CRL signed be the client CA. If no revocation list is specified, only client CA is verified."`
+	Key             string `placeholder:"FILE" help:"Path to the server TLS key file."`
+	Cert            string `placeholder:"FILE" help:"Path to the server TLS certificate file."`
+	PKCS12          string `placeholder:"FILE" name:"pkcs12" help:"Optional path to a PKCS#12 keystore with the server certificate, chain and key. Mutually exclusive with the key and certificate files."`
+	PKCS12ClientCAs bool   `name:"pkcs12-client-ca" help:"Use the self-signed CA certificates of the PKCS#12 keystore as client CAs for client verification."`
+	ClientCAs       string `placeholder:"FILE" name:"client-ca" help:"Optional path to server client CA file for client verification."`
+	ClientCRL       string `placeholder:"FILE" name:"client-crl" help:"TLS X509 CRL signed be the client CA. If no revocation list is specified, only client CA is verified."`
+	ClientPolicy    string `placeholder:"FILE" name:"client-policy" help:"Optional path to a JSON file with allow and deny rules authorizing client certificates. It is reloaded like the certificates."`
 }
 
 type TLSClientConfig struct {
-	Enable             bool           `help:"Enable client-side TLS."`
-	Refresh            time.Duration  `default:"0s" help:"Interval for refreshing client TLS certificates."`
-	InsecureSkipVerify bool           `help:"Skip TLS verification on client side."`
-	File               TLSClientFiles `embed:"" prefix:"file."`
-	KeyPassword        string         `help:"Optional password to decrypt RSA private key."`
-	UseSystemPool      bool           `help:"Use system pool for root CAs."`
+	Enable             bool              `help:"Enable client-side TLS."`
+	Refresh            time.Duration     `default:"0s" help:"Interval for refreshing client TLS certificates."`
+	FileWatch          bool              `help:"Reload client TLS certificates on file system events. Refresh interval is used as a fallback."`
+	InsecureSkipVerify bool              `help:"Skip TLS verification on client side."`
+	File               TLSClientFiles    `embed:"" prefix:"file."`
+	KeyPassword        string            `help:"Optional password to decrypt RSA private key."`
+	UseSystemPool      bool              `help:"Use system pool for root CAs."`
+	Server             TLSServerIdentity `embed:"" prefix:"server."`
 }
 
 type TLSClientFiles struct {
@@ -32,3 +48,9 @@ type TLSClientFiles struct {
 	Cert    string `placeholder:"FILE" help:"Optional path to client TLS certificate file."`
 	RootCAs string `placeholder:"FILE" name:"root-ca" help:"Optional path to client root CAs for server verification."`
 }
+
+type TLSServerIdentity struct {
+	SPIFFEIDs  []string `placeholder:"ID" name:"spiffe-id" help:"Optional list of accepted server SPIFFE IDs. Replaces host name verification."`
+	SANs       []string `placeholder:"SAN" name:"san" help:"Optional list of accepted server DNS names, IP addresses, URIs or email addresses. Replaces host name verification."`
+	SPKIHashes []string `placeholder:"HASH" name:"spki-sha256" help:"Optional list of pinned base64 encoded SHA-256 hashes of the server public key. Replaces host name verification."`
+}
@@ -0,0 +1,97 @@
+package conntrack
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+	"weak"
+)
+
+// Conns tracks open connections together with the leaf certificate they were established with.
+type Conns struct {
+	mu    sync.Mutex
+	conns map[any]entry
+}
+
+type entry struct {
+	leaf []byte
+	// conn returns the connection or nil if it was garbage collected
+	conn func() io.Closer
+}
+
+// AddWeak tracks the connection established with the DER encoded leaf certificate. It does not keep the connection reachable.
+// The connection stops being tracked when it is garbage collected, so it does not need to be removed.
+func AddWeak[T any, P interface {
+	*T
+	io.Closer
+}](c *Conns, conn P, leaf []byte) {
+	ptr := weak.Make((*T)(conn))
+	c.add(ptr, entry{leaf: leaf, conn: func() io.Closer {
+		if v := ptr.Value(); v != nil {
+			return P(v)
+		}
+		return nil
+	}})
+	runtime.AddCleanup((*T)(conn), c.Remove, any(ptr))
+}
+
+func (c *Conns) add(key any, e entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conns == nil {
+		c.conns = make(map[any]entry)
+	}
+	c.conns[key] = e
+}
+
+// Remove stops tracking the connection.
+func (c *Conns) Remove(key any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.conns, key)
+}
+
+// Len returns the number of tracked connections.
+func (c *Conns) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.conns)
+}
+
+// CloseRotated closes the connections whose leaf certificate is not one of the current certificates
+// after the grace period and returns the number of affected connections.
+func (c *Conns) CloseRotated(current [][]byte, gracePeriod time.Duration) int {
+	c.mu.Lock()
+	var rotated []io.Closer
+	for key, e := range c.conns {
+		if !contains(current, e.leaf) {
+			if conn := e.conn(); conn != nil {
+				rotated = append(rotated, conn)
+			}
+			delete(c.conns, key)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, conn := range rotated {
+		if gracePeriod <= 0 {
+			_ = conn.Close()
+			continue
+		}
+		time.AfterFunc(gracePeriod, func() {
+			_ = conn.Close()
+		})
+	}
+	return len(rotated)
+}
+
+func contains(certs [][]byte, leaf []byte) bool {
+	for _, cert := range certs {
+		if bytes.Equal(cert, leaf) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package conntrack
+
+import (
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testConn struct {
+	closed atomic.Bool
+	// keeps the connection out of the tiny allocator, whose objects may never be cleaned up
+	_ [64]byte
+}
+
+func (c *testConn) Close() error {
+	c.closed.Store(true)
+	return nil
+}
+
+func TestCloseRotated(t *testing.T) {
+	var conns Conns
+	current, rotated := &testConn{}, &testConn{}
+	AddWeak(&conns, current, []byte("current"))
+	AddWeak(&conns, rotated, []byte("rotated"))
+	require.Equal(t, 2, conns.Len())
+
+	require.Equal(t, 1, conns.CloseRotated([][]byte{[]byte("current")}, 0))
+	require.True(t, rotated.closed.Load())
+	require.False(t, current.closed.Load())
+	require.Equal(t, 1, conns.Len())
+	runtime.KeepAlive(current)
+}
+
+func TestAddWeakUntracksCollectedConns(t *testing.T) {
+	var conns Conns
+	AddWeak(&conns, &testConn{}, []byte("leaf"))
+	require.Equal(t, 1, conns.Len())
+
+	require.Eventually(t, func() bool {
+		runtime.GC()
+		return conns.Len() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,80 @@
+package datadir
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DataLink is the symlink used by Kubernetes atomic writer to point to the current generation of a mounted volume.
+const DataLink = "..data"
+
+const maxReadAttempts = 5
+
+// Resolve returns the directory containing the current generation of files.
+// If dir contains the ..data symlink, the symlink target is returned, otherwise dir itself.
+func Resolve(dir string) (string, error) {
+	link := filepath.Join(dir, DataLink)
+	fi, err := os.Lstat(link)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return dir, nil
+		}
+		return "", err
+	}
+	if fi.Mode()&os.ModeSymlink == 0 {
+		return link, nil
+	}
+	return filepath.EvalSymlinks(link)
+}
+
+// ReadFiles reads the named files from a single generation of dir.
+// Empty names are skipped and yield nil content. If the generation is swapped during reading, the read is retried.
+func ReadFiles(dir string, names ...string) ([][]byte, error) {
+	var lastErr error
+	for range maxReadAttempts {
+		generation, err := Resolve(dir)
+		if err != nil {
+			return nil, err
+		}
+		contents, err := readFiles(generation, names)
+		current, resolveErr := Resolve(dir)
+		if resolveErr != nil {
+			return nil, resolveErr
+		}
+		if current == generation {
+			return contents, err
+		}
+		lastErr = fmt.Errorf("data dir %s: generation changed during read", dir)
+	}
+	return nil, lastErr
+}
+
+func readFiles(dir string, names []string) ([][]byte, error) {
+	contents := make([][]byte, len(names))
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+		// nolint:gosec
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		contents[i] = data
+	}
+	return contents, nil
+}
+
+// Paths returns the paths of the named files in dir. Empty names are skipped.
+func Paths(dir string, names ...string) []string {
+	paths := make([]string, 0, len(names))
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	return paths
+}
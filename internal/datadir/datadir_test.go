@@ -0,0 +1,50 @@
+package datadir
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/grepplabs/cert-source/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadFilesPlainDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tls.crt"), []byte("cert"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tls.key"), []byte("key"), 0o600))
+
+	resolved, err := Resolve(dir)
+	require.NoError(t, err)
+	require.Equal(t, dir, resolved)
+
+	contents, err := ReadFiles(dir, "tls.crt", "tls.key", "")
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("cert"), []byte("key"), nil}, contents)
+
+	_, err = ReadFiles(dir, "ca.crt")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestReadFilesDataLink(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, testutil.WriteDataDir(dir, map[string][]byte{"tls.crt": []byte("cert1"), "tls.key": []byte("key1")}))
+
+	generation1, err := Resolve(dir)
+	require.NoError(t, err)
+	require.NotEqual(t, dir, generation1)
+
+	contents, err := ReadFiles(dir, "tls.crt", "tls.key")
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("cert1"), []byte("key1")}, contents)
+
+	require.NoError(t, testutil.WriteDataDir(dir, map[string][]byte{"tls.crt": []byte("cert2"), "tls.key": []byte("key2")}))
+
+	generation2, err := Resolve(dir)
+	require.NoError(t, err)
+	require.NotEqual(t, generation1, generation2)
+
+	contents, err = ReadFiles(dir, "tls.crt", "tls.key")
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("cert2"), []byte("key2")}, contents)
+}
@@ -0,0 +1,56 @@
+package subscription
+
+import (
+	"context"
+	"sync"
+)
+
+// New returns a channel which receives the published values in order until ctx is done, when it is closed.
+// Publish never blocks, the values are queued until the subscriber receives them.
+func New[T any](ctx context.Context) (<-chan T, func(T)) {
+	out := make(chan T)
+	signal := make(chan struct{}, 1)
+	var (
+		mu      sync.Mutex
+		pending []T
+	)
+	publish := func(v T) {
+		if ctx.Err() != nil {
+			return
+		}
+		mu.Lock()
+		pending = append(pending, v)
+		mu.Unlock()
+		select {
+		case signal <- struct{}{}:
+		default:
+		}
+	}
+	go func() {
+		defer close(out)
+		for {
+			mu.Lock()
+			if len(pending) == 0 {
+				mu.Unlock()
+				select {
+				case <-ctx.Done():
+					return
+				case <-signal:
+				}
+				continue
+			}
+			v := pending[0]
+			var zero T
+			pending[0] = zero
+			pending = pending[1:]
+			mu.Unlock()
+
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, publish
+}
@@ -0,0 +1,36 @@
+package subscription
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscription(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	ch, publish := New[int](ctx)
+
+	// publishing does not wait for the subscriber
+	for i := range 100 {
+		publish(i)
+	}
+	for i := range 100 {
+		select {
+		case v := <-ch:
+			require.Equal(t, i, v)
+		case <-time.After(3 * time.Second):
+			t.Fatal("expected value")
+		}
+	}
+
+	cancel()
+	publish(100)
+	select {
+	case _, ok := <-ch:
+		require.False(t, ok)
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected channel to be closed")
+	}
+}
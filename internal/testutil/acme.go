@@ -0,0 +1,631 @@
+package testutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	mathrand "math/rand"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ACMEChallengeHTTP01    = "http-01"
+	ACMEChallengeTLSALPN01 = "tls-alpn-01"
+)
+
+var idPeAcmeIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+// ACMEServer is a local stand-in of an ACME (RFC 8555) certificate authority.
+// Challenges are validated synchronously when they are accepted. JWS signatures are not verified.
+type ACMEServer struct {
+	*httptest.Server
+
+	Orders      atomic.Int32
+	Validations atomic.Int32
+
+	// CertValidity is the validity of the issued certificates.
+	CertValidity time.Duration
+
+	caTLSCert  *tls.Certificate
+	caX509Cert *x509.Certificate
+
+	mu          sync.Mutex
+	httpAddr    string
+	tlsALPNAddr string
+	nextID      int
+	accounts    map[string]string // account URL -> JWK thumbprint
+	thumbprints map[string]string // JWK thumbprint -> account URL
+	orders      map[string]*acmeOrder
+	authzs      map[string]*acmeAuthz
+	challenges  map[string]*acmeChallenge
+	certs       map[string][]byte
+}
+
+type acmeOrder struct {
+	id          string
+	account     string
+	status      string
+	identifiers []string
+	authzs      []*acmeAuthz
+	certURL     string
+}
+
+type acmeAuthz struct {
+	id         string
+	order      *acmeOrder
+	domain     string
+	status     string
+	challenges []*acmeChallenge
+}
+
+type acmeChallenge struct {
+	id     string
+	authz  *acmeAuthz
+	typ    string
+	token  string
+	status string
+	err    string
+}
+
+func NewACMEServer(caTLSCert *tls.Certificate, caX509Cert *x509.Certificate) *ACMEServer {
+	s := &ACMEServer{
+		CertValidity: 90 * 24 * time.Hour,
+		caTLSCert:    caTLSCert,
+		caX509Cert:   caX509Cert,
+		accounts:     make(map[string]string),
+		thumbprints:  make(map[string]string),
+		orders:       make(map[string]*acmeOrder),
+		authzs:       make(map[string]*acmeAuthz),
+		challenges:   make(map[string]*acmeChallenge),
+		certs:        make(map[string][]byte),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /directory", s.directory)
+	mux.HandleFunc("/nonce", func(w http.ResponseWriter, _ *http.Request) {
+		s.setNonce(w)
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("POST /account", s.newAccount)
+	mux.HandleFunc("POST /order", s.newOrder)
+	mux.HandleFunc("POST /order/{id}", s.getOrder)
+	mux.HandleFunc("POST /authz/{id}", s.getAuthz)
+	mux.HandleFunc("POST /challenge/{id}", s.acceptChallenge)
+	mux.HandleFunc("POST /finalize/{id}", s.finalize)
+	mux.HandleFunc("POST /cert/{id}", s.getCert)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// DirectoryURL returns the URL of the ACME directory.
+func (s *ACMEServer) DirectoryURL() string {
+	return s.URL + "/directory"
+}
+
+// SetHTTPAddr sets the address dialed to validate http-01 challenges.
+func (s *ACMEServer) SetHTTPAddr(addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.httpAddr = addr
+}
+
+// SetTLSALPNAddr sets the address dialed to validate tls-alpn-01 challenges.
+func (s *ACMEServer) SetTLSALPNAddr(addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tlsALPNAddr = addr
+}
+
+func (s *ACMEServer) directory(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]any{
+		"newNonce":   s.URL + "/nonce",
+		"newAccount": s.URL + "/account",
+		"newOrder":   s.URL + "/order",
+		"revokeCert": s.URL + "/revoke",
+		"keyChange":  s.URL + "/key-change",
+	})
+}
+
+func (s *ACMEServer) newAccount(w http.ResponseWriter, r *http.Request) {
+	header, _, err := readJWS(r)
+	if err != nil {
+		acmeError(w, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+	thumbprint, err := jwkThumbprint(header.JWK)
+	if err != nil {
+		acmeError(w, http.StatusBadRequest, "badPublicKey", err.Error())
+		return
+	}
+	s.mu.Lock()
+	status := http.StatusOK
+	accountURL, ok := s.thumbprints[thumbprint]
+	if !ok {
+		accountURL = fmt.Sprintf("%s/account/%d", s.URL, s.newID())
+		s.thumbprints[thumbprint] = accountURL
+		s.accounts[accountURL] = thumbprint
+		status = http.StatusCreated
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Location", accountURL)
+	s.writeJSON(w, status, map[string]any{"status": "valid"})
+}
+
+func (s *ACMEServer) newOrder(w http.ResponseWriter, r *http.Request) {
+	account, payload, ok := s.readAccountJWS(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Identifiers []struct {
+			Type  string `json:"type"`
+			Value string `json:"value"`
+		} `json:"identifiers"`
+	}
+	if err := json.Unmarshal(payload, &req); err != nil || len(req.Identifiers) == 0 {
+		acmeError(w, http.StatusBadRequest, "malformed", "invalid order")
+		return
+	}
+	s.Orders.Add(1)
+
+	s.mu.Lock()
+	order := &acmeOrder{
+		id:      fmt.Sprint(s.newID()),
+		account: account,
+		status:  "pending",
+	}
+	for _, id := range req.Identifiers {
+		order.identifiers = append(order.identifiers, id.Value)
+		authz := &acmeAuthz{
+			id:     fmt.Sprint(s.newID()),
+			order:  order,
+			domain: id.Value,
+			status: "pending",
+		}
+		for _, typ := range []string{ACMEChallengeTLSALPN01, ACMEChallengeHTTP01} {
+			chal := &acmeChallenge{
+				id:     fmt.Sprint(s.newID()),
+				authz:  authz,
+				typ:    typ,
+				token:  randomToken(),
+				status: "pending",
+			}
+			authz.challenges = append(authz.challenges, chal)
+			s.challenges[chal.id] = chal
+		}
+		order.authzs = append(order.authzs, authz)
+		s.authzs[authz.id] = authz
+	}
+	s.orders[order.id] = order
+	body := s.orderJSON(order)
+	s.mu.Unlock()
+
+	w.Header().Set("Location", s.URL+"/order/"+order.id)
+	s.writeJSON(w, http.StatusCreated, body)
+}
+
+func (s *ACMEServer) getOrder(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := s.readAccountJWS(w, r); !ok {
+		return
+	}
+	s.mu.Lock()
+	order, ok := s.orders[r.PathValue("id")]
+	var body map[string]any
+	if ok {
+		body = s.orderJSON(order)
+	}
+	s.mu.Unlock()
+	if !ok {
+		acmeError(w, http.StatusNotFound, "malformed", "order not found")
+		return
+	}
+	w.Header().Set("Location", s.URL+"/order/"+order.id)
+	s.writeJSON(w, http.StatusOK, body)
+}
+
+func (s *ACMEServer) getAuthz(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := s.readAccountJWS(w, r); !ok {
+		return
+	}
+	s.mu.Lock()
+	authz, ok := s.authzs[r.PathValue("id")]
+	var body map[string]any
+	if ok {
+		body = s.authzJSON(authz)
+	}
+	s.mu.Unlock()
+	if !ok {
+		acmeError(w, http.StatusNotFound, "malformed", "authorization not found")
+		return
+	}
+	s.writeJSON(w, http.StatusOK, body)
+}
+
+func (s *ACMEServer) acceptChallenge(w http.ResponseWriter, r *http.Request) {
+	account, _, ok := s.readAccountJWS(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	chal, ok := s.challenges[r.PathValue("id")]
+	var (
+		keyAuth string
+		addr    string
+		pending bool
+	)
+	if ok {
+		keyAuth = chal.token + "." + s.accounts[account]
+		pending = chal.status == "pending"
+		if chal.typ == ACMEChallengeHTTP01 {
+			addr = s.httpAddr
+		} else {
+			addr = s.tlsALPNAddr
+		}
+	}
+	s.mu.Unlock()
+	if !ok {
+		acmeError(w, http.StatusNotFound, "malformed", "challenge not found")
+		return
+	}
+
+	if pending {
+		var err error
+		if chal.typ == ACMEChallengeHTTP01 {
+			err = validateHTTP01(addr, chal.authz.domain, chal.token, keyAuth)
+		} else {
+			err = validateTLSALPN01(addr, chal.authz.domain, keyAuth)
+		}
+		s.Validations.Add(1)
+		s.mu.Lock()
+		s.completeChallenge(chal, err)
+		s.mu.Unlock()
+	}
+	s.mu.Lock()
+	body := s.challengeJSON(chal)
+	s.mu.Unlock()
+	s.writeJSON(w, http.StatusOK, body)
+}
+
+func (s *ACMEServer) completeChallenge(chal *acmeChallenge, err error) {
+	authz := chal.authz
+	if err != nil {
+		chal.status = "invalid"
+		chal.err = err.Error()
+		authz.status = "invalid"
+		authz.order.status = "invalid"
+		return
+	}
+	chal.status = "valid"
+	authz.status = "valid"
+	for _, z := range authz.order.authzs {
+		if z.status != "valid" {
+			return
+		}
+	}
+	authz.order.status = "ready"
+}
+
+func (s *ACMEServer) finalize(w http.ResponseWriter, r *http.Request) {
+	_, payload, ok := s.readAccountJWS(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		CSR string `json:"csr"`
+	}
+	if err := json.Unmarshal(payload, &req); err != nil {
+		acmeError(w, http.StatusBadRequest, "malformed", err.Error())
+		return
+	}
+	der, err := base64.RawURLEncoding.DecodeString(req.CSR)
+	if err != nil {
+		acmeError(w, http.StatusBadRequest, "badCSR", err.Error())
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil || csr.CheckSignature() != nil {
+		acmeError(w, http.StatusBadRequest, "badCSR", "invalid CSR")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	order, ok := s.orders[r.PathValue("id")]
+	if !ok {
+		acmeError(w, http.StatusNotFound, "malformed", "order not found")
+		return
+	}
+	if order.status != "ready" {
+		acmeError(w, http.StatusForbidden, "orderNotReady", "order is "+order.status)
+		return
+	}
+	names := slices.Clone(csr.DNSNames)
+	slices.Sort(names)
+	identifiers := slices.Clone(order.identifiers)
+	slices.Sort(identifiers)
+	if !slices.Equal(names, identifiers) {
+		acmeError(w, http.StatusBadRequest, "badCSR", "CSR names do not match the order identifiers")
+		return
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(mathrand.Int63()),
+		Subject:      pkix.Name{CommonName: names[0]},
+		NotBefore:    now,
+		NotAfter:     now.Add(s.CertValidity),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		DNSNames:     csr.DNSNames,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, s.caX509Cert, csr.PublicKey, s.caTLSCert.PrivateKey)
+	if err != nil {
+		acmeError(w, http.StatusInternalServerError, "serverInternal", err.Error())
+		return
+	}
+	var chain bytes.Buffer
+	_ = pem.Encode(&chain, &pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	_ = pem.Encode(&chain, &pem.Block{Type: "CERTIFICATE", Bytes: s.caX509Cert.Raw})
+	s.certs[order.id] = chain.Bytes()
+	order.status = "valid"
+	order.certURL = s.URL + "/cert/" + order.id
+
+	w.Header().Set("Location", s.URL+"/order/"+order.id)
+	s.writeJSON(w, http.StatusOK, s.orderJSON(order))
+}
+
+func (s *ACMEServer) getCert(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := s.readAccountJWS(w, r); !ok {
+		return
+	}
+	s.mu.Lock()
+	chain, ok := s.certs[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		acmeError(w, http.StatusNotFound, "malformed", "certificate not found")
+		return
+	}
+	s.setNonce(w)
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	_, _ = w.Write(chain)
+}
+
+func (s *ACMEServer) orderJSON(order *acmeOrder) map[string]any {
+	identifiers := make([]map[string]string, 0, len(order.identifiers))
+	for _, id := range order.identifiers {
+		identifiers = append(identifiers, map[string]string{"type": "dns", "value": id})
+	}
+	authzs := make([]string, 0, len(order.authzs))
+	for _, authz := range order.authzs {
+		authzs = append(authzs, s.URL+"/authz/"+authz.id)
+	}
+	body := map[string]any{
+		"status":         order.status,
+		"identifiers":    identifiers,
+		"authorizations": authzs,
+		"finalize":       s.URL + "/finalize/" + order.id,
+	}
+	if order.certURL != "" {
+		body["certificate"] = order.certURL
+	}
+	return body
+}
+
+func (s *ACMEServer) authzJSON(authz *acmeAuthz) map[string]any {
+	challenges := make([]map[string]any, 0, len(authz.challenges))
+	for _, chal := range authz.challenges {
+		challenges = append(challenges, s.challengeJSON(chal))
+	}
+	return map[string]any{
+		"status":     authz.status,
+		"identifier": map[string]string{"type": "dns", "value": authz.domain},
+		"challenges": challenges,
+	}
+}
+
+func (s *ACMEServer) challengeJSON(chal *acmeChallenge) map[string]any {
+	body := map[string]any{
+		"type":   chal.typ,
+		"url":    s.URL + "/challenge/" + chal.id,
+		"token":  chal.token,
+		"status": chal.status,
+	}
+	if chal.err != "" {
+		body["error"] = map[string]any{
+			"type":   "urn:ietf:params:acme:error:incorrectResponse",
+			"detail": chal.err,
+		}
+	}
+	return body
+}
+
+// readAccountJWS reads the request and returns the account URL of a registered account.
+func (s *ACMEServer) readAccountJWS(w http.ResponseWriter, r *http.Request) (string, []byte, bool) {
+	header, payload, err := readJWS(r)
+	if err != nil {
+		acmeError(w, http.StatusBadRequest, "malformed", err.Error())
+		return "", nil, false
+	}
+	s.mu.Lock()
+	_, ok := s.accounts[header.KID]
+	s.mu.Unlock()
+	if !ok {
+		acmeError(w, http.StatusUnauthorized, "accountDoesNotExist", "unknown account")
+		return "", nil, false
+	}
+	return header.KID, payload, true
+}
+
+func (s *ACMEServer) newID() int {
+	s.nextID++
+	return s.nextID
+}
+
+func (s *ACMEServer) setNonce(w http.ResponseWriter) {
+	w.Header().Set("Replay-Nonce", randomToken())
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+func (s *ACMEServer) writeJSON(w http.ResponseWriter, status int, v any) {
+	s.setNonce(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+type jwsHeader struct {
+	Alg   string          `json:"alg"`
+	Nonce string          `json:"nonce"`
+	URL   string          `json:"url"`
+	KID   string          `json:"kid"`
+	JWK   json.RawMessage `json:"jwk"`
+}
+
+// readJWS decodes the protected header and the payload of a flattened JWS request body.
+func readJWS(r *http.Request) (*jwsHeader, []byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	var msg struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+	}
+	if err = json.Unmarshal(body, &msg); err != nil {
+		return nil, nil, err
+	}
+	protected, err := base64.RawURLEncoding.DecodeString(msg.Protected)
+	if err != nil {
+		return nil, nil, err
+	}
+	var header jwsHeader
+	if err = json.Unmarshal(protected, &header); err != nil {
+		return nil, nil, err
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(msg.Payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &header, payload, nil
+}
+
+// jwkThumbprint computes the RFC 7638 thumbprint of an EC or RSA JWK.
+func jwkThumbprint(raw json.RawMessage) (string, error) {
+	var jwk struct {
+		Kty string `json:"kty"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+		E   string `json:"e"`
+		N   string `json:"n"`
+	}
+	if err := json.Unmarshal(raw, &jwk); err != nil {
+		return "", err
+	}
+	var canonical string
+	switch jwk.Kty {
+	case "EC":
+		canonical = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`, jwk.Crv, jwk.X, jwk.Y)
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, jwk.E, jwk.N)
+	default:
+		return "", fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func validateHTTP01(addr, domain, token, keyAuth string) error {
+	if addr == "" {
+		return fmt.Errorf("no http-01 address for %s", domain)
+	}
+	req, err := http.NewRequest(http.MethodGet, "http://"+addr+"/.well-known/acme-challenge/"+token, nil)
+	if err != nil {
+		return err
+	}
+	req.Host = domain
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != keyAuth {
+		return fmt.Errorf("invalid http-01 response for %s: status %d", domain, resp.StatusCode)
+	}
+	return nil
+}
+
+func validateTLSALPN01(addr, domain, keyAuth string) error {
+	if addr == "" {
+		return fmt.Errorf("no tls-alpn-01 address for %s", domain)
+	}
+	// nolint:gosec // the challenge certificate is self-signed
+	conn, err := tls.Dial("tcp", addr, &tls.Config{
+		ServerName:         domain,
+		NextProtos:         []string{"acme-tls/1"},
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	state := conn.ConnectionState()
+	if state.NegotiatedProtocol != "acme-tls/1" {
+		return fmt.Errorf("acme-tls/1 protocol not negotiated for %s", domain)
+	}
+	cert := state.PeerCertificates[0]
+	if !slices.Equal(cert.DNSNames, []string{domain}) {
+		return fmt.Errorf("invalid tls-alpn-01 certificate names for %s: %v", domain, cert.DNSNames)
+	}
+	sum := sha256.Sum256([]byte(keyAuth))
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(idPeAcmeIdentifier) {
+			continue
+		}
+		var value []byte
+		if _, err = asn1.Unmarshal(ext.Value, &value); err != nil {
+			return err
+		}
+		if !bytes.Equal(value, sum[:]) {
+			return fmt.Errorf("invalid tls-alpn-01 key authorization for %s", domain)
+		}
+		return nil
+	}
+	return fmt.Errorf("tls-alpn-01 certificate for %s without acmeIdentifier extension", domain)
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func acmeError(w http.ResponseWriter, status int, typ, detail string) {
+	w.Header().Set("Replay-Nonce", randomToken())
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"type":   "urn:ietf:params:acme:error:" + typ,
+		"detail": detail,
+	})
+}
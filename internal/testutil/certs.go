@@ -26,6 +26,11 @@ import (
 const DefaultKeyPassword = "test123"
 
 func GenerateCRL(caX509Cert *x509.Certificate, caPrivateKey crypto.PrivateKey, certs []*x509.Certificate, crlFile *os.File) error {
+	return GenerateCRLWithValidity(caX509Cert, caPrivateKey, certs, time.Now().Add(-1*time.Minute), time.Now().Add(60*time.Minute), crlFile)
+}
+
+// GenerateCRLWithValidity generates a CRL with the given ThisUpdate and NextUpdate.
+func GenerateCRLWithValidity(caX509Cert *x509.Certificate, caPrivateKey crypto.PrivateKey, certs []*x509.Certificate, thisUpdate, nextUpdate time.Time, crlFile *os.File) error {
 	revoked := make([]x509.RevocationListEntry, 0)
 	for _, cert := range certs {
 		revoked = append(revoked, x509.RevocationListEntry{
@@ -37,8 +42,8 @@ func GenerateCRL(caX509Cert *x509.Certificate, caPrivateKey crypto.PrivateKey, c
 		SignatureAlgorithm:        x509.SHA256WithRSA,
 		RevokedCertificateEntries: revoked,
 		Number:                    big.NewInt(mathrand.Int63()),
-		ThisUpdate:                time.Now().Add(-1 * time.Minute),
-		NextUpdate:                time.Now().Add(60 * time.Minute),
+		ThisUpdate:                thisUpdate,
+		NextUpdate:                nextUpdate,
 	}
 	signer, ok := caPrivateKey.(crypto.Signer)
 	if !ok {
@@ -87,6 +92,102 @@ func GenerateCert(caCert *tls.Certificate, client bool, certFile *os.File, keyFi
 			IPAddresses: []net.IP{[]byte{127, 0, 0, 1}},
 		}
 	}
+	return generateCert(caCert, certificate, certFile, keyFile)
+}
+
+// GenerateServerCertWithNames generates a server certificate signed by caCert for the given DNS names.
+func GenerateServerCertWithNames(caCert *tls.Certificate, dnsNames []string, certFile *os.File, keyFile *os.File) (*tls.Certificate, *x509.Certificate, error) {
+	certificate := &x509.Certificate{
+		SerialNumber: big.NewInt(mathrand.Int63()),
+		Subject: pkix.Name{
+			CommonName: dnsNames[0],
+		},
+		NotBefore:   time.Now(),
+		NotAfter:    time.Now().AddDate(10, 0, 0),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		DNSNames:    dnsNames,
+	}
+	return generateCert(caCert, certificate, certFile, keyFile)
+}
+
+// GenerateClientCertWithSerial generates a client certificate with the given serial number signed by caCert.
+func GenerateClientCertWithSerial(caCert *tls.Certificate, serialNumber *big.Int, certFile *os.File, keyFile *os.File) (*tls.Certificate, *x509.Certificate, error) {
+	certificate := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			CommonName: fmt.Sprintf("client-%d", mathrand.Int63()),
+		},
+		NotBefore:   time.Now(),
+		NotAfter:    time.Now().AddDate(10, 0, 0),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+	}
+	return generateCert(caCert, certificate, certFile, keyFile)
+}
+
+// GenerateIntermediateCA generates an intermediate CA certificate signed by caCert.
+func GenerateIntermediateCA(caCert *tls.Certificate, certFile *os.File, keyFile *os.File) (*tls.Certificate, *x509.Certificate, error) {
+	certificate := &x509.Certificate{
+		SerialNumber: big.NewInt(mathrand.Int63()),
+		Subject: pkix.Name{
+			CommonName: fmt.Sprintf("intermediate-ca-%d", mathrand.Int63()),
+		},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		IsCA:                  true,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+	}
+	return generateCert(caCert, certificate, certFile, keyFile)
+}
+
+// GenerateServerCertChain generates a server certificate with the OCSP responder URL and writes it followed by the CA certificate.
+func GenerateServerCertChain(caCert *tls.Certificate, ocspServer string, certFile *os.File, keyFile *os.File) (*tls.Certificate, *x509.Certificate, error) {
+	certificate := &x509.Certificate{
+		SerialNumber: big.NewInt(mathrand.Int63()),
+		Subject: pkix.Name{
+			CommonName: fmt.Sprintf("server-%d", mathrand.Int63()),
+		},
+		NotBefore:   time.Now(),
+		NotAfter:    time.Now().AddDate(10, 0, 0),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{[]byte{127, 0, 0, 1}},
+		OCSPServer:  []string{ocspServer},
+	}
+	tlsCert, x509Cert, err := generateCert(caCert, certificate, certFile, keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	chainFile, err := os.OpenFile(certFile.Name(), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer closeFile(chainFile)
+	if err = pem.Encode(chainFile, &pem.Block{Type: "CERTIFICATE", Bytes: caCert.Certificate[0]}); err != nil {
+		return nil, nil, err
+	}
+	tlsCert.Certificate = append(tlsCert.Certificate, caCert.Certificate[0])
+	return tlsCert, x509Cert, nil
+}
+
+// WritePKCS12File writes the certificate, its private key and the CA certificate to a password-protected PKCS#12 file.
+func WritePKCS12File(name string, cert *tls.Certificate, caCert *x509.Certificate, password string) error {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	data, err := keyutil.EncodePKCS12(cert.PrivateKey, leaf, []*x509.Certificate{caCert}, password)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, 0o600)
+}
+
+func generateCert(caCert *tls.Certificate, certificate *x509.Certificate, certFile *os.File, keyFile *os.File) (*tls.Certificate, *x509.Certificate, error) {
 	priv, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
 		return nil, nil, err
@@ -0,0 +1,77 @@
+package testutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// WriteDataDir mimics the Kubernetes atomic writer: files are written to a new timestamped generation directory,
+// the ..data symlink is swapped to it and the previous generation is removed.
+func WriteDataDir(dir string, files map[string][]byte) error {
+	generation := fmt.Sprintf("..%s", time.Now().Format("2006_01_02_15_04_05.000000000"))
+	generationDir := filepath.Join(dir, generation)
+	if err := os.Mkdir(generationDir, 0o700); err != nil {
+		return err
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(generationDir, name), data, 0o600); err != nil {
+			return err
+		}
+	}
+	dataLink := filepath.Join(dir, "..data")
+	previous, _ := os.Readlink(dataLink)
+
+	tmpLink := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(generation, tmpLink); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpLink, dataLink); err != nil {
+		return err
+	}
+	for name := range files {
+		link := filepath.Join(dir, name)
+		if _, err := os.Lstat(link); err == nil {
+			continue
+		}
+		if err := os.Symlink(filepath.Join("..data", name), link); err != nil {
+			return err
+		}
+	}
+	if previous != "" {
+		return os.RemoveAll(filepath.Join(dir, previous))
+	}
+	return nil
+}
+
+// WriteServerDataDir writes the bundle server files into dir using the Kubernetes TLS secret layout.
+func (bundle *CertsBundle) WriteServerDataDir(dir string) error {
+	return writeBundleDataDir(dir, map[string]string{
+		"tls.crt": bundle.ServerCert.Name(),
+		"tls.key": bundle.ServerKey.Name(),
+		"ca.crt":  bundle.CACert.Name(),
+	})
+}
+
+// WriteClientDataDir writes the bundle client files into dir using the Kubernetes TLS secret layout.
+func (bundle *CertsBundle) WriteClientDataDir(dir string) error {
+	return writeBundleDataDir(dir, map[string]string{
+		"tls.crt": bundle.ClientCert.Name(),
+		"tls.key": bundle.ClientKey.Name(),
+		"ca.crt":  bundle.CACert.Name(),
+	})
+}
+
+func writeBundleDataDir(dir string, sources map[string]string) error {
+	files := make(map[string][]byte, len(sources))
+	for name, source := range sources {
+		// nolint:gosec
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return err
+		}
+		files[name] = data
+	}
+	return WriteDataDir(dir, files)
+}
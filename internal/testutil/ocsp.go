@@ -0,0 +1,85 @@
+package testutil
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// OCSPResponder is a local OCSP responder signing responses with the CA key.
+type OCSPResponder struct {
+	*httptest.Server
+
+	Requests atomic.Int32
+	Validity time.Duration
+
+	mu      sync.Mutex
+	revoked map[string]struct{}
+}
+
+func NewOCSPResponder(caTLSCert *tls.Certificate, caX509Cert *x509.Certificate) *OCSPResponder {
+	r := &OCSPResponder{
+		Validity: time.Hour,
+		revoked:  make(map[string]struct{}),
+	}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.Requests.Add(1)
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ocspReq, err := ocsp.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		now := time.Now()
+		template := ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: ocspReq.SerialNumber,
+			ThisUpdate:   now.Add(-1 * time.Minute),
+			NextUpdate:   now.Add(r.Validity),
+		}
+		if r.IsRevoked(ocspReq.SerialNumber) {
+			template.Status = ocsp.Revoked
+			template.RevokedAt = now.Add(-1 * time.Minute)
+		}
+		resp, err := ocsp.CreateResponse(caX509Cert, caX509Cert, template, caTLSCert.PrivateKey.(crypto.Signer))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		_, _ = w.Write(resp)
+	}))
+	return r
+}
+
+func (r *OCSPResponder) Revoke(serialNumber *big.Int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.revoked[string(serialNumber.Bytes())] = struct{}{}
+}
+
+func (r *OCSPResponder) IsRevoked(serialNumber *big.Int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.revoked[string(serialNumber.Bytes())]
+	return ok
+}
+
+func (r *OCSPResponder) Unrevoke(serialNumber *big.Int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.revoked, string(serialNumber.Bytes()))
+}
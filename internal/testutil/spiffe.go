@@ -0,0 +1,186 @@
+package testutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	mathrand "math/rand"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/proto/spiffe/workload"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// WorkloadAPI is a local stand-in of the SPIFFE Workload API serving X.509 SVIDs on a Unix socket.
+// The updates are pushed to all open FetchX509SVID streams.
+type WorkloadAPI struct {
+	workload.UnimplementedSpiffeWorkloadAPIServer
+
+	// Addr is the socket address, e.g. unix:///tmp/spiffe/agent.sock.
+	Addr string
+
+	dir    string
+	server *grpc.Server
+
+	mu          sync.Mutex
+	resp        *workload.X509SVIDResponse
+	subscribers map[chan *workload.X509SVIDResponse]struct{}
+}
+
+func NewWorkloadAPI() (*WorkloadAPI, error) {
+	// the socket path length is limited, so the default temp dir is used instead of the test one
+	dir, err := os.MkdirTemp("", "spiffe-")
+	if err != nil {
+		return nil, err
+	}
+	socketPath := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	w := &WorkloadAPI{
+		Addr:        "unix://" + socketPath,
+		dir:         dir,
+		server:      grpc.NewServer(),
+		subscribers: make(map[chan *workload.X509SVIDResponse]struct{}),
+	}
+	workload.RegisterSpiffeWorkloadAPIServer(w.server, w)
+	go func() { _ = w.server.Serve(listener) }()
+	return w, nil
+}
+
+func (w *WorkloadAPI) Close() {
+	w.server.Stop()
+	_ = os.RemoveAll(w.dir)
+}
+
+// SetX509SVID pushes the SVID with the bundle of its trust domain and the federated bundles keyed by trust domain ID.
+func (w *WorkloadAPI) SetX509SVID(spiffeID string, cert *tls.Certificate, bundle []*x509.Certificate, federated map[string][]*x509.Certificate) error {
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		return err
+	}
+	var certDER []byte
+	for _, der := range cert.Certificate {
+		certDER = append(certDER, der...)
+	}
+	resp := &workload.X509SVIDResponse{
+		Svids: []*workload.X509SVID{{
+			SpiffeId:    spiffeID,
+			X509Svid:    certDER,
+			X509SvidKey: key,
+			Bundle:      concatRaw(bundle),
+		}},
+	}
+	if len(federated) != 0 {
+		resp.FederatedBundles = make(map[string][]byte, len(federated))
+		for td, certs := range federated {
+			resp.FederatedBundles[td] = concatRaw(certs)
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.resp = resp
+	for ch := range w.subscribers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- resp
+	}
+	return nil
+}
+
+func (w *WorkloadAPI) FetchX509SVID(_ *workload.X509SVIDRequest, stream workload.SpiffeWorkloadAPI_FetchX509SVIDServer) error {
+	md, ok := metadata.FromIncomingContext(stream.Context())
+	if !ok || len(md.Get("workload.spiffe.io")) != 1 || md.Get("workload.spiffe.io")[0] != "true" {
+		return status.Error(codes.InvalidArgument, "security header missing from request")
+	}
+	ch := make(chan *workload.X509SVIDResponse, 1)
+	w.mu.Lock()
+	w.subscribers[ch] = struct{}{}
+	if w.resp != nil {
+		ch <- w.resp
+	}
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.subscribers, ch)
+		w.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case resp := <-ch:
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// GenerateSVID creates an X.509 SVID with the SPIFFE ID as the only URI SAN.
+func GenerateSVID(caCert *tls.Certificate, spiffeID string, dnsNames ...string) (*tls.Certificate, *x509.Certificate, error) {
+	id, err := url.Parse(spiffeID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if id.Scheme != "spiffe" {
+		return nil, nil, errors.New("invalid SPIFFE ID: " + spiffeID)
+	}
+	ca, err := x509.ParseCertificate(caCert.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(mathrand.Int63()),
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement,
+		BasicConstraintsValid: true,
+		URIs:                  []*url.URL{id},
+		DNSNames:              dnsNames,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, priv.Public(), caCert.PrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	x509Cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  priv,
+		Leaf:        x509Cert,
+	}, x509Cert, nil
+}
+
+func concatRaw(certs []*x509.Certificate) []byte {
+	var raw []byte
+	for _, cert := range certs {
+		raw = append(raw, cert.Raw...)
+	}
+	return raw
+}
@@ -0,0 +1,238 @@
+package testutil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	mathrand "math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// VaultPKI is a local stand-in of the Vault PKI secrets engine mounted at pki with the AppRole auth method.
+type VaultPKI struct {
+	*httptest.Server
+
+	Issued atomic.Int32
+	Signed atomic.Int32
+	Logins atomic.Int32
+
+	// DefaultTTL is used when the request has no ttl.
+	DefaultTTL time.Duration
+	// TokenTTL is the lease duration of AppRole tokens in seconds.
+	TokenTTL int
+
+	caTLSCert  *tls.Certificate
+	caX509Cert *x509.Certificate
+	role       string
+	roleID     string
+	secretID   string
+
+	mu     sync.Mutex
+	tokens map[string]struct{}
+	last   *x509.Certificate
+}
+
+func NewVaultPKI(caTLSCert *tls.Certificate, caX509Cert *x509.Certificate, role, token string) *VaultPKI {
+	v := &VaultPKI{
+		DefaultTTL: time.Hour,
+		caTLSCert:  caTLSCert,
+		caX509Cert: caX509Cert,
+		role:       role,
+		tokens:     map[string]struct{}{token: {}},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/auth/approle/login", v.login)
+	mux.HandleFunc("POST /v1/pki/issue/{role}", v.issue)
+	mux.HandleFunc("POST /v1/pki/sign/{role}", v.issue)
+	mux.HandleFunc("GET /v1/pki/ca_chain", func(w http.ResponseWriter, _ *http.Request) {
+		_ = pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: caX509Cert.Raw})
+	})
+	v.Server = httptest.NewServer(mux)
+	return v
+}
+
+// SetAppRole sets the AppRole credentials accepted by the login.
+func (v *VaultPKI) SetAppRole(roleID, secretID string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.roleID = roleID
+	v.secretID = secretID
+}
+
+// RevokeTokens revokes all tokens.
+func (v *VaultPKI) RevokeTokens() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.tokens = make(map[string]struct{})
+}
+
+// LastIssued returns the last issued or signed certificate.
+func (v *VaultPKI) LastIssued() *x509.Certificate {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.last
+}
+
+func (v *VaultPKI) login(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RoleID   string `json:"role_id"`
+		SecretID string `json:"secret_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		vaultError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.roleID == "" || req.RoleID != v.roleID || req.SecretID != v.secretID {
+		vaultError(w, http.StatusBadRequest, "invalid role or secret ID")
+		return
+	}
+	v.Logins.Add(1)
+	token := fmt.Sprintf("approle-token-%d", mathrand.Int63())
+	v.tokens[token] = struct{}{}
+	writeJSON(w, map[string]any{
+		"auth": map[string]any{
+			"client_token":   token,
+			"lease_duration": v.TokenTTL,
+		},
+	})
+}
+
+func (v *VaultPKI) issue(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	_, ok := v.tokens[r.Header.Get("X-Vault-Token")]
+	v.mu.Unlock()
+	if !ok {
+		vaultError(w, http.StatusForbidden, "permission denied")
+		return
+	}
+	if r.PathValue("role") != v.role {
+		vaultError(w, http.StatusBadRequest, "unknown role")
+		return
+	}
+	var req struct {
+		CommonName string `json:"common_name"`
+		AltNames   string `json:"alt_names"`
+		IPSANs     string `json:"ip_sans"`
+		TTL        string `json:"ttl"`
+		CSR        string `json:"csr"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		vaultError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	ttl := v.DefaultTTL
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil {
+			vaultError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	var (
+		publicKey  crypto.PublicKey
+		privateKey string
+	)
+	if req.CSR != "" {
+		block, _ := pem.Decode([]byte(req.CSR))
+		if block == nil {
+			vaultError(w, http.StatusBadRequest, "invalid CSR")
+			return
+		}
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil || csr.CheckSignature() != nil {
+			vaultError(w, http.StatusBadRequest, "invalid CSR")
+			return
+		}
+		publicKey = csr.PublicKey
+		v.Signed.Add(1)
+	} else {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			vaultError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			vaultError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		publicKey = key.Public()
+		privateKey = string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+		v.Issued.Add(1)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(mathrand.Int63()),
+		Subject:      pkix.Name{CommonName: req.CommonName},
+		NotBefore:    now,
+		NotAfter:     now.Add(ttl),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		DNSNames:     splitNames(req.AltNames),
+	}
+	for _, ip := range splitNames(req.IPSANs) {
+		template.IPAddresses = append(template.IPAddresses, net.ParseIP(ip))
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, v.caX509Cert, publicKey, v.caTLSCert.PrivateKey)
+	if err != nil {
+		vaultError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		vaultError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	v.mu.Lock()
+	v.last = cert
+	v.mu.Unlock()
+
+	caPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: v.caX509Cert.Raw}))
+	data := map[string]any{
+		"certificate":   string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		"issuing_ca":    caPEM,
+		"ca_chain":      []string{caPEM},
+		"serial_number": cert.SerialNumber.String(),
+	}
+	if privateKey != "" {
+		data["private_key"] = privateKey
+	}
+	writeJSON(w, map[string]any{"data": data})
+}
+
+func splitNames(names string) []string {
+	var result []string
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+func vaultError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"errors": []string{message}})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
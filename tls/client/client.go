@@ -1,7 +1,9 @@
 package tlsclient
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"log/slog"
 	"time"
@@ -15,50 +17,149 @@ const (
 
 type TLSClientConfigFunc func() *tls.Config
 
-func NewTLSClientConfigFunc(logger *slog.Logger, src source.ClientCertsSource, opts ...TLSClientConfigOption) (TLSClientConfigFunc, error) {
-	store, err := NewTLSClientCertsStore(logger, src)
+// NewTLSClientConfigFunc provides a function returning client TLS configuration with the current certificates.
+// The certificates are rotated until ctx is done.
+func NewTLSClientConfigFunc(ctx context.Context, logger *slog.Logger, src source.ClientCertsSource, opts ...TLSClientConfigOption) (TLSClientConfigFunc, error) {
+	store, err := NewTLSClientCertsStore(ctx, logger, src)
 	if err != nil {
 		return nil, err
 	}
-	var getClientCertificateFunc func(info *tls.CertificateRequestInfo) (*tls.Certificate, error)
-	if store.LoadClientCerts().Certificate != nil {
-		// Set function only when client certificate is available.
-		// TLS 1.3 checks if GetClientCertificate function is nil, if it is not nil,
-		// it assumes client certificate is available which call cause the panic if nil is returned.
-		//nolint:unparam
-		getClientCertificateFunc = func(_ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
-			return store.LoadClientCerts().Certificate, nil
-		}
-	}
+	return NewStoreTLSClientConfigFunc(store, opts...), nil
+}
+
+// NewStoreTLSClientConfigFunc provides a function returning client TLS configuration with the current certificates of the store.
+func NewStoreTLSClientConfigFunc(store *source.ClientCertsStore, opts ...TLSClientConfigOption) TLSClientConfigFunc {
 	return func() *tls.Config {
 		cs := store.LoadClientCerts()
 		x := &tls.Config{
 			RootCAs: cs.RootCAs,
 			// nolint:gosec
 			InsecureSkipVerify:   cs.InsecureSkipVerify,
-			GetClientCertificate: getClientCertificateFunc,
+			GetClientCertificate: getClientCertificate(store),
 		}
 		for _, opt := range opts {
 			opt(x)
 		}
 		return x
-	}, nil
+	}
+}
+
+// NewTLSClientConfig provides a client TLS configuration which follows the rotation of the certificates.
+// The certificates are rotated until ctx is done. See NewStoreTLSClientConfig.
+func NewTLSClientConfig(ctx context.Context, logger *slog.Logger, src source.ClientCertsSource, opts ...TLSClientConfigOption) (*tls.Config, error) {
+	store, err := NewTLSClientCertsStore(ctx, logger, src)
+	if err != nil {
+		return nil, err
+	}
+	return NewStoreTLSClientConfig(store, opts...), nil
 }
 
-func NewTLSClientCertsStore(logger *slog.Logger, src source.ClientCertsSource) (*source.ClientCertsStore, error) {
+// NewStoreTLSClientConfig provides a client TLS configuration bound to the store, which can be cached by libraries.
+// RootCAs is left unset and the server certificate is verified in VerifyConnection against the current root CAs of the store.
+// When connecting to an IP address, the server name must be set with WithTLSClientServerName
+// or the server must be verified with WithTLSClientServerIdentity.
+func NewStoreTLSClientConfig(store *source.ClientCertsStore, opts ...TLSClientConfigOption) *tls.Config {
+	return newStoreTLSClientConfig(store, nil, opts...)
+}
+
+// newStoreTLSClientConfig works like NewStoreTLSClientConfig, but starts from a clone of the base config.
+// The root CAs and the skip verify option of the base are replaced by the ones of the store.
+func newStoreTLSClientConfig(store *source.ClientCertsStore, base *tls.Config, opts ...TLSClientConfigOption) *tls.Config {
+	// nolint:gosec
+	x := &tls.Config{}
+	var verifyConnection func(tls.ConnectionState) error
+	if base != nil {
+		x = base.Clone()
+		x.RootCAs = nil
+		verifyConnection = base.VerifyConnection
+	}
+	// nolint:gosec // G402: the server certificate is verified in VerifyConnection
+	x.InsecureSkipVerify = true
+	x.GetClientCertificate = getClientCertificate(store)
+	for _, opt := range opts {
+		opt(x)
+	}
+	serverName := x.ServerName
+	x.VerifyConnection = func(state tls.ConnectionState) error {
+		cs := store.LoadClientCerts()
+		// the options are applied again with the current root CAs, e.g. WithTLSClientServerIdentity
+		v := &tls.Config{
+			RootCAs: cs.RootCAs,
+			// nolint:gosec
+			InsecureSkipVerify: cs.InsecureSkipVerify,
+			ServerName:         serverName,
+			VerifyConnection:   verifyConnection,
+		}
+		for _, opt := range opts {
+			opt(v)
+		}
+		if !v.InsecureSkipVerify {
+			if err := verifyServerCertificate(v.RootCAs, state, serverName); err != nil {
+				return err
+			}
+		}
+		if v.VerifyConnection != nil {
+			return v.VerifyConnection(state)
+		}
+		return nil
+	}
+	return x
+}
+
+func verifyServerCertificate(rootCAs *x509.CertPool, state tls.ConnectionState, serverName string) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("tls: server did not provide a certificate")
+	}
+	// SNI is not sent for IP addresses
+	if state.ServerName != "" {
+		serverName = state.ServerName
+	}
+	if serverName == "" {
+		return errors.New("tls: server name is required to verify the server certificate")
+	}
+	return verifyCertificateChain(rootCAs, state.PeerCertificates, serverName)
+}
+
+// getClientCertificate returns the current client certificate of the store.
+// GetClientCertificate must not return nil, so an empty certificate is returned when the store has none,
+// in which case no client certificate is sent.
+func getClientCertificate(store *source.ClientCertsStore) func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return func(_ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		if cert := store.LoadClientCerts().Certificate; cert != nil {
+			return cert, nil
+		}
+		return &tls.Certificate{}, nil
+	}
+}
+
+// NewTLSClientCertsStore creates a store with the initial certificates of the source and keeps it updated until ctx is done.
+func NewTLSClientCertsStore(ctx context.Context, logger *slog.Logger, src source.ClientCertsSource) (*source.ClientCertsStore, error) {
 	store := source.NewClientCertsStore(logger)
 	logger.Info("initial client certs loading")
 
-	certsChan := src.ClientCerts()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	certsChan := src.ClientCerts(ctx)
 
 	select {
-	case certs := <-certsChan:
+	case certs, ok := <-certsChan:
+		if !ok {
+			cancel()
+			return nil, errors.New("client certs source closed")
+		}
 		store.SetClientCerts(certs)
+	case <-ctx.Done():
+		cancel()
+		return nil, ctx.Err()
 	case <-time.After(initLoadTimeout):
+		cancel()
 		return nil, errors.New("get client certs timeout")
 	}
 
 	go func() {
+		defer cancel()
 		for certs := range certsChan {
 			store.SetClientCerts(certs)
 		}
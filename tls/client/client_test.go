@@ -0,0 +1,111 @@
+package tlsclient_test
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/grepplabs/cert-source/internal/testutil"
+	tlsclient "github.com/grepplabs/cert-source/tls/client"
+	"github.com/grepplabs/cert-source/tls/client/source"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreTLSClientConfigRootCAsRotation(t *testing.T) {
+	bundle1 := testutil.NewCertsBundle()
+	defer bundle1.Close()
+	bundle2 := testutil.NewCertsBundle()
+	defer bundle2.Close()
+
+	serverURL := startTLSServer(t, bundle2)
+	// the server certificate is issued for localhost
+	serverURL = strings.Replace(serverURL, "127.0.0.1", "localhost", 1)
+
+	store := source.NewClientCertsStore(slog.Default())
+	store.SetClientCerts(source.ClientCerts{RootCAs: certPool(bundle1.CAX509Cert)})
+
+	tlsConfig := tlsclient.NewStoreTLSClientConfig(store)
+	require.Nil(t, tlsConfig.RootCAs)
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig, DisableKeepAlives: true},
+	}
+
+	// nolint:bodyclose
+	_, err := client.Get(serverURL)
+	require.ErrorContains(t, err, "tls: failed to verify certificate")
+
+	store.SetClientCerts(source.ClientCerts{RootCAs: certPool(bundle2.CAX509Cert)})
+	resp, err := client.Get(serverURL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	store.SetClientCerts(source.ClientCerts{InsecureSkipVerify: true})
+	resp, err = client.Get(serverURL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+}
+
+func TestStoreTLSClientConfigServerName(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	serverURL := startTLSServer(t, bundle)
+
+	store := source.NewClientCertsStore(slog.Default())
+	store.SetClientCerts(source.ClientCerts{RootCAs: certPool(bundle.CAX509Cert)})
+
+	tests := []struct {
+		name      string
+		opts      []tlsclient.TLSClientConfigOption
+		errorText string
+	}{
+		{
+			name:      "IP address without server name",
+			errorText: "server name is required",
+		},
+		{
+			name: "IP address server name",
+			opts: []tlsclient.TLSClientConfigOption{tlsclient.WithTLSClientServerName("127.0.0.1")},
+		},
+		{
+			name: "DNS server name",
+			opts: []tlsclient.TLSClientConfigOption{tlsclient.WithTLSClientServerName("localhost")},
+		},
+		{
+			name:      "invalid server name",
+			opts:      []tlsclient.TLSClientConfigOption{tlsclient.WithTLSClientServerName("example.com")},
+			errorText: "certificate is valid for localhost, not example.com",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &http.Client{
+				Transport: &http.Transport{TLSClientConfig: tlsclient.NewStoreTLSClientConfig(store, tc.opts...)},
+			}
+			resp, err := client.Get(serverURL)
+			if tc.errorText != "" {
+				require.ErrorContains(t, err, tc.errorText)
+				return
+			}
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+		})
+	}
+}
+
+func startTLSServer(t *testing.T, bundle *testutil.CertsBundle) string {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	ts.TLS = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*bundle.ServerTLSCert},
+	}
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
@@ -1,21 +1,72 @@
 package config
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"log/slog"
 
 	"github.com/grepplabs/cert-source/config"
 	tlsclient "github.com/grepplabs/cert-source/tls/client"
 	"github.com/grepplabs/cert-source/tls/client/filesource"
+	"github.com/grepplabs/cert-source/tls/client/source"
 )
 
-func GetTLSClientConfigFunc(logger *slog.Logger, conf *config.TLSClientConfig, opts ...tlsclient.TLSClientConfigOption) (tlsclient.TLSClientConfigFunc, error) {
+func GetTLSClientConfigFunc(ctx context.Context, logger *slog.Logger, conf *config.TLSClientConfig, opts ...tlsclient.TLSClientConfigOption) (tlsclient.TLSClientConfigFunc, error) {
 	if !conf.Enable {
 		return nil, nil
 	}
+	fs, err := newFileSource(logger, conf)
+	if err != nil {
+		return nil, err
+	}
+	return tlsclient.NewTLSClientConfigFunc(ctx, logger, fs, append(GetTLSClientConfigOptions(conf), opts...)...)
+}
+
+// GetTLSClientConfig provides a client TLS configuration which verifies the server against the current root CAs.
+// It can be cached by libraries and still follows the rotation of the certificates.
+func GetTLSClientConfig(ctx context.Context, logger *slog.Logger, conf *config.TLSClientConfig, opts ...tlsclient.TLSClientConfigOption) (*tls.Config, error) {
+	if !conf.Enable {
+		return nil, nil
+	}
+	fs, err := newFileSource(logger, conf)
+	if err != nil {
+		return nil, err
+	}
+	return tlsclient.NewTLSClientConfig(ctx, logger, fs, append(GetTLSClientConfigOptions(conf), opts...)...)
+}
+
+// GetTLSClientCertsStore provides a client certs store which can be bound to a tlsclient.RoundTripper.
+// The server identity is verified when the options of GetTLSClientConfigOptions are passed to the round tripper or dialer.
+func GetTLSClientCertsStore(ctx context.Context, logger *slog.Logger, conf *config.TLSClientConfig) (*source.ClientCertsStore, error) {
+	if !conf.Enable {
+		return nil, nil
+	}
+	fs, err := newFileSource(logger, conf)
+	if err != nil {
+		return nil, err
+	}
+	return tlsclient.NewTLSClientCertsStore(ctx, logger, fs)
+}
+
+// GetTLSClientConfigOptions provides the options verifying the configured server identity.
+func GetTLSClientConfigOptions(conf *config.TLSClientConfig) []tlsclient.TLSClientConfigOption {
+	identity := tlsclient.ServerIdentity{
+		SPIFFEIDs:  conf.Server.SPIFFEIDs,
+		SANs:       conf.Server.SANs,
+		SPKIHashes: conf.Server.SPKIHashes,
+	}
+	if identity.IsZero() {
+		return nil
+	}
+	return []tlsclient.TLSClientConfigOption{tlsclient.WithTLSClientServerIdentity(identity)}
+}
+
+func newFileSource(logger *slog.Logger, conf *config.TLSClientConfig) (source.ClientCertsSource, error) {
 	fs, err := filesource.New(
 		filesource.WithLogger(logger.With("tls", "client")),
 		filesource.WithRefresh(conf.Refresh),
+		filesource.WithFileWatch(conf.FileWatch),
 		filesource.WithInsecureSkipVerify(conf.InsecureSkipVerify),
 		filesource.WithClientCert(conf.File.Cert, conf.File.Key),
 		filesource.WithClientRootCAs(conf.File.RootCAs),
@@ -25,5 +76,5 @@ func GetTLSClientConfigFunc(logger *slog.Logger, conf *config.TLSClientConfig, o
 	if err != nil {
 		return nil, fmt.Errorf("setup client cert file source: %w", err)
 	}
-	return tlsclient.NewTLSClientConfigFunc(logger, fs, opts...)
+	return fs, nil
 }
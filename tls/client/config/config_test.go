@@ -1,6 +1,8 @@
 package config
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"log/slog"
 	"testing"
 
@@ -13,7 +15,7 @@ import (
 func TestGetClientTLSConfig(t *testing.T) {
 	bundle := testutil.NewCertsBundle()
 	defer bundle.Close()
-	tlsConfigFunc, err := GetTLSClientConfigFunc(slog.Default(), &config.TLSClientConfig{
+	tlsConfigFunc, err := GetTLSClientConfigFunc(t.Context(), slog.Default(), &config.TLSClientConfig{
 		Enable:  true,
 		Refresh: 0,
 		File: config.TLSClientFiles{
@@ -35,7 +37,7 @@ func TestGetClientTLSConfig(t *testing.T) {
 func TestGetClientTLSConfigNoConfig(t *testing.T) {
 	bundle := testutil.NewCertsBundle()
 	defer bundle.Close()
-	tlsConfigFunc, err := GetTLSClientConfigFunc(slog.Default(), &config.TLSClientConfig{
+	tlsConfigFunc, err := GetTLSClientConfigFunc(t.Context(), slog.Default(), &config.TLSClientConfig{
 		Enable:  true,
 		Refresh: 0,
 		File:    config.TLSClientFiles{},
@@ -43,13 +45,18 @@ func TestGetClientTLSConfigNoConfig(t *testing.T) {
 	require.NoError(t, err)
 	tlsConfig := tlsConfigFunc()
 	require.Nil(t, tlsConfig.RootCAs)
-	require.Nil(t, tlsConfig.GetClientCertificate)
+
+	// no client certificate is sent
+	clientCert, err := tlsConfig.GetClientCertificate(nil)
+	require.NoError(t, err)
+	require.NotNil(t, clientCert)
+	require.Empty(t, clientCert.Certificate)
 }
 
 func TestGetClientTLSConfigSkipVerify(t *testing.T) {
 	bundle := testutil.NewCertsBundle()
 	defer bundle.Close()
-	tlsConfigFunc, err := GetTLSClientConfigFunc(slog.Default(), &config.TLSClientConfig{
+	tlsConfigFunc, err := GetTLSClientConfigFunc(t.Context(), slog.Default(), &config.TLSClientConfig{
 		Enable:  true,
 		Refresh: 0,
 		File: config.TLSClientFiles{
@@ -65,3 +72,71 @@ func TestGetClientTLSConfigSkipVerify(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, clientCert)
 }
+
+func TestGetClientTLSConfigVerifyConnection(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+	tlsConfig, err := GetTLSClientConfig(t.Context(), slog.Default(), &config.TLSClientConfig{
+		Enable: true,
+		File: config.TLSClientFiles{
+			Key:     bundle.ClientKey.Name(),
+			Cert:    bundle.ClientCert.Name(),
+			RootCAs: bundle.CACert.Name(),
+		},
+	}, tlsclient.WithTLSClientNextProtos([]string{"h2"}))
+	require.NoError(t, err)
+	require.Nil(t, tlsConfig.RootCAs)
+	require.True(t, tlsConfig.InsecureSkipVerify)
+	require.NotNil(t, tlsConfig.VerifyConnection)
+	require.Equal(t, []string{"h2"}, tlsConfig.NextProtos)
+
+	clientCert, err := tlsConfig.GetClientCertificate(nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, clientCert.Certificate)
+
+	// server certificate is verified against the root CAs
+	err = tlsConfig.VerifyConnection(tls.ConnectionState{
+		ServerName:       "localhost",
+		PeerCertificates: []*x509.Certificate{bundle.ServerX509Cert},
+	})
+	require.NoError(t, err)
+	err = tlsConfig.VerifyConnection(tls.ConnectionState{
+		ServerName:       "localhost",
+		PeerCertificates: []*x509.Certificate{bundle.CAX509Cert},
+	})
+	require.Error(t, err)
+}
+
+func TestGetClientTLSConfigServerIdentity(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+	conf := &config.TLSClientConfig{
+		Enable: true,
+		File: config.TLSClientFiles{
+			RootCAs: bundle.CACert.Name(),
+		},
+		Server: config.TLSServerIdentity{
+			SANs: []string{"localhost"},
+		},
+	}
+	require.Len(t, GetTLSClientConfigOptions(conf), 1)
+	tlsConfig, err := GetTLSClientConfig(t.Context(), slog.Default(), conf)
+	require.NoError(t, err)
+
+	// the SANs are verified regardless of the server name
+	err = tlsConfig.VerifyConnection(tls.ConnectionState{
+		ServerName:       "example.com",
+		PeerCertificates: []*x509.Certificate{bundle.ServerX509Cert},
+	})
+	require.NoError(t, err)
+
+	conf.Server.SANs = []string{"example.com"}
+	tlsConfig, err = GetTLSClientConfig(t.Context(), slog.Default(), conf)
+	require.NoError(t, err)
+	err = tlsConfig.VerifyConnection(tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{bundle.ServerX509Cert},
+	})
+	require.ErrorContains(t, err, "does not have any of the SANs")
+
+	require.Empty(t, GetTLSClientConfigOptions(&config.TLSClientConfig{}))
+}
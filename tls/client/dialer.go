@@ -0,0 +1,147 @@
+package tlsclient
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/grepplabs/cert-source/internal/conntrack"
+	"github.com/grepplabs/cert-source/tls/client/source"
+)
+
+// DefaultHandshakeTimeout is the default maximum duration of a TLS handshake.
+const DefaultHandshakeTimeout = 10 * time.Second
+
+// Dialer establishes TLS connections using the current client certificate and root CAs of the store.
+type Dialer struct {
+	logger           *slog.Logger
+	netDialer        *net.Dialer
+	configFunc       TLSClientConfigFunc
+	tlsOpts          []TLSClientConfigOption
+	handshakeTimeout time.Duration
+	closeRotated     bool
+	gracePeriod      time.Duration
+	conns            conntrack.Conns
+	unregister       func()
+}
+
+type DialerOption func(*Dialer)
+
+func WithDialerLogger(logger *slog.Logger) DialerOption {
+	return func(d *Dialer) {
+		d.logger = logger
+	}
+}
+
+func WithDialerNetDialer(netDialer *net.Dialer) DialerOption {
+	return func(d *Dialer) {
+		d.netDialer = netDialer
+	}
+}
+
+func WithDialerTLSConfigOptions(opts ...TLSClientConfigOption) DialerOption {
+	return func(d *Dialer) {
+		d.tlsOpts = append(d.tlsOpts, opts...)
+	}
+}
+
+// WithDialerHandshakeTimeout sets the maximum duration of the TLS handshake. Zero disables the timeout.
+func WithDialerHandshakeTimeout(timeout time.Duration) DialerOption {
+	return func(d *Dialer) {
+		d.handshakeTimeout = timeout
+	}
+}
+
+// WithDialerCloseRotatedConns closes connections established with a client certificate which was rotated out.
+// The connections are closed with a TLS close notification after the grace period.
+func WithDialerCloseRotatedConns(gracePeriod time.Duration) DialerOption {
+	return func(d *Dialer) {
+		d.closeRotated = true
+		d.gracePeriod = gracePeriod
+	}
+}
+
+// NewDialer creates a dialer bound to the store. Close releases the store registration.
+func NewDialer(store *source.ClientCertsStore, opts ...DialerOption) *Dialer {
+	d := &Dialer{
+		logger:           slog.Default(),
+		netDialer:        &net.Dialer{},
+		handshakeTimeout: DefaultHandshakeTimeout,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	d.configFunc = NewStoreTLSClientConfigFunc(store, d.tlsOpts...)
+	if d.closeRotated {
+		d.unregister = store.OnRotation(d.onRotation)
+	}
+	return d
+}
+
+// Dial connects to the address on the named network and performs the TLS handshake.
+func (d *Dialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// DialContext connects to the address on the named network using the provided context and performs the TLS handshake.
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	config := d.configFunc()
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		config.ServerName = host
+	}
+	var leaf []byte
+	getClientCertificate := config.GetClientCertificate
+	config.GetClientCertificate = func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		cert, err := getClientCertificate(info)
+		if err == nil && cert != nil && len(cert.Certificate) != 0 {
+			leaf = cert.Certificate[0]
+		}
+		return cert, err
+	}
+
+	conn, err := d.netDialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if d.handshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.handshakeTimeout)
+		defer cancel()
+	}
+	tlsConn := tls.Client(conn, config)
+	if err = tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	// connections without client certificate are not affected by the rotation
+	if d.closeRotated && leaf != nil {
+		// closed connections are dropped when they are garbage collected
+		conntrack.AddWeak(&d.conns, tlsConn, leaf)
+	}
+	return tlsConn, nil
+}
+
+// Close unregisters the dialer from the store. Established connections are not closed.
+func (d *Dialer) Close() error {
+	if d.unregister != nil {
+		d.unregister()
+	}
+	return nil
+}
+
+func (d *Dialer) onRotation(_, current source.ClientCerts) {
+	var leaves [][]byte
+	if current.Certificate != nil && len(current.Certificate.Certificate) != 0 {
+		leaves = append(leaves, current.Certificate.Certificate[0])
+	}
+	if n := d.conns.CloseRotated(leaves, d.gracePeriod); n != 0 {
+		d.logger.Info(fmt.Sprintf("closing %d connections with rotated client certificate", n))
+	}
+}
@@ -0,0 +1,122 @@
+package tlsclient_test
+
+import (
+	"crypto/tls"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/cert-source/internal/testutil"
+	tlsclient "github.com/grepplabs/cert-source/tls/client"
+	"github.com/grepplabs/cert-source/tls/client/source"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialerCloseRotatedConns(t *testing.T) {
+	bundle1 := testutil.NewCertsBundle()
+	defer bundle1.Close()
+	bundle2 := testutil.NewCertsBundle()
+	defer bundle2.Close()
+
+	clientCAs := certPool(bundle1.CAX509Cert)
+	clientCAs.AddCert(bundle2.CAX509Cert)
+	addr := startEchoServer(t, &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*bundle1.ServerTLSCert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+
+	store := source.NewClientCertsStore(slog.Default())
+	store.SetClientCerts(source.ClientCerts{
+		RootCAs:     certPool(bundle1.CAX509Cert),
+		Certificate: bundle1.ClientTLSCert,
+		Checksum:    []byte("1"),
+	})
+	dialer := tlsclient.NewDialer(store, tlsclient.WithDialerCloseRotatedConns(0))
+	defer dialer.Close()
+
+	conn, err := dialer.DialContext(t.Context(), "tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	// http.Transport negotiates HTTP/2 only for a *tls.Conn
+	require.IsType(t, &tls.Conn{}, conn)
+	requireEcho(t, conn)
+
+	// unchanged client certificate keeps the connection
+	store.SetClientCerts(source.ClientCerts{
+		RootCAs:     certPool(bundle1.CAX509Cert),
+		Certificate: bundle1.ClientTLSCert,
+		Checksum:    []byte("2"),
+	})
+	requireEcho(t, conn)
+
+	store.SetClientCerts(source.ClientCerts{
+		RootCAs:     certPool(bundle1.CAX509Cert),
+		Certificate: bundle2.ClientTLSCert,
+		Checksum:    []byte("3"),
+	})
+	_, err = conn.Write([]byte("ping"))
+	require.Error(t, err)
+
+	conn2, err := dialer.DialContext(t.Context(), "tcp", addr)
+	require.NoError(t, err)
+	defer conn2.Close()
+	requireEcho(t, conn2)
+}
+
+func TestDialerHandshakeTimeout(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	// server never answers the handshake
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { _ = conn.Close() })
+		}
+	}()
+
+	store := source.NewClientCertsStore(slog.Default())
+	dialer := tlsclient.NewDialer(store, tlsclient.WithDialerHandshakeTimeout(100*time.Millisecond))
+
+	start := time.Now()
+	_, err = dialer.DialContext(t.Context(), "tcp", lis.Addr().String())
+	require.ErrorContains(t, err, "context deadline exceeded")
+	require.Less(t, time.Since(start), 2*time.Second)
+}
+
+func startEchoServer(t *testing.T, config *tls.Config) string {
+	t.Helper()
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = lis.Close() })
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return lis.Addr().String()
+}
+
+func requireEcho(t *testing.T, conn net.Conn) {
+	t.Helper()
+	_, err := conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(buf))
+}
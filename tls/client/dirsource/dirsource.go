@@ -0,0 +1,143 @@
+package dirsource
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/grepplabs/cert-source/internal/datadir"
+	tlscert "github.com/grepplabs/cert-source/tls/client/source"
+	"github.com/grepplabs/cert-source/tls/keyutil"
+	"github.com/grepplabs/cert-source/tls/watcher"
+)
+
+const (
+	DefaultCertFileName = "tls.crt"
+	DefaultKeyFileName  = "tls.key"
+	DefaultCAFileName   = "ca.crt"
+)
+
+// dirSource loads client certificates from a directory, e.g. a mounted Kubernetes TLS secret.
+// When the directory contains the ..data symlink, all files are read from the same generation.
+type dirSource struct {
+	dir                string
+	insecureSkipVerify bool
+	certFileName       string
+	keyFileName        string
+	keyPassword        string
+	rootCAsFileName    string
+	useSystemPool      bool
+	refresh            time.Duration
+	fileWatch          bool
+	fileWatchDebounce  time.Duration
+	logger             *slog.Logger
+	notifyFunc         func()
+	errorFunc          func(error)
+	backoff            watcher.Backoff
+	status             watcher.Status
+	lastClientCerts    atomic.Pointer[tlscert.ClientCerts]
+}
+
+func New(opts ...Option) (tlscert.ClientCertsSource, error) {
+	s := &dirSource{
+		certFileName: DefaultCertFileName,
+		keyFileName:  DefaultKeyFileName,
+		logger:       slog.Default(),
+		backoff:      watcher.DefaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	lastClientCerts, err := s.getClientCerts()
+	if err != nil {
+		return nil, err
+	}
+	s.lastClientCerts.Store(lastClientCerts)
+	s.status.RecordSuccess()
+	return s, nil
+}
+
+func MustNew(opts ...Option) tlscert.ClientCertsSource {
+	clientSource, err := New(opts...)
+	if err != nil {
+		panic(`dirsource: New(): ` + err.Error())
+	}
+	return clientSource
+}
+
+func (s *dirSource) getClientCerts() (*tlscert.ClientCerts, error) {
+	pemBlocks, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+	return tlscert.NewClientCerts(pemBlocks, s.insecureSkipVerify)
+}
+
+func (s *dirSource) refreshClientCerts() (*tlscert.ClientCerts, error) {
+	clientCerts, err := s.getClientCerts()
+	if err != nil {
+		return nil, err
+	}
+	s.lastClientCerts.Store(clientCerts)
+	return clientCerts, nil
+}
+
+func (s *dirSource) ClientCerts(ctx context.Context) chan tlscert.ClientCerts {
+	initialClientCert := s.lastClientCerts.Load()
+	ch := make(chan tlscert.ClientCerts, 1)
+	if initialClientCert != nil {
+		ch <- *initialClientCert
+	}
+	if s.refresh <= 0 && !s.fileWatch {
+		close(ch)
+	} else {
+		go func() {
+			watcher.WatchFilesEvents(ctx, s.logger, ch, s.refresh, s.watchedFiles(), s.fileWatchDebounce, initialClientCert, s.refreshClientCerts, s.notifyFunc, s.watchOptions()...)
+			close(ch)
+		}()
+	}
+	return ch
+}
+
+func (s *dirSource) Load() (*tlscert.ClientPEMs, error) {
+	if s.dir == "" {
+		return nil, errors.New("cert dir source: dir is required")
+	}
+	if (s.certFileName == "") != (s.keyFileName == "") {
+		return nil, errors.New("cert dir source: both certFileName and keyFileName must be set or be empty")
+	}
+	contents, err := datadir.ReadFiles(s.dir, s.certFileName, s.keyFileName, s.rootCAsFileName)
+	if err != nil {
+		return nil, err
+	}
+	pemBlocks := &tlscert.ClientPEMs{
+		CertPEMBlock:    contents[0],
+		KeyPEMBlock:     contents[1],
+		RootCAsPEMBlock: contents[2],
+		UseSystemPool:   s.useSystemPool,
+	}
+	if len(pemBlocks.KeyPEMBlock) != 0 {
+		if pemBlocks.KeyPEMBlock, err = keyutil.DecryptPrivateKeyPEM(pemBlocks.KeyPEMBlock, s.keyPassword); err != nil {
+			return nil, err
+		}
+	}
+	return pemBlocks, nil
+}
+
+func (s *dirSource) watchedFiles() []string {
+	if !s.fileWatch {
+		return nil
+	}
+	return datadir.Paths(s.dir, s.certFileName, s.keyFileName, s.rootCAsFileName)
+}
+
+// Status returns the status of the certificate loads.
+func (s *dirSource) Status() *watcher.Status {
+	return &s.status
+}
+
+func (s *dirSource) watchOptions() []watcher.Option {
+	return []watcher.Option{watcher.WithBackoff(s.backoff), watcher.WithErrorFunc(s.errorFunc), watcher.WithStatus(&s.status)}
+}
@@ -0,0 +1,107 @@
+package dirsource
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/cert-source/internal/testutil"
+	tlsclient "github.com/grepplabs/cert-source/tls/client"
+	servertls "github.com/grepplabs/cert-source/tls/server"
+	serverfilesource "github.com/grepplabs/cert-source/tls/server/filesource"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirSourceLoad(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	dir := t.TempDir()
+	require.NoError(t, bundle.WriteClientDataDir(dir))
+
+	_, err := New()
+	require.EqualError(t, err, "cert dir source: dir is required")
+
+	_, err = New(WithDir(dir), WithClientCertFileNames("tls.crt", ""))
+	require.EqualError(t, err, "cert dir source: both certFileName and keyFileName must be set or be empty")
+
+	src, err := New(WithDir(dir), WithClientCertFileNames("", ""), WithClientRootCAsFileName(DefaultCAFileName))
+	require.NoError(t, err)
+	certs := <-src.ClientCerts(t.Context())
+	require.Nil(t, certs.Certificate)
+	require.NotNil(t, certs.RootCAs)
+
+	src, err = New(WithDir(dir), WithClientRootCAsFileName(DefaultCAFileName))
+	require.NoError(t, err)
+	certs = <-src.ClientCerts(t.Context())
+	require.NotNil(t, certs.Certificate)
+	require.Equal(t, bundle.ClientX509Cert.SerialNumber, certs.Certificate.Leaf.SerialNumber)
+}
+
+func TestCertRotation(t *testing.T) {
+	bundle1 := testutil.NewCertsBundle()
+	defer bundle1.Close()
+
+	bundle2 := testutil.NewCertsBundle()
+	defer bundle2.Close()
+
+	dir := t.TempDir()
+	require.NoError(t, bundle1.WriteClientDataDir(dir))
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	rotatedCh := make(chan struct{}, 1)
+	notifyFunc := func() {
+		rotatedCh <- struct{}{}
+	}
+	clientSource := MustNew(
+		WithDir(dir),
+		WithClientRootCAsFileName(DefaultCAFileName),
+		WithRefresh(1*time.Second),
+		WithNotifyFunc(notifyFunc),
+	)
+	clientCertsStore, err := tlsclient.NewTLSClientCertsStore(t.Context(), slog.Default(), clientSource)
+	require.NoError(t, err)
+
+	serverSource := serverfilesource.MustNew(
+		serverfilesource.WithX509KeyPair(bundle1.ServerCert.Name(), bundle1.ServerKey.Name()),
+		serverfilesource.WithClientAuthFile(bundle1.CACert.Name()),
+	)
+	ts.TLS = servertls.MustNewServerConfig(t.Context(), slog.Default(), serverSource)
+	ts.StartTLS()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+	require.NoError(t, err)
+
+	client := &http.Client{
+		Transport: tlsclient.NewDefaultRoundTripper(tlsclient.WithClientCertsStore(clientCertsStore)),
+	}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// swap the ..data symlink to a new generation
+	require.NoError(t, bundle2.WriteClientDataDir(dir))
+
+	select {
+	case <-rotatedCh:
+		t.Log("certificates were changed")
+		time.Sleep(100 * time.Millisecond)
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected certificate change notification")
+	}
+	require.Equal(t, bundle2.ClientX509Cert.SerialNumber, clientCertsStore.LoadClientCerts().Certificate.Leaf.SerialNumber)
+
+	// new CA is not trusted by the server
+	client = &http.Client{
+		Transport: tlsclient.NewDefaultRoundTripper(tlsclient.WithClientCertsStore(clientCertsStore)),
+	}
+	// nolint:bodyclose
+	_, err = client.Do(req)
+	require.Error(t, err)
+}
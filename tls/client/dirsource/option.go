@@ -0,0 +1,94 @@
+package dirsource
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/grepplabs/cert-source/tls/watcher"
+)
+
+type Option func(*dirSource)
+
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *dirSource) {
+		c.logger = logger
+	}
+}
+
+func WithDir(dir string) Option {
+	return func(c *dirSource) {
+		c.dir = dir
+	}
+}
+
+// WithClientCertFileNames sets the client certificate and key file names. Empty names disable the client certificate.
+func WithClientCertFileNames(certFileName, keyFileName string) Option {
+	return func(c *dirSource) {
+		c.certFileName = certFileName
+		c.keyFileName = keyFileName
+	}
+}
+
+func WithKeyPassword(keyPassword string) Option {
+	return func(c *dirSource) {
+		c.keyPassword = keyPassword
+	}
+}
+
+func WithClientRootCAsFileName(rootCAsFileName string) Option {
+	return func(c *dirSource) {
+		c.rootCAsFileName = rootCAsFileName
+	}
+}
+
+func WithInsecureSkipVerify(insecureSkipVerify bool) Option {
+	return func(c *dirSource) {
+		c.insecureSkipVerify = insecureSkipVerify
+	}
+}
+
+func WithRefresh(refresh time.Duration) Option {
+	return func(c *dirSource) {
+		c.refresh = refresh
+	}
+}
+
+func WithNotifyFunc(notifyFunc func()) Option {
+	return func(c *dirSource) {
+		c.notifyFunc = notifyFunc
+	}
+}
+
+// WithErrorFunc sets the function called with every reload error.
+func WithErrorFunc(errorFunc func(error)) Option {
+	return func(c *dirSource) {
+		c.errorFunc = errorFunc
+	}
+}
+
+// WithBackoff sets the retries of failed reloads. The default is watcher.DefaultBackoff.
+func WithBackoff(backoff watcher.Backoff) Option {
+	return func(c *dirSource) {
+		c.backoff = backoff
+	}
+}
+
+func WithSystemPool(useSystemPool bool) Option {
+	return func(c *dirSource) {
+		c.useSystemPool = useSystemPool
+	}
+}
+
+// WithFileWatch enables reloading on file system events. The refresh interval is kept as a polling fallback.
+func WithFileWatch(fileWatch bool) Option {
+	return func(c *dirSource) {
+		c.fileWatch = fileWatch
+	}
+}
+
+// WithFileWatchDebounce sets the quiet period after the last file system event before the certificates are reloaded.
+func WithFileWatchDebounce(debounce time.Duration) Option {
+	return func(c *dirSource) {
+		c.fileWatchDebounce = debounce
+	}
+}
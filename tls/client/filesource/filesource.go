@@ -1,7 +1,9 @@
 package filesource
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"os"
 	"sync/atomic"
@@ -17,17 +19,26 @@ type fileSource struct {
 	certFile           string
 	keyFile            string
 	keyPassword        string
+	pkcs12File         string
+	pkcs12Password     string
+	pkcs12RootCAs      bool
 	rootCAsFile        string
 	useSystemPool      bool
 	refresh            time.Duration
+	fileWatch          bool
+	fileWatchDebounce  time.Duration
 	logger             *slog.Logger
 	notifyFunc         func()
+	errorFunc          func(error)
+	backoff            watcher.Backoff
+	status             watcher.Status
 	lastClientCerts    atomic.Pointer[tlscert.ClientCerts]
 }
 
 func New(opts ...Option) (tlscert.ClientCertsSource, error) {
 	s := &fileSource{
-		logger: slog.Default(),
+		logger:  slog.Default(),
+		backoff: watcher.DefaultBackoff,
 	}
 	for _, opt := range opts {
 		opt(s)
@@ -37,6 +48,7 @@ func New(opts ...Option) (tlscert.ClientCertsSource, error) {
 		return nil, err
 	}
 	s.lastClientCerts.Store(lastClientCerts)
+	s.status.RecordSuccess()
 	return s, nil
 }
 
@@ -53,20 +65,7 @@ func (s *fileSource) getClientCerts() (*tlscert.ClientCerts, error) {
 	if err != nil {
 		return nil, err
 	}
-	certificate, err := pemBlocks.Certificate()
-	if err != nil {
-		return nil, err
-	}
-	rootCAs, err := pemBlocks.RootCAs()
-	if err != nil {
-		return nil, err
-	}
-	return &tlscert.ClientCerts{
-		InsecureSkipVerify: s.insecureSkipVerify,
-		Certificate:        certificate,
-		RootCAs:            rootCAs,
-		Checksum:           pemBlocks.Checksum(),
-	}, nil
+	return tlscert.NewClientCerts(pemBlocks, s.insecureSkipVerify)
 }
 
 func (s *fileSource) refreshClientCerts() (*tlscert.ClientCerts, error) {
@@ -78,17 +77,17 @@ func (s *fileSource) refreshClientCerts() (*tlscert.ClientCerts, error) {
 	return clientCerts, nil
 }
 
-func (s *fileSource) ClientCerts() chan tlscert.ClientCerts {
+func (s *fileSource) ClientCerts(ctx context.Context) chan tlscert.ClientCerts {
 	initialClientCert := s.lastClientCerts.Load()
 	ch := make(chan tlscert.ClientCerts, 1)
 	if initialClientCert != nil {
 		ch <- *initialClientCert
 	}
-	if s.refresh <= 0 {
+	if s.refresh <= 0 && !s.fileWatch {
 		close(ch)
 	} else {
 		go func() {
-			watcher.Watch(s.logger, ch, s.refresh, initialClientCert, s.refreshClientCerts, s.notifyFunc)
+			watcher.WatchFilesEvents(ctx, s.logger, ch, s.refresh, s.watchedFiles(), s.fileWatchDebounce, initialClientCert, s.refreshClientCerts, s.notifyFunc, s.watchOptions()...)
 			close(ch)
 		}()
 	}
@@ -100,8 +99,18 @@ func (s *fileSource) Load() (*tlscert.ClientPEMs, error) {
 	if (s.certFile == "") != (s.keyFile == "") {
 		return nil, errors.New("cert file source: both certFile and keyFile must be set or be empty")
 	}
-	var err error
-	if s.certFile != "" && s.keyFile != "" {
+	if s.pkcs12File != "" && s.certFile != "" {
+		return nil, errors.New("cert file source: pkcs12File and certFile/keyFile are mutually exclusive")
+	}
+	var (
+		caPEMBlock []byte
+		err        error
+	)
+	if s.pkcs12File != "" {
+		if pemBlocks.CertPEMBlock, pemBlocks.KeyPEMBlock, caPEMBlock, err = s.readPKCS12File(); err != nil {
+			return nil, err
+		}
+	} else if s.certFile != "" && s.keyFile != "" {
 		if pemBlocks.CertPEMBlock, err = s.readFile(s.certFile); err != nil {
 			return nil, err
 		}
@@ -115,6 +124,9 @@ func (s *fileSource) Load() (*tlscert.ClientPEMs, error) {
 	if pemBlocks.RootCAsPEMBlock, err = s.readFile(s.rootCAsFile); err != nil {
 		return nil, err
 	}
+	if s.pkcs12RootCAs {
+		pemBlocks.RootCAsPEMBlock = append(pemBlocks.RootCAsPEMBlock, caPEMBlock...)
+	}
 	return pemBlocks, nil
 }
 
@@ -125,3 +137,34 @@ func (s *fileSource) readFile(name string) ([]byte, error) {
 	//nolint:gosec
 	return os.ReadFile(name)
 }
+
+func (s *fileSource) readPKCS12File() ([]byte, []byte, []byte, error) {
+	data, err := s.readFile(s.pkcs12File)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	certPEMBlock, keyPEMBlock, caPEMBlock, err := keyutil.PKCS12ToPEM(data, s.pkcs12Password)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("cert file source: decode %s: %w", s.pkcs12File, err)
+	}
+	return certPEMBlock, keyPEMBlock, caPEMBlock, nil
+}
+
+func (s *fileSource) watchedFiles() []string {
+	if !s.fileWatch {
+		return nil
+	}
+	if s.pkcs12File != "" {
+		return []string{s.pkcs12File, s.rootCAsFile}
+	}
+	return []string{s.certFile, s.keyFile, s.rootCAsFile}
+}
+
+// Status returns the status of the certificate loads.
+func (s *fileSource) Status() *watcher.Status {
+	return &s.status
+}
+
+func (s *fileSource) watchOptions() []watcher.Option {
+	return []watcher.Option{watcher.WithBackoff(s.backoff), watcher.WithErrorFunc(s.errorFunc), watcher.WithStatus(&s.status)}
+}
@@ -1,10 +1,12 @@
 package filesource
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -39,7 +41,7 @@ func TestCertRotation(t *testing.T) {
 		WithNotifyFunc(notifyFunc),
 	).(*fileSource)
 
-	clientCertsStore, err := tlsclient.NewTLSClientCertsStore(slog.Default(), clientSource)
+	clientCertsStore, err := tlsclient.NewTLSClientCertsStore(t.Context(), slog.Default(), clientSource)
 	require.NoError(t, err)
 
 	serverSource := serverfilesource.MustNew(
@@ -49,7 +51,7 @@ func TestCertRotation(t *testing.T) {
 		serverfilesource.WithRefresh(1*time.Second),
 		serverfilesource.WithNotifyFunc(notifyFunc),
 	)
-	ts.TLS = servertls.MustNewServerConfig(slog.Default(), serverSource)
+	ts.TLS = servertls.MustNewServerConfig(t.Context(), slog.Default(), serverSource)
 	ts.StartTLS()
 
 	req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
@@ -106,7 +108,7 @@ func TestKeyEncryption(t *testing.T) {
 		WithSystemPool(true),
 	).(*fileSource)
 
-	clientCertsStore, err := tlsclient.NewTLSClientCertsStore(slog.Default(), clientSource)
+	clientCertsStore, err := tlsclient.NewTLSClientCertsStore(t.Context(), slog.Default(), clientSource)
 	require.NoError(t, err)
 
 	serverSource := serverfilesource.MustNew(
@@ -116,7 +118,7 @@ func TestKeyEncryption(t *testing.T) {
 		serverfilesource.WithClientCRLFile(bundle.CAEmptyCRL.Name()),
 		serverfilesource.WithRefresh(1*time.Second),
 	)
-	ts.TLS = servertls.MustNewServerConfig(slog.Default(), serverSource)
+	ts.TLS = servertls.MustNewServerConfig(t.Context(), slog.Default(), serverSource)
 	ts.StartTLS()
 
 	req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
@@ -130,3 +132,104 @@ func TestKeyEncryption(t *testing.T) {
 	require.NoError(t, err)
 	defer resp.Body.Close()
 }
+
+func TestCertRotationFileWatch(t *testing.T) {
+	bundle1 := testutil.NewCertsBundle()
+	defer bundle1.Close()
+
+	bundle2 := testutil.NewCertsBundle()
+	defer bundle2.Close()
+
+	rotatedCh := make(chan struct{}, 1)
+	clientSource := MustNew(
+		WithClientRootCAs(bundle1.CACert.Name()),
+		WithClientCert(bundle1.ClientCert.Name(), bundle1.ClientKey.Name()),
+		WithFileWatch(true),
+		WithNotifyFunc(func() {
+			rotatedCh <- struct{}{}
+		}),
+	)
+	store, err := tlsclient.NewTLSClientCertsStore(t.Context(), slog.Default(), clientSource)
+	require.NoError(t, err)
+	require.Equal(t, bundle1.ClientX509Cert.SerialNumber, store.LoadClientCerts().Certificate.Leaf.SerialNumber)
+
+	require.NoError(t, os.Rename(bundle2.ClientCert.Name(), bundle1.ClientCert.Name()))
+	require.NoError(t, os.Rename(bundle2.ClientKey.Name(), bundle1.ClientKey.Name()))
+
+	select {
+	case <-rotatedCh:
+		t.Log("certificates were changed")
+		time.Sleep(100 * time.Millisecond)
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected certificate change notification")
+	}
+	require.Equal(t, bundle2.ClientX509Cert.SerialNumber, store.LoadClientCerts().Certificate.Leaf.SerialNumber)
+}
+
+func TestClientCertsContextCancel(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	source := MustNew(
+		WithClientRootCAs(bundle.CACert.Name()),
+		WithRefresh(1*time.Second),
+	)
+	ctx, cancel := context.WithCancel(t.Context())
+	ch := source.ClientCerts(ctx)
+
+	_, ok := <-ch
+	require.True(t, ok)
+
+	cancel()
+	select {
+	case _, ok = <-ch:
+		require.False(t, ok)
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected client certs channel to be closed")
+	}
+
+	_, err := tlsclient.NewTLSClientCertsStore(ctx, slog.Default(), source)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestPKCS12File(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	pkcs12File := filepath.Join(t.TempDir(), "client.p12")
+	require.NoError(t, testutil.WritePKCS12File(pkcs12File, bundle.ClientTLSCert, bundle.CAX509Cert, testutil.DefaultKeyPassword))
+
+	_, err := New(
+		WithPKCS12File(pkcs12File, testutil.DefaultKeyPassword),
+		WithClientCert(bundle.ClientCert.Name(), bundle.ClientKey.Name()),
+	)
+	require.ErrorContains(t, err, "mutually exclusive")
+
+	// the root CA is taken from the keystore
+	clientSource := MustNew(
+		WithPKCS12File(pkcs12File, testutil.DefaultKeyPassword),
+		WithPKCS12RootCAs(true),
+	)
+	clientCertsStore, err := tlsclient.NewTLSClientCertsStore(t.Context(), slog.Default(), clientSource)
+	require.NoError(t, err)
+	require.Equal(t, bundle.ClientX509Cert.SerialNumber, clientCertsStore.LoadClientCerts().Certificate.Leaf.SerialNumber)
+
+	serverSource := serverfilesource.MustNew(
+		serverfilesource.WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
+		serverfilesource.WithClientAuthFile(bundle.CACert.Name()),
+	)
+	ts.TLS = servertls.MustNewServerConfig(t.Context(), slog.Default(), serverSource)
+	ts.StartTLS()
+
+	client := &http.Client{
+		Transport: tlsclient.NewDefaultRoundTripper(tlsclient.WithClientCertsStore(clientCertsStore)),
+	}
+	resp, err := client.Get(ts.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+}
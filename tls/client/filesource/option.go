@@ -3,6 +3,8 @@ package filesource
 import (
 	"log/slog"
 	"time"
+
+	"github.com/grepplabs/cert-source/tls/watcher"
 )
 
 type Option func(*fileSource)
@@ -50,8 +52,52 @@ func WithNotifyFunc(notifyFunc func()) Option {
 	}
 }
 
+// WithErrorFunc sets the function called with every reload error.
+func WithErrorFunc(errorFunc func(error)) Option {
+	return func(c *fileSource) {
+		c.errorFunc = errorFunc
+	}
+}
+
+// WithBackoff sets the retries of failed reloads. The default is watcher.DefaultBackoff.
+func WithBackoff(backoff watcher.Backoff) Option {
+	return func(c *fileSource) {
+		c.backoff = backoff
+	}
+}
+
+// WithPKCS12File loads the client certificate, the chain and the private key from a PKCS#12 keystore instead of the PEM files.
+// It is mutually exclusive with WithClientCert.
+func WithPKCS12File(pkcs12File, password string) Option {
+	return func(c *fileSource) {
+		c.pkcs12File = pkcs12File
+		c.pkcs12Password = password
+	}
+}
+
+// WithPKCS12RootCAs adds the self-signed CA certificates of the PKCS#12 keystore to the root CAs.
+func WithPKCS12RootCAs(rootCAs bool) Option {
+	return func(c *fileSource) {
+		c.pkcs12RootCAs = rootCAs
+	}
+}
+
 func WithSystemPool(useSystemPool bool) Option {
 	return func(c *fileSource) {
 		c.useSystemPool = useSystemPool
 	}
 }
+
+// WithFileWatch enables reloading on file system events. The refresh interval is kept as a polling fallback.
+func WithFileWatch(fileWatch bool) Option {
+	return func(c *fileSource) {
+		c.fileWatch = fileWatch
+	}
+}
+
+// WithFileWatchDebounce sets the quiet period after the last file system event before the certificates are reloaded.
+func WithFileWatchDebounce(debounce time.Duration) Option {
+	return func(c *fileSource) {
+		c.fileWatchDebounce = debounce
+	}
+}
@@ -0,0 +1,119 @@
+package tlsclient
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// ServerIdentity verifies the server by its identity instead of the dial address.
+// All configured checks must pass. The checks use the server leaf certificate.
+type ServerIdentity struct {
+	// SPIFFEIDs are the accepted SPIFFE IDs, e.g. spiffe://example.org/ns/prod/sa/db.
+	SPIFFEIDs []string
+	// SANs are the accepted DNS names, IP addresses, URIs or email addresses. Wildcard DNS names of the certificate are honored.
+	SANs []string
+	// SPKIHashes are the pinned base64 encoded SHA-256 hashes of the subject public key info.
+	// The sha256/ and sha256// prefixes are accepted.
+	SPKIHashes []string
+}
+
+// IsZero reports whether no identity check is configured.
+func (s ServerIdentity) IsZero() bool {
+	return len(s.SPIFFEIDs) == 0 && len(s.SANs) == 0 && len(s.SPKIHashes) == 0
+}
+
+// Verify checks the identity of the server leaf certificate. The certificate chain is not verified.
+func (s ServerIdentity) Verify(leaf *x509.Certificate) error {
+	if len(s.SPIFFEIDs) != 0 && !slices.ContainsFunc(leaf.URIs, func(uri *url.URL) bool {
+		return uri.Scheme == "spiffe" && slices.Contains(s.SPIFFEIDs, uri.String())
+	}) {
+		return fmt.Errorf("tls: server certificate does not have any of the SPIFFE IDs %v", s.SPIFFEIDs)
+	}
+	if len(s.SANs) != 0 && !slices.ContainsFunc(s.SANs, func(san string) bool {
+		return hasSAN(leaf, san)
+	}) {
+		return fmt.Errorf("tls: server certificate does not have any of the SANs %v", s.SANs)
+	}
+	if len(s.SPKIHashes) != 0 {
+		sum := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+		hash := base64.StdEncoding.EncodeToString(sum[:])
+		if !slices.ContainsFunc(s.SPKIHashes, func(pin string) bool {
+			return strings.TrimPrefix(strings.TrimPrefix(pin, "sha256//"), "sha256/") == hash
+		}) {
+			return fmt.Errorf("tls: server public key sha256/%s is not pinned", hash)
+		}
+	}
+	return nil
+}
+
+func hasSAN(cert *x509.Certificate, san string) bool {
+	switch {
+	case strings.Contains(san, "://"):
+		return slices.ContainsFunc(cert.URIs, func(uri *url.URL) bool {
+			return uri.String() == san
+		})
+	case strings.Contains(san, "@"):
+		return slices.Contains(cert.EmailAddresses, san)
+	default:
+		// DNS names and IP addresses
+		return cert.VerifyHostname(san) == nil
+	}
+}
+
+// WithTLSClientServerIdentity verifies the server by its identity, which replaces the verification of the host name.
+// The certificate chain is still verified against the root CAs, unless the verification is skipped.
+// It is implemented with VerifyConnection, so it works when dialing by IP address.
+// The option must be applied after the root CAs are set. NewStoreTLSClientConfig, NewStoreTLSClientConfigFunc,
+// the Dialer and the RoundTripper bound to a store apply it on every connection with the current root CAs.
+func WithTLSClientServerIdentity(identity ServerIdentity) TLSClientConfigOption {
+	return func(c *tls.Config) {
+		if identity.IsZero() {
+			return
+		}
+		rootCAs := c.RootCAs
+		verifyChain := !c.InsecureSkipVerify
+		prevFunc := c.VerifyConnection
+		// nolint:gosec // G402: the server certificate is verified in VerifyConnection
+		c.InsecureSkipVerify = true
+		c.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("tls: server did not provide a certificate")
+			}
+			if verifyChain {
+				if err := verifyCertificateChain(rootCAs, state.PeerCertificates, ""); err != nil {
+					return err
+				}
+			}
+			if err := identity.Verify(state.PeerCertificates[0]); err != nil {
+				return err
+			}
+			if prevFunc != nil {
+				return prevFunc(state)
+			}
+			return nil
+		}
+	}
+}
+
+// verifyCertificateChain verifies the peer certificates against the root CAs. The host name is verified if it is not empty.
+func verifyCertificateChain(rootCAs *x509.CertPool, peerCertificates []*x509.Certificate, dnsName string) error {
+	opts := x509.VerifyOptions{
+		Roots:         rootCAs,
+		DNSName:       dnsName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range peerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if _, err := peerCertificates[0].Verify(opts); err != nil {
+		return fmt.Errorf("tls: failed to verify certificate: %w", err)
+	}
+	return nil
+}
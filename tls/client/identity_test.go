@@ -0,0 +1,176 @@
+package tlsclient_test
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/grepplabs/cert-source/internal/testutil"
+	tlsclient "github.com/grepplabs/cert-source/tls/client"
+	"github.com/grepplabs/cert-source/tls/client/source"
+	"github.com/stretchr/testify/require"
+)
+
+const serverID = "spiffe://example.org/ns/prod/sa/db"
+
+func TestServerIdentityVerify(t *testing.T) {
+	cert := &x509.Certificate{
+		DNSNames:                []string{"*.db.example.org"},
+		IPAddresses:             []net.IP{net.ParseIP("10.0.0.1")},
+		EmailAddresses:          []string{"db@example.org"},
+		URIs:                    []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/ns/prod/sa/db"}},
+		RawSubjectPublicKeyInfo: []byte("public key"),
+	}
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(sum[:])
+
+	tests := []struct {
+		name      string
+		identity  tlsclient.ServerIdentity
+		wantError bool
+	}{
+		{name: "spiffe ID", identity: tlsclient.ServerIdentity{SPIFFEIDs: []string{"spiffe://example.org/ns/prod/sa/web", serverID}}},
+		{name: "spiffe ID not matching", identity: tlsclient.ServerIdentity{SPIFFEIDs: []string{"spiffe://example.org/ns/prod/sa/web"}}, wantError: true},
+		{name: "wildcard DNS name", identity: tlsclient.ServerIdentity{SANs: []string{"primary.db.example.org"}}},
+		{name: "DNS name not matching", identity: tlsclient.ServerIdentity{SANs: []string{"db.example.org"}}, wantError: true},
+		{name: "IP address", identity: tlsclient.ServerIdentity{SANs: []string{"10.0.0.1"}}},
+		{name: "email", identity: tlsclient.ServerIdentity{SANs: []string{"db@example.org"}}},
+		{name: "URI", identity: tlsclient.ServerIdentity{SANs: []string{serverID}}},
+		{name: "SPKI hash", identity: tlsclient.ServerIdentity{SPKIHashes: []string{pin}}},
+		{name: "SPKI hash with prefix", identity: tlsclient.ServerIdentity{SPKIHashes: []string{"sha256//" + pin}}},
+		{name: "SPKI hash not matching", identity: tlsclient.ServerIdentity{SPKIHashes: []string{"sha256/AAAA"}}, wantError: true},
+		{name: "all checks must pass", identity: tlsclient.ServerIdentity{SPIFFEIDs: []string{serverID}, SPKIHashes: []string{"AAAA"}}, wantError: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.identity.Verify(cert)
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestStoreTLSClientConfigServerIdentity(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+	otherBundle := testutil.NewCertsBundle()
+	defer otherBundle.Close()
+
+	// the SVID has neither DNS names nor IP addresses
+	svid, leaf, err := testutil.GenerateSVID(bundle.CATLSCert, serverID)
+	require.NoError(t, err)
+	serverURL := startSVIDServer(t, svid)
+	sum := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(sum[:])
+
+	store := source.NewClientCertsStore(slog.Default())
+	store.SetClientCerts(source.ClientCerts{RootCAs: certPool(bundle.CAX509Cert)})
+
+	tests := []struct {
+		name      string
+		identity  tlsclient.ServerIdentity
+		certs     source.ClientCerts
+		errorText string
+	}{
+		{
+			name:     "spiffe ID",
+			identity: tlsclient.ServerIdentity{SPIFFEIDs: []string{serverID}},
+		},
+		{
+			name:      "wrong spiffe ID",
+			identity:  tlsclient.ServerIdentity{SPIFFEIDs: []string{"spiffe://example.org/ns/prod/sa/web"}},
+			errorText: "does not have any of the SPIFFE IDs",
+		},
+		{
+			name:     "SAN",
+			identity: tlsclient.ServerIdentity{SANs: []string{serverID}},
+		},
+		{
+			name:     "SPKI hash",
+			identity: tlsclient.ServerIdentity{SPKIHashes: []string{pin}},
+		},
+		{
+			name:      "untrusted root CA",
+			identity:  tlsclient.ServerIdentity{SPIFFEIDs: []string{serverID}},
+			certs:     source.ClientCerts{RootCAs: certPool(otherBundle.CAX509Cert)},
+			errorText: "tls: failed to verify certificate",
+		},
+		{
+			name:     "pinned certificate with skip verify",
+			identity: tlsclient.ServerIdentity{SPKIHashes: []string{pin}},
+			certs:    source.ClientCerts{InsecureSkipVerify: true},
+		},
+		{
+			name:      "SPKI hash is checked with skip verify",
+			identity:  tlsclient.ServerIdentity{SPKIHashes: []string{"AAAA"}},
+			certs:     source.ClientCerts{InsecureSkipVerify: true},
+			errorText: "is not pinned",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.certs.RootCAs != nil || tc.certs.InsecureSkipVerify {
+				store.SetClientCerts(tc.certs)
+				defer store.SetClientCerts(source.ClientCerts{RootCAs: certPool(bundle.CAX509Cert)})
+			}
+			opt := tlsclient.WithTLSClientServerIdentity(tc.identity)
+			clients := map[string]*http.Client{
+				"config": {Transport: &http.Transport{TLSClientConfig: tlsclient.NewStoreTLSClientConfig(store, opt)}},
+				"round tripper": {Transport: tlsclient.NewDefaultRoundTripper(
+					tlsclient.WithClientCertsStore(store),
+					tlsclient.WithClientTLSConfigOptions(opt),
+				)},
+			}
+			for name, client := range clients {
+				resp, err := client.Get(serverURL)
+				if tc.errorText != "" {
+					require.ErrorContains(t, err, tc.errorText, name)
+					continue
+				}
+				require.NoError(t, err, name)
+				_ = resp.Body.Close()
+			}
+		})
+	}
+}
+
+func TestRoundTripperServerIdentityWithoutStore(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	svid, _, err := testutil.GenerateSVID(bundle.CATLSCert, serverID)
+	require.NoError(t, err)
+	serverURL := startSVIDServer(t, svid)
+
+	client := &http.Client{Transport: tlsclient.NewDefaultRoundTripper(
+		tlsclient.WithRootCA(bundle.CAX509Cert),
+		tlsclient.WithClientTLSConfigOptions(tlsclient.WithTLSClientServerIdentity(tlsclient.ServerIdentity{SPIFFEIDs: []string{serverID}})),
+	)}
+	resp, err := client.Get(serverURL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+}
+
+func startSVIDServer(t *testing.T, cert *tls.Certificate) string {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	ts.TLS = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*cert},
+	}
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
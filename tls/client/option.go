@@ -9,3 +9,9 @@ func WithTLSClientNextProtos(nextProto []string) TLSClientConfigOption {
 		c.NextProtos = nextProto
 	}
 }
+
+func WithTLSClientServerName(serverName string) TLSClientConfigOption {
+	return func(c *tls.Config) {
+		c.ServerName = serverName
+	}
+}
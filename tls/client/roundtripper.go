@@ -1,15 +1,31 @@
 package tlsclient
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"io"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
 
 	"github.com/grepplabs/cert-source/tls/client/source"
 )
 
 type RoundTripper struct {
 	transport *http.Transport
+	store     *source.ClientCertsStore
+	tlsOpts   []TLSClientConfigOption
+
+	// verifyConnection is the VerifyConnection of the transport TLS config before the store was bound
+	verifyConnection    func(tls.ConnectionState) error
+	closeIdleOnRotation bool
+	maxConnectionAge    time.Duration
+	// connAges maps the *tls.Conn of the dialed connections to their *connAge
+	connAges   sync.Map
+	unregister func()
 }
 
 type RoundTripperOption func(*RoundTripper)
@@ -20,18 +36,38 @@ func WithClientTLSConfig(tlsClientConfig *tls.Config) RoundTripperOption {
 	}
 }
 
-func WithClientCertsStore(source *source.ClientCertsStore) RoundTripperOption {
+// WithClientCertsStore binds the round tripper to the store.
+// Every new TLS connection uses the current client certificate and root CAs of the store,
+// which take precedence over the root CAs and skip verify options.
+// HTTPS requests through a proxy use the TLS config of the transport, which verifies the server against
+// the current root CAs of the store as NewStoreTLSClientConfig does.
+func WithClientCertsStore(store *source.ClientCertsStore) RoundTripperOption {
 	return func(rt *RoundTripper) {
-		cs := source.LoadClientCerts()
-		if rt.transport.TLSClientConfig == nil {
-			// nolint:gosec
-			rt.transport.TLSClientConfig = &tls.Config{}
-		}
-		rt.transport.TLSClientConfig.RootCAs = cs.RootCAs
-		rt.transport.TLSClientConfig.InsecureSkipVerify = cs.InsecureSkipVerify
-		rt.transport.TLSClientConfig.GetClientCertificate = func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
-			return source.LoadClientCerts().Certificate, nil
-		}
+		rt.store = store
+	}
+}
+
+// WithClientTLSConfigOptions applies the options to the TLS config of the transport.
+// With a bound store, they are applied on every new TLS connection after the current root CAs are set.
+func WithClientTLSConfigOptions(opts ...TLSClientConfigOption) RoundTripperOption {
+	return func(rt *RoundTripper) {
+		rt.tlsOpts = append(rt.tlsOpts, opts...)
+	}
+}
+
+// WithCloseIdleConnectionsOnRotation closes idle connections when the certificates of the bound store are rotated.
+func WithCloseIdleConnectionsOnRotation(enable bool) RoundTripperOption {
+	return func(rt *RoundTripper) {
+		rt.closeIdleOnRotation = enable
+	}
+}
+
+// WithMaxConnectionAge limits the age of the connections established with the bound store.
+// A connection which reaches the age is closed as soon as none of its requests is in flight,
+// i.e. when the response bodies are read or closed. This applies to HTTP/2 connections as well.
+func WithMaxConnectionAge(maxAge time.Duration) RoundTripperOption {
+	return func(rt *RoundTripper) {
+		rt.maxConnectionAge = maxAge
 	}
 }
 
@@ -99,6 +135,26 @@ func NewRoundTripper(transport *http.Transport, options ...RoundTripperOption) *
 	for _, option := range options {
 		option(rt)
 	}
+	if rt.store == nil && len(rt.tlsOpts) != 0 {
+		if transport.TLSClientConfig == nil {
+			// nolint:gosec
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		for _, opt := range rt.tlsOpts {
+			opt(transport.TLSClientConfig)
+		}
+	}
+	if rt.store != nil {
+		if transport.TLSClientConfig != nil {
+			rt.verifyConnection = transport.TLSClientConfig.VerifyConnection
+		}
+		// the transport performs the handshake of proxied connections itself with its TLS config
+		transport.TLSClientConfig = newStoreTLSClientConfig(rt.store, transport.TLSClientConfig, rt.tlsOpts...)
+		transport.DialTLSContext = rt.dialTLSContext
+		if rt.closeIdleOnRotation {
+			rt.unregister = rt.store.RegisterTransport(rt)
+		}
+	}
 	return rt
 }
 
@@ -109,5 +165,192 @@ func NewDefaultRoundTripper(options ...RoundTripperOption) *RoundTripper {
 }
 
 func (p *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	return p.transport.RoundTrip(req)
+	if p.maxConnectionAge <= 0 || p.store == nil {
+		return p.transport.RoundTrip(req)
+	}
+	// the request keeps the connection open until the response is consumed
+	var age *connAge
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if age != nil {
+				// the request is retried on another connection
+				age.release()
+				age = nil
+			}
+			if v, ok := p.connAges.Load(info.Conn); ok {
+				if age, _ = v.(*connAge); age != nil {
+					age.acquire()
+				}
+			}
+		},
+	}
+	resp, err := p.transport.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if age == nil {
+		return resp, err
+	}
+	if err != nil {
+		age.release()
+		return nil, err
+	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: sync.OnceFunc(age.release)}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the transport.
+func (p *RoundTripper) CloseIdleConnections() {
+	p.transport.CloseIdleConnections()
+}
+
+// Close unregisters the round tripper from the store and closes the idle connections.
+func (p *RoundTripper) Close() {
+	if p.unregister != nil {
+		p.unregister()
+	}
+	p.transport.CloseIdleConnections()
+}
+
+func (p *RoundTripper) dialTLSContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dial := p.transport.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	conn, err := dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	config, err := p.tlsConfig(addr)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if timeout := p.transport.TLSHandshakeTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	var age *connAge
+	if p.maxConnectionAge > 0 {
+		// the raw connection is wrapped, as the transport negotiates HTTP/2 only for a *tls.Conn
+		age = &connAge{Conn: conn}
+		conn = age
+	}
+	tlsConn := tls.Client(conn, config)
+	if err = tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if age != nil {
+		p.connAges.Store(tlsConn, age)
+		age.onClose = func() { p.connAges.Delete(tlsConn) }
+		age.start(p.maxConnectionAge)
+	}
+	return tlsConn, nil
+}
+
+// tlsConfig returns the transport TLS config updated with the current certificates of the store.
+func (p *RoundTripper) tlsConfig(addr string) (*tls.Config, error) {
+	var config *tls.Config
+	if p.transport.TLSClientConfig != nil {
+		config = p.transport.TLSClientConfig.Clone()
+	} else {
+		// nolint:gosec
+		config = &tls.Config{}
+	}
+	cs := p.store.LoadClientCerts()
+	config.RootCAs = cs.RootCAs
+	config.InsecureSkipVerify = cs.InsecureSkipVerify
+	config.VerifyConnection = p.verifyConnection
+	config.GetClientCertificate = getClientCertificate(p.store)
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		config.ServerName = host
+	}
+	for _, opt := range p.tlsOpts {
+		opt(config)
+	}
+	return config, nil
+}
+
+// connAge closes the connection after the max age, once no request is in flight.
+type connAge struct {
+	net.Conn
+	onClose func()
+
+	mu       sync.Mutex
+	timer    *time.Timer
+	inFlight int
+	expired  bool
+	closed   bool
+}
+
+func (c *connAge) start(maxAge time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.timer = time.AfterFunc(maxAge, c.expire)
+	}
+}
+
+func (c *connAge) expire() {
+	c.mu.Lock()
+	c.expired = true
+	idle := c.inFlight == 0
+	c.mu.Unlock()
+	if idle {
+		_ = c.Close()
+	}
+}
+
+func (c *connAge) acquire() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight++
+}
+
+func (c *connAge) release() {
+	c.mu.Lock()
+	c.inFlight--
+	idle := c.expired && c.inFlight == 0
+	c.mu.Unlock()
+	if idle {
+		_ = c.Close()
+	}
+}
+
+func (c *connAge) Close() error {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+		if c.onClose != nil {
+			c.onClose()
+		}
+	}
+	c.mu.Unlock()
+	return c.Conn.Close()
+}
+
+// releaseBody releases the connection when the response body is consumed or closed.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.release()
+	}
+	return n, err
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
 }
@@ -0,0 +1,282 @@
+package tlsclient_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/cert-source/internal/testutil"
+	tlsclient "github.com/grepplabs/cert-source/tls/client"
+	"github.com/grepplabs/cert-source/tls/client/source"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTripperRootCAsRotation(t *testing.T) {
+	bundle1 := testutil.NewCertsBundle()
+	defer bundle1.Close()
+	bundle2 := testutil.NewCertsBundle()
+	defer bundle2.Close()
+
+	serverURL := startTLSServer(t, bundle2)
+
+	store := source.NewClientCertsStore(slog.Default())
+	store.SetClientCerts(source.ClientCerts{RootCAs: certPool(bundle1.CAX509Cert)})
+	client := &http.Client{Transport: tlsclient.NewDefaultRoundTripper(tlsclient.WithClientCertsStore(store))}
+
+	// nolint:bodyclose
+	_, err := client.Get(serverURL)
+	require.Error(t, err)
+
+	store.SetClientCerts(source.ClientCerts{RootCAs: certPool(bundle2.CAX509Cert)})
+	resp, err := client.Get(serverURL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+}
+
+func TestRoundTripperClientCertAfterStartup(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	for _, clientAuth := range []tls.ClientAuthType{tls.RequireAndVerifyClientCert, tls.VerifyClientCertIfGiven} {
+		t.Run(clientAuth.String(), func(t *testing.T) {
+			ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Peer-Certificates", strconv.Itoa(len(r.TLS.PeerCertificates)))
+				w.WriteHeader(http.StatusOK)
+			}))
+			ts.TLS = &tls.Config{
+				MinVersion:   tls.VersionTLS13,
+				Certificates: []tls.Certificate{*bundle.ServerTLSCert},
+				ClientCAs:    certPool(bundle.CAX509Cert),
+				ClientAuth:   clientAuth,
+			}
+			ts.StartTLS()
+			defer ts.Close()
+
+			store := source.NewClientCertsStore(slog.Default())
+			store.SetClientCerts(source.ClientCerts{RootCAs: certPool(bundle.CAX509Cert)})
+			// every request uses a new connection
+			client := &http.Client{
+				Transport: tlsclient.NewRoundTripper(&http.Transport{DisableKeepAlives: true}, tlsclient.WithClientCertsStore(store)),
+			}
+
+			// no client certificate is sent
+			resp, err := client.Get(ts.URL)
+			if clientAuth == tls.RequireAndVerifyClientCert {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				_ = resp.Body.Close()
+				require.Equal(t, "0", resp.Header.Get("X-Peer-Certificates"))
+			}
+
+			store.SetClientCerts(source.ClientCerts{
+				RootCAs:     certPool(bundle.CAX509Cert),
+				Certificate: bundle.ClientTLSCert,
+			})
+			resp, err = client.Get(ts.URL)
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+			require.Equal(t, "1", resp.Header.Get("X-Peer-Certificates"))
+		})
+	}
+}
+
+func TestRoundTripperCloseIdleConnectionsOnRotation(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	serverURL, connections := startCountingServer(t, bundle)
+
+	store := source.NewClientCertsStore(slog.Default())
+	store.SetClientCerts(source.ClientCerts{RootCAs: certPool(bundle.CAX509Cert), Checksum: []byte("1")})
+	transport := tlsclient.NewDefaultRoundTripper(tlsclient.WithClientCertsStore(store), tlsclient.WithCloseIdleConnectionsOnRotation(true))
+	defer transport.Close()
+	client := &http.Client{Transport: transport}
+
+	get := func() {
+		resp, err := client.Get(serverURL)
+		require.NoError(t, err)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+	get()
+	get()
+	require.Equal(t, int32(1), connections.Load())
+
+	// unchanged certificates keep the connection
+	store.SetClientCerts(source.ClientCerts{RootCAs: certPool(bundle.CAX509Cert), Checksum: []byte("1")})
+	get()
+	require.Equal(t, int32(1), connections.Load())
+
+	store.SetClientCerts(source.ClientCerts{RootCAs: certPool(bundle.CAX509Cert), Checksum: []byte("2")})
+	get()
+	require.Equal(t, int32(2), connections.Load())
+}
+
+func TestRoundTripperProxy(t *testing.T) {
+	bundle1 := testutil.NewCertsBundle()
+	defer bundle1.Close()
+	bundle2 := testutil.NewCertsBundle()
+	defer bundle2.Close()
+
+	serverURL, err := url.Parse(startTLSServer(t, bundle2))
+	require.NoError(t, err)
+	serverURL.Host = net.JoinHostPort("localhost", serverURL.Port())
+
+	var tunnels atomic.Int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		tunnels.Add(1)
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		go func() { _, _ = io.Copy(upstream, conn) }()
+		_, _ = io.Copy(conn, upstream)
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+
+	store := source.NewClientCertsStore(slog.Default())
+	store.SetClientCerts(source.ClientCerts{RootCAs: certPool(bundle1.CAX509Cert)})
+	client := &http.Client{
+		Transport: tlsclient.NewRoundTripper(&http.Transport{Proxy: http.ProxyURL(proxyURL)}, tlsclient.WithClientCertsStore(store)),
+	}
+
+	// the handshake through the tunnel uses the current root CAs of the store
+	// nolint:bodyclose
+	_, err = client.Get(serverURL.String())
+	require.ErrorContains(t, err, "certificate signed by unknown authority")
+
+	store.SetClientCerts(source.ClientCerts{RootCAs: certPool(bundle2.CAX509Cert)})
+	resp, err := client.Get(serverURL.String())
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, int32(2), tunnels.Load())
+}
+
+func TestRoundTripperMaxConnectionAge(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	serverURL, connections := startCountingServer(t, bundle)
+
+	store := source.NewClientCertsStore(slog.Default())
+	store.SetClientCerts(source.ClientCerts{RootCAs: certPool(bundle.CAX509Cert)})
+	client := &http.Client{
+		Transport: tlsclient.NewDefaultRoundTripper(tlsclient.WithClientCertsStore(store), tlsclient.WithMaxConnectionAge(200*time.Millisecond)),
+	}
+	get := func() {
+		resp, err := client.Get(serverURL)
+		require.NoError(t, err)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+	get()
+	get()
+	require.Equal(t, int32(1), connections.Load())
+
+	time.Sleep(400 * time.Millisecond)
+	get()
+	require.Equal(t, int32(2), connections.Load())
+}
+
+func TestRoundTripperMaxConnectionAgeBusyConnection(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	for _, http2 := range []bool{false, true} {
+		t.Run("http2="+strconv.FormatBool(http2), func(t *testing.T) {
+			var opened, closed atomic.Int32
+			ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// the connection reaches the max age while the request is in flight
+				time.Sleep(300 * time.Millisecond)
+				w.WriteHeader(http.StatusOK)
+			}))
+			ts.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				switch state {
+				case http.StateNew:
+					opened.Add(1)
+				case http.StateClosed:
+					closed.Add(1)
+				default:
+				}
+			}
+			ts.EnableHTTP2 = http2
+			ts.TLS = &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*bundle.ServerTLSCert},
+			}
+			ts.StartTLS()
+			defer ts.Close()
+
+			store := source.NewClientCertsStore(slog.Default())
+			store.SetClientCerts(source.ClientCerts{RootCAs: certPool(bundle.CAX509Cert)})
+			client := &http.Client{
+				Transport: tlsclient.NewDefaultRoundTripper(tlsclient.WithClientCertsStore(store), tlsclient.WithMaxConnectionAge(100*time.Millisecond)),
+			}
+			resp, err := client.Get(ts.URL)
+			require.NoError(t, err)
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+			if http2 {
+				require.Equal(t, 2, resp.ProtoMajor)
+			} else {
+				require.Equal(t, 1, resp.ProtoMajor)
+			}
+
+			// the expired connection is closed when the request completes, without waiting for the next one
+			require.Eventually(t, func() bool {
+				return closed.Load() == 1
+			}, 2*time.Second, 10*time.Millisecond)
+			require.Equal(t, int32(1), opened.Load())
+		})
+	}
+}
+
+func startCountingServer(t *testing.T, bundle *testutil.CertsBundle) (string, *atomic.Int32) {
+	t.Helper()
+	var connections atomic.Int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	ts.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	ts.TLS = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*bundle.ServerTLSCert},
+	}
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts.URL, &connections
+}
+
+func certPool(cert *x509.Certificate) *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return pool
+}
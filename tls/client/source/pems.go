@@ -18,6 +18,24 @@ type ClientPEMs struct {
 	UseSystemPool   bool
 }
 
+// NewClientCerts parses the PEM blocks and builds client certificates.
+func NewClientCerts(pemBlocks *ClientPEMs, insecureSkipVerify bool) (*ClientCerts, error) {
+	certificate, err := pemBlocks.Certificate()
+	if err != nil {
+		return nil, err
+	}
+	rootCAs, err := pemBlocks.RootCAs()
+	if err != nil {
+		return nil, err
+	}
+	return &ClientCerts{
+		InsecureSkipVerify: insecureSkipVerify,
+		Certificate:        certificate,
+		RootCAs:            rootCAs,
+		Checksum:           pemBlocks.Checksum(),
+	}, nil
+}
+
 func (s ClientPEMs) Checksum() []byte {
 	hash := sha256.New()
 	hash.Write(s.CertPEMBlock)
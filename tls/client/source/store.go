@@ -2,15 +2,24 @@ package source
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
 	"log/slog"
+	"sync"
 	"sync/atomic"
+
+	"github.com/grepplabs/cert-source/internal/subscription"
 )
 
+// ClientCertsSource provides client certificates.
+//
+// ClientCerts returns a channel which first delivers the initial certificates and then every rotated generation.
+// The channel is closed by the source when ctx is done or when the source does not watch for changes.
+// After ctx is done, the source stops its background work and sends no further values.
 type ClientCertsSource interface {
-	ClientCerts() chan ClientCerts
+	ClientCerts(ctx context.Context) chan ClientCerts
 }
 
 type ClientCerts struct {
@@ -24,9 +33,18 @@ func (s ClientCerts) GetChecksum() []byte {
 	return s.Checksum
 }
 
+// IdleConnectionsCloser is implemented by transports which can close their idle connections, e.g. *http.Transport.
+type IdleConnectionsCloser interface {
+	CloseIdleConnections()
+}
+
 type ClientCertsStore struct {
 	cs     atomic.Pointer[ClientCerts]
 	logger *slog.Logger
+
+	mu     sync.Mutex
+	hooks  map[int]func(old, current ClientCerts)
+	nextID int
 }
 
 func NewClientCertsStore(logger *slog.Logger) *ClientCertsStore {
@@ -42,8 +60,66 @@ func (s *ClientCertsStore) LoadClientCerts() ClientCerts {
 }
 
 func (s *ClientCertsStore) SetClientCerts(certs ClientCerts) {
-	s.cs.Store(&certs)
+	old := s.cs.Swap(&certs)
 	s.logger.Info(fmt.Sprintf("stored x509 client root certs, client cert [%s]", name(certs.Certificate)))
+	if old.Checksum != nil && !bytes.Equal(old.Checksum, certs.Checksum) {
+		s.mu.Lock()
+		hooks := make([]func(old, current ClientCerts), 0, len(s.hooks))
+		for _, hook := range s.hooks {
+			hooks = append(hooks, hook)
+		}
+		s.mu.Unlock()
+		for _, hook := range hooks {
+			hook(*old, certs)
+		}
+	}
+}
+
+// ClientCertsRotation is a rotation of the stored certificates.
+type ClientCertsRotation struct {
+	Old     ClientCerts
+	Current ClientCerts
+}
+
+// Subscribe returns a channel which receives every rotation of the stored certificates in order.
+// The rotations are queued, so a slow subscriber does not block the store or other subscribers.
+// The subscription ends and the channel is closed when ctx is done.
+func (s *ClientCertsStore) Subscribe(ctx context.Context) <-chan ClientCertsRotation {
+	ch, publish := subscription.New[ClientCertsRotation](ctx)
+	unregister := s.OnRotation(func(old, current ClientCerts) {
+		publish(ClientCertsRotation{Old: old, Current: current})
+	})
+	context.AfterFunc(ctx, unregister)
+	return ch
+}
+
+// OnRotation registers a function which is called with the previous and the current certificates
+// when the stored certificates change. The function is called synchronously and should not block.
+// The returned function unregisters it.
+func (s *ClientCertsStore) OnRotation(fn func(old, current ClientCerts)) (unregister func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hooks == nil {
+		s.hooks = make(map[int]func(old, current ClientCerts))
+	}
+	id := s.nextID
+	s.nextID++
+	s.hooks[id] = fn
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.hooks, id)
+	}
+}
+
+// RegisterTransport registers a transport whose idle connections are closed when the certificates are rotated,
+// so that new connections are established with the current certificates.
+// The returned function unregisters the transport.
+func (s *ClientCertsStore) RegisterTransport(transport IdleConnectionsCloser) (unregister func()) {
+	return s.OnRotation(func(_, _ ClientCerts) {
+		s.logger.Info("client certs rotated, closing idle connections")
+		transport.CloseIdleConnections()
+	})
 }
 
 func name(cert *tls.Certificate) string {
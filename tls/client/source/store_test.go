@@ -0,0 +1,55 @@
+package source
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCertsStoreSubscribe(t *testing.T) {
+	store := NewClientCertsStore(slog.Default())
+	store.SetClientCerts(ClientCerts{Checksum: []byte("v1")})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	first := store.Subscribe(ctx)
+	second := store.Subscribe(t.Context())
+
+	// a subscriber which does not receive does not block the store
+	store.SetClientCerts(ClientCerts{Checksum: []byte("v2")})
+	store.SetClientCerts(ClientCerts{Checksum: []byte("v2")})
+	store.SetClientCerts(ClientCerts{Checksum: []byte("v3")})
+
+	for _, ch := range []<-chan ClientCertsRotation{first, second} {
+		rotation := receiveClientCertsRotation(t, ch)
+		require.Equal(t, []byte("v1"), rotation.Old.Checksum)
+		require.Equal(t, []byte("v2"), rotation.Current.Checksum)
+		rotation = receiveClientCertsRotation(t, ch)
+		require.Equal(t, []byte("v2"), rotation.Old.Checksum)
+		require.Equal(t, []byte("v3"), rotation.Current.Checksum)
+	}
+
+	cancel()
+	store.SetClientCerts(ClientCerts{Checksum: []byte("v4")})
+	select {
+	case _, ok := <-first:
+		require.False(t, ok)
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected channel to be closed")
+	}
+	require.Equal(t, []byte("v4"), receiveClientCertsRotation(t, second).Current.Checksum)
+}
+
+func receiveClientCertsRotation(t *testing.T, ch <-chan ClientCertsRotation) ClientCertsRotation {
+	t.Helper()
+	select {
+	case rotation, ok := <-ch:
+		require.True(t, ok)
+		return rotation
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected rotation")
+	}
+	return ClientCertsRotation{}
+}
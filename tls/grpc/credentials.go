@@ -0,0 +1,24 @@
+package tlsgrpc
+
+import (
+	"log/slog"
+
+	tlsclient "github.com/grepplabs/cert-source/tls/client"
+	clientsource "github.com/grepplabs/cert-source/tls/client/source"
+	tlsserver "github.com/grepplabs/cert-source/tls/server"
+	serversource "github.com/grepplabs/cert-source/tls/server/source"
+	"google.golang.org/grpc/credentials"
+)
+
+// NewServerCredentials provides gRPC server transport credentials using the current certificates of the store on every handshake.
+// Client certificates are required and verified when the store has client CAs.
+func NewServerCredentials(logger *slog.Logger, store *serversource.ServerCertsStore, opts ...tlsserver.TLSServerConfigOption) credentials.TransportCredentials {
+	return credentials.NewTLS(tlsserver.NewStoreServerConfig(logger, store, opts...))
+}
+
+// NewClientCredentials provides gRPC client transport credentials using the current client certificate and root CAs
+// of the store on every handshake. The server is verified against the host name of the target authority;
+// for IP address targets, set the server name with WithTLSClientServerName or use WithTLSClientServerIdentity.
+func NewClientCredentials(store *clientsource.ClientCertsStore, opts ...tlsclient.TLSClientConfigOption) credentials.TransportCredentials {
+	return credentials.NewTLS(tlsclient.NewStoreTLSClientConfig(store, opts...))
+}
@@ -0,0 +1,111 @@
+package tlsgrpc
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"testing"
+
+	"github.com/grepplabs/cert-source/internal/testutil"
+	tlsclient "github.com/grepplabs/cert-source/tls/client"
+	clientfilesource "github.com/grepplabs/cert-source/tls/client/filesource"
+	clientsource "github.com/grepplabs/cert-source/tls/client/source"
+	tlsserver "github.com/grepplabs/cert-source/tls/server"
+	serverfilesource "github.com/grepplabs/cert-source/tls/server/filesource"
+	serversource "github.com/grepplabs/cert-source/tls/server/source"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestCredentials(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	lis := startServer(t, newServerStore(t, bundle, bundle.CAEmptyCRL.Name()))
+
+	// client certificate and root CAs
+	require.NoError(t, checkHealth(t, lis, newClientStore(t, bundle, true)))
+	// client certificate is required
+	require.Error(t, checkHealth(t, lis, newClientStore(t, bundle, false)))
+}
+
+func TestCredentialsRevokedClient(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	lis := startServer(t, newServerStore(t, bundle, bundle.ClientCRL.Name()))
+	require.Error(t, checkHealth(t, lis, newClientStore(t, bundle, true)))
+}
+
+func TestCredentialsRotation(t *testing.T) {
+	bundle1 := testutil.NewCertsBundle()
+	defer bundle1.Close()
+	bundle2 := testutil.NewCertsBundle()
+	defer bundle2.Close()
+
+	serverStore := newServerStore(t, bundle1, bundle1.CAEmptyCRL.Name())
+	lis := startServer(t, serverStore)
+
+	clientStore := newClientStore(t, bundle1, true)
+	require.NoError(t, checkHealth(t, lis, clientStore))
+
+	// server certificates are rotated, the client still trusts the old CA
+	serverStore.SetServerCerts(newServerStore(t, bundle2, bundle2.CAEmptyCRL.Name()).LoadServerCerts())
+	require.Error(t, checkHealth(t, lis, clientStore))
+
+	// client certificates are rotated
+	clientStore.SetClientCerts(newClientStore(t, bundle2, true).LoadClientCerts())
+	require.NoError(t, checkHealth(t, lis, clientStore))
+}
+
+func newServerStore(t *testing.T, bundle *testutil.CertsBundle, clientCRL string) *serversource.ServerCertsStore {
+	t.Helper()
+	store, err := tlsserver.NewServerCertsStore(t.Context(), slog.Default(), serverfilesource.MustNew(
+		serverfilesource.WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
+		serverfilesource.WithClientAuthFile(bundle.CACert.Name()),
+		serverfilesource.WithClientCRLFile(clientCRL),
+	))
+	require.NoError(t, err)
+	return store
+}
+
+func newClientStore(t *testing.T, bundle *testutil.CertsBundle, withClientCert bool) *clientsource.ClientCertsStore {
+	t.Helper()
+	opts := []clientfilesource.Option{clientfilesource.WithClientRootCAs(bundle.CACert.Name())}
+	if withClientCert {
+		opts = append(opts, clientfilesource.WithClientCert(bundle.ClientCert.Name(), bundle.ClientKey.Name()))
+	}
+	store, err := tlsclient.NewTLSClientCertsStore(t.Context(), slog.Default(), clientfilesource.MustNew(opts...))
+	require.NoError(t, err)
+	return store
+}
+
+func startServer(t *testing.T, store *serversource.ServerCertsStore) *bufconn.Listener {
+	t.Helper()
+	lis := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(grpc.Creds(NewServerCredentials(slog.Default(), store)))
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() {
+		_ = server.Serve(lis)
+	}()
+	t.Cleanup(server.Stop)
+	return lis
+}
+
+func checkHealth(t *testing.T, lis *bufconn.Listener, store *clientsource.ClientCertsStore) error {
+	t.Helper()
+	conn, err := grpc.NewClient("passthrough:///localhost",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(NewClientCredentials(store)),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = healthpb.NewHealthClient(conn).Check(t.Context(), &healthpb.HealthCheckRequest{})
+	return err
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/youmark/pkcs8"
 )
 
+// DecryptPrivateKeyPEM decrypts a legacy encrypted PEM block or a PKCS#8 ENCRYPTED PRIVATE KEY.
+// Unencrypted keys are returned unchanged.
 func DecryptPrivateKeyPEM(pemData []byte, password string) ([]byte, error) {
 	keyBlock, _ := pem.Decode(pemData)
 	if keyBlock == nil {
@@ -24,7 +26,7 @@ func DecryptPrivateKeyPEM(pemData []byte, password string) ([]byte, error) {
 			return nil, err
 		}
 		block := &pem.Block{
-			Type:  "RSA PRIVATE KEY",
+			Type:  keyBlock.Type,
 			Bytes: key,
 		}
 		return pem.EncodeToMemory(block), nil
@@ -42,7 +44,7 @@ func DecryptPrivateKeyPEM(pemData []byte, password string) ([]byte, error) {
 	return pemData, nil
 }
 
-// nolint:cyclop
+// EncryptPKCS8PrivateKeyPEM encrypts an RSA, ECDSA, Ed25519 or X25519 private key as PKCS#8 ENCRYPTED PRIVATE KEY.
 func EncryptPKCS8PrivateKeyPEM(pemData []byte, password string) ([]byte, error) {
 	if password == "" {
 		return nil, errors.New("password cannot be empty")
@@ -52,33 +54,9 @@ func EncryptPKCS8PrivateKeyPEM(pemData []byte, password string) ([]byte, error)
 		return nil, errors.New("failed to parse PEM")
 	}
 
-	var (
-		key any
-		err error
-	)
-	switch keyBlock.Type {
-	case "PRIVATE KEY":
-		key, err = x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
-		if err != nil {
-			return nil, err
-		}
-	case "RSA PRIVATE KEY":
-		rsaKey, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
-		if err != nil {
-			return nil, err
-		}
-		key, err = x509.MarshalPKCS8PrivateKey(rsaKey)
-		if err != nil {
-			return nil, err
-		}
-		// Parse back to interface{} to match the signature for pkcs8.MarshalPrivateKey
-		// nolint:forcetypeassert
-		key, err = x509.ParsePKCS8PrivateKey(key.([]byte))
-		if err != nil {
-			return nil, err
-		}
-	default:
-		return nil, errors.New("unsupported key type: " + keyBlock.Type)
+	key, err := parsePrivateKeyBlock(keyBlock)
+	if err != nil {
+		return nil, err
 	}
 
 	encryptedBytes, err := pkcs8.MarshalPrivateKey(key, []byte(password), pkcs8.DefaultOpts)
@@ -203,18 +203,22 @@ jOlh0aHv8csftxxnjI8lwu/BjMRdTWY8YeiXHVYzdfNDRvAPYuuZMQ==
 }
 
 func TestEncryptPKCS8PrivateKeyPEM(t *testing.T) {
-	privKey, privPem, _, _, err := GenerateRSAKeys()
-	require.NoError(t, err)
-
 	password := "test123"
-	encryptedKey, err := EncryptPKCS8PrivateKeyPEM(privPem, password)
-	require.NoError(t, err)
-	decryptedKey, err := DecryptPrivateKeyPEM(encryptedKey, password)
-	require.NoError(t, err)
-	decryptedPrivKey, err := ParsePrivateKeyPEM(decryptedKey)
-	require.NoError(t, err)
+	for name, privKey := range generatePrivateKeys(t) {
+		t.Run(name, func(t *testing.T) {
+			privPem, err := MarshalPrivateKeyToPEM(privKey)
+			require.NoError(t, err)
+
+			encryptedKey, err := EncryptPKCS8PrivateKeyPEM(privPem, password)
+			require.NoError(t, err)
+			decryptedKey, err := DecryptPrivateKeyPEM(encryptedKey, password)
+			require.NoError(t, err)
+			decryptedPrivKey, err := ParsePrivateKeyPEM(decryptedKey)
+			require.NoError(t, err)
 
-	assert.Equal(t, privKey, decryptedPrivKey)
+			assert.Equal(t, privKey, decryptedPrivKey)
+		})
+	}
 }
 
 func TestDecryptOpenSSLPrivateKeyPEM(t *testing.T) {
@@ -3,7 +3,9 @@ package keyutil
 import (
 	"bytes"
 	"crypto"
+	"crypto/ecdh"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	cryptorand "crypto/rand"
 	"crypto/rsa"
@@ -104,6 +106,14 @@ func GenerateRSAKeys() (crypto.PrivateKey, []byte, crypto.PublicKey, []byte, err
 	return marshalKeysToPEM(privateKey, privateKey.Public())
 }
 
+func GenerateEd25519Keys() (crypto.PrivateKey, []byte, crypto.PublicKey, []byte, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(cryptorand.Reader)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return marshalKeysToPEM(privateKey, publicKey)
+}
+
 func KeysMatch(priv crypto.PrivateKey, pub crypto.PublicKey) bool {
 	privKey, ok := priv.(interface {
 		Public() crypto.PublicKey
@@ -139,23 +149,24 @@ func ParsePrivateKeyPEM(keyData []byte) (crypto.PrivateKey, error) {
 		if privateKeyPemBlock == nil {
 			break
 		}
-
-		switch privateKeyPemBlock.Type {
-		case ECPrivateKeyBlockType:
-			if key, err := x509.ParseECPrivateKey(privateKeyPemBlock.Bytes); err == nil {
-				return key, nil
-			}
-		case RSAPrivateKeyBlockType:
-			if key, err := x509.ParsePKCS1PrivateKey(privateKeyPemBlock.Bytes); err == nil {
-				return key, nil
-			}
-		case PrivateKeyBlockType:
-			if key, err := x509.ParsePKCS8PrivateKey(privateKeyPemBlock.Bytes); err == nil {
-				return key, nil
-			}
+		if key, err := parsePrivateKeyBlock(privateKeyPemBlock); err == nil {
+			return key, nil
 		}
 	}
-	return nil, errors.New("data does not contain a valid RSA or ECDSA private key")
+	return nil, errors.New("data does not contain a valid RSA, ECDSA, Ed25519 or X25519 private key")
+}
+
+func parsePrivateKeyBlock(block *pem.Block) (crypto.PrivateKey, error) {
+	switch block.Type {
+	case ECPrivateKeyBlockType:
+		return x509.ParseECPrivateKey(block.Bytes)
+	case RSAPrivateKeyBlockType:
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case PrivateKeyBlockType:
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, errors.New("unsupported key type: " + block.Type)
+	}
 }
 
 func ParsePublicKeysPEM(keyData []byte) ([]crypto.PublicKey, error) {
@@ -182,17 +193,42 @@ func ParsePublicKeysPEM(keyData []byte) ([]crypto.PublicKey, error) {
 			keys = append(keys, publicKey)
 			continue
 		}
+		if publicKey, err := parseOKPPublicKey(block.Bytes); err == nil {
+			keys = append(keys, publicKey)
+			continue
+		}
 	}
 
 	if len(keys) == 0 {
-		return nil, errors.New("data does not contain any valid RSA or ECDSA public keys")
+		return nil, errors.New("data does not contain any valid RSA, ECDSA, Ed25519 or X25519 public keys")
 	}
 	return keys, nil
 }
 
-func MarshalPrivateKeyToPEM(privateKey crypto.PrivateKey) ([]byte, error) {
+type marshalOptions struct {
+	pkcs8 bool
+}
+
+type MarshalOption func(*marshalOptions)
+
+// WithPKCS8 marshals private keys of any type as PKCS#8 PRIVATE KEY.
+// Ed25519 and X25519 keys are always marshaled as PKCS#8.
+func WithPKCS8(pkcs8 bool) MarshalOption {
+	return func(o *marshalOptions) {
+		o.pkcs8 = pkcs8
+	}
+}
+
+func MarshalPrivateKeyToPEM(privateKey crypto.PrivateKey, opts ...MarshalOption) ([]byte, error) {
+	var o marshalOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
 	switch t := privateKey.(type) {
 	case *ecdsa.PrivateKey:
+		if o.pkcs8 {
+			return marshalPKCS8PrivateKeyToPEM(t)
+		}
 		derBytes, err := x509.MarshalECPrivateKey(t)
 		if err != nil {
 			return nil, err
@@ -203,16 +239,34 @@ func MarshalPrivateKeyToPEM(privateKey crypto.PrivateKey) ([]byte, error) {
 		}
 		return pem.EncodeToMemory(block), nil
 	case *rsa.PrivateKey:
+		if o.pkcs8 {
+			return marshalPKCS8PrivateKeyToPEM(t)
+		}
 		block := &pem.Block{
 			Type:  RSAPrivateKeyBlockType,
 			Bytes: x509.MarshalPKCS1PrivateKey(t),
 		}
 		return pem.EncodeToMemory(block), nil
+	case ed25519.PrivateKey, *ecdh.PrivateKey:
+		return marshalPKCS8PrivateKeyToPEM(t)
 	default:
 		return nil, fmt.Errorf("private key is not a recognized type: %T", privateKey)
 	}
 }
 
+func marshalPKCS8PrivateKeyToPEM(privateKey crypto.PrivateKey) ([]byte, error) {
+	derBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(
+		&pem.Block{
+			Type:  PrivateKeyBlockType,
+			Bytes: derBytes,
+		},
+	), nil
+}
+
 func MarshalPublicKeyToPEM(publicKey crypto.PublicKey) ([]byte, error) {
 	switch t := publicKey.(type) {
 	case *ecdsa.PublicKey:
@@ -226,7 +280,7 @@ func MarshalPublicKeyToPEM(publicKey crypto.PublicKey) ([]byte, error) {
 				Bytes: derBytes,
 			},
 		), nil
-	case *rsa.PublicKey:
+	case *rsa.PublicKey, ed25519.PublicKey, *ecdh.PublicKey:
 		derBytes, err := x509.MarshalPKIXPublicKey(t)
 		if err != nil {
 			return nil, err
@@ -238,7 +292,7 @@ func MarshalPublicKeyToPEM(publicKey crypto.PublicKey) ([]byte, error) {
 			},
 		), nil
 	default:
-		return nil, fmt.Errorf("private key is not a recognized type: %T", publicKey)
+		return nil, fmt.Errorf("public key is not a recognized type: %T", publicKey)
 	}
 }
 
@@ -354,7 +408,9 @@ func parseECPrivateKey(data []byte) (*ecdsa.PrivateKey, error) {
 
 	var parsedKey any
 	if parsedKey, err = x509.ParseECPrivateKey(data); err != nil {
-		return nil, err
+		if parsedKey, err = x509.ParsePKCS8PrivateKey(data); err != nil {
+			return nil, err
+		}
 	}
 
 	var privKey *ecdsa.PrivateKey
@@ -365,3 +421,29 @@ func parseECPrivateKey(data []byte) (*ecdsa.PrivateKey, error) {
 
 	return privKey, nil
 }
+
+// parseOKPPublicKey parses Ed25519 and X25519 public keys from a public key, a certificate or a PKCS#8 private key.
+func parseOKPPublicKey(data []byte) (crypto.PublicKey, error) {
+	var parsedKey any
+	if publicKey, err := x509.ParsePKIXPublicKey(data); err == nil {
+		parsedKey = publicKey
+	} else if cert, err := x509.ParseCertificate(data); err == nil {
+		parsedKey = cert.PublicKey
+	} else if privateKey, err := x509.ParsePKCS8PrivateKey(data); err == nil {
+		if signer, ok := privateKey.(interface{ Public() crypto.PublicKey }); ok {
+			parsedKey = signer.Public()
+		}
+	} else {
+		return nil, err
+	}
+
+	switch publicKey := parsedKey.(type) {
+	case ed25519.PublicKey:
+		return publicKey, nil
+	case *ecdh.PublicKey:
+		if publicKey.Curve() == ecdh.X25519() {
+			return publicKey, nil
+		}
+	}
+	return nil, errors.New("data doesn't contain valid Ed25519 or X25519 Public Key")
+}
@@ -3,6 +3,13 @@ package keyutil
 import (
 	"bytes"
 	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
 	"io"
 	"os"
 	"testing"
@@ -23,6 +30,10 @@ func TestGenerateKeys(t *testing.T) {
 			name:        "generate EC keys",
 			genKeysFunc: GenerateECKeys,
 		},
+		{
+			name:        "generate Ed25519 keys",
+			genKeysFunc: GenerateEd25519Keys,
+		},
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
@@ -71,6 +82,10 @@ func TestReadKeys(t *testing.T) {
 			name:        "generate and read EC keys",
 			genKeysFunc: GenerateECKeys,
 		},
+		{
+			name:        "generate and read Ed25519 keys",
+			genKeysFunc: GenerateEd25519Keys,
+		},
 	}
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
@@ -107,3 +122,61 @@ func TestReadKeys(t *testing.T) {
 		})
 	}
 }
+
+func generatePrivateKeys(t *testing.T) map[string]crypto.PrivateKey {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	x25519Key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return map[string]crypto.PrivateKey{
+		"RSA":     rsaKey,
+		"EC":      ecKey,
+		"Ed25519": ed25519Key,
+		"X25519":  x25519Key,
+	}
+}
+
+func TestMarshalKeysRoundTrip(t *testing.T) {
+	defaultBlockTypes := map[string]string{
+		"RSA":     RSAPrivateKeyBlockType,
+		"EC":      ECPrivateKeyBlockType,
+		"Ed25519": PrivateKeyBlockType,
+		"X25519":  PrivateKeyBlockType,
+	}
+	for name, privateKey := range generatePrivateKeys(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, pkcs8 := range []bool{false, true} {
+				privPem, err := MarshalPrivateKeyToPEM(privateKey, WithPKCS8(pkcs8))
+				require.NoError(t, err)
+				block, _ := pem.Decode(privPem)
+				require.NotNil(t, block)
+				if pkcs8 {
+					require.Equal(t, PrivateKeyBlockType, block.Type)
+				} else {
+					require.Equal(t, defaultBlockTypes[name], block.Type)
+				}
+				parsedKey, err := ParsePrivateKeyPEM(privPem)
+				require.NoError(t, err)
+				require.Equal(t, privateKey, parsedKey)
+
+				publicKeys, err := ParsePublicKeysPEM(privPem)
+				require.NoError(t, err)
+				require.Len(t, publicKeys, 1)
+				require.True(t, KeysMatch(privateKey, publicKeys[0]))
+			}
+
+			publicKey := privateKey.(interface{ Public() crypto.PublicKey }).Public()
+			pubPem, err := MarshalPublicKeyToPEM(publicKey)
+			require.NoError(t, err)
+			publicKeys, err := ParsePublicKeysPEM(pubPem)
+			require.NoError(t, err)
+			require.Len(t, publicKeys, 1)
+			require.True(t, KeysMatch(privateKey, publicKeys[0]))
+		})
+	}
+}
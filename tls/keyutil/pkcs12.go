@@ -0,0 +1,69 @@
+package keyutil
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// DecodePKCS12 decodes a PKCS#12 keystore with a private key, the leaf certificate and the CA certificates.
+// The first certificate of the keystore is the leaf certificate.
+func DecodePKCS12(data []byte, password string) (crypto.PrivateKey, *x509.Certificate, []*x509.Certificate, error) {
+	privateKey, cert, caCerts, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return privateKey, cert, caCerts, nil
+}
+
+// DecodePKCS12TrustStore decodes a PKCS#12 trust store, which contains certificates only.
+func DecodePKCS12TrustStore(data []byte, password string) ([]*x509.Certificate, error) {
+	return pkcs12.DecodeTrustStore(data, password)
+}
+
+// EncodePKCS12 encodes a PKCS#12 keystore with AES-256 and PBKDF2, which is supported by OpenSSL 1.1.1 and Java 12 or later.
+func EncodePKCS12(privateKey crypto.PrivateKey, cert *x509.Certificate, caCerts []*x509.Certificate, password string) ([]byte, error) {
+	return pkcs12.Modern.Encode(privateKey, cert, caCerts, password)
+}
+
+// EncodePKCS12TrustStore encodes a PKCS#12 trust store with the certificates.
+func EncodePKCS12TrustStore(certs []*x509.Certificate, password string) ([]byte, error) {
+	return pkcs12.Modern.EncodeTrustStore(certs, password)
+}
+
+// PKCS12ToPEM converts a PKCS#12 keystore to PEM blocks. The certificate block contains the leaf and the intermediate certificates,
+// the key block the PKCS#8 private key and the CA block the self-signed CA certificates of the keystore.
+func PKCS12ToPEM(data []byte, password string) (certPEMBlock, keyPEMBlock, caPEMBlock []byte, err error) {
+	privateKey, cert, caCerts, err := DecodePKCS12(data, password)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !KeysMatch(privateKey, cert.PublicKey) {
+		return nil, nil, nil, errors.New("pkcs12: private key does not match the leaf certificate")
+	}
+	keyPEMBlock, err = MarshalPrivateKeyToPEM(privateKey, WithPKCS8(true))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	certPEMBlock = encodeCertPEM(cert)
+	for _, caCert := range caCerts {
+		if isSelfSigned(caCert) {
+			caPEMBlock = append(caPEMBlock, encodeCertPEM(caCert)...)
+		} else {
+			certPEMBlock = append(certPEMBlock, encodeCertPEM(caCert)...)
+		}
+	}
+	return certPEMBlock, keyPEMBlock, caPEMBlock, nil
+}
+
+func encodeCertPEM(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: CertificateBlockType, Bytes: cert.Raw})
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer) && cert.CheckSignatureFrom(cert) == nil
+}
@@ -0,0 +1,516 @@
+package acmesource
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grepplabs/cert-source/tls/keyutil"
+	tlsserver "github.com/grepplabs/cert-source/tls/server"
+	"github.com/grepplabs/cert-source/tls/server/source"
+	"github.com/grepplabs/cert-source/tls/watcher"
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	ChallengeHTTP01    = "http-01"
+	ChallengeTLSALPN01 = "tls-alpn-01"
+)
+
+const (
+	defaultRenewBefore   = 30 * 24 * time.Hour
+	defaultCheckInterval = 5 * time.Minute
+	defaultTimeout       = 5 * time.Minute
+	// failed orders are not retried too quickly because of the rate limits of the ACME CAs
+	defaultBackoffInitial = time.Minute
+
+	accountKeyFile   = "acme_account.key"
+	httpChallengeDir = "/.well-known/acme-challenge/"
+)
+
+// Source provides server certificates obtained from an ACME certificate authority, e.g. Let's Encrypt.
+// The HTTP-01 challenges are answered by HTTPHandler and the TLS-ALPN-01 challenges by the TLS configuration option TLSServerConfigOption.
+type Source interface {
+	source.ServerCertsSource
+	// HTTPHandler serves the HTTP-01 challenge responses and passes other requests to fallback.
+	// If fallback is nil, other requests are answered with 404.
+	HTTPHandler(fallback http.Handler) http.Handler
+	// TLSServerConfigOption serves the TLS-ALPN-01 challenge certificates.
+	// It must be passed to tlsserver.NewServerConfig after options setting NextProtos.
+	TLSServerConfigOption() tlsserver.TLSServerConfigOption
+	watcher.StatusProvider
+}
+
+type acmeSource struct {
+	directoryURL   string
+	email          string
+	domains        []string
+	cacheDir       string
+	challengeTypes []string
+	renewBefore    time.Duration
+	checkInterval  time.Duration
+	timeout        time.Duration
+	httpClient     *http.Client
+	logger         *slog.Logger
+	notifyFunc     func()
+	errorFunc      func(error)
+	backoff        watcher.Backoff
+	status         watcher.Status
+
+	client *acme.Client
+
+	// obtainMu serializes the orders, mu guards the current certificate
+	obtainMu   sync.Mutex
+	registered bool
+	mu         sync.Mutex
+	current    *obtained
+
+	challengeMu sync.RWMutex
+	tlsALPN     map[string]*tls.Certificate
+	http01      map[string]string
+}
+
+// obtained is a certificate obtained from the ACME CA.
+type obtained struct {
+	certPEMBlock []byte
+	keyPEMBlock  []byte
+	notAfter     time.Time
+	renewAt      time.Time
+}
+
+func New(opts ...Option) (Source, error) {
+	s := &acmeSource{
+		directoryURL:   acme.LetsEncryptURL,
+		challengeTypes: []string{ChallengeTLSALPN01, ChallengeHTTP01},
+		renewBefore:    defaultRenewBefore,
+		checkInterval:  defaultCheckInterval,
+		timeout:        defaultTimeout,
+		backoff:        watcher.Backoff{Initial: defaultBackoffInitial, Multiplier: 2, Jitter: 0.2},
+		httpClient:     http.DefaultClient,
+		logger:         slog.Default(),
+		tlsALPN:        make(map[string]*tls.Certificate),
+		http01:         make(map[string]string),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if len(s.domains) == 0 {
+		return nil, errors.New("acme source: domains are required")
+	}
+	if len(s.challengeTypes) == 0 {
+		return nil, errors.New("acme source: challenge types are required")
+	}
+	for _, challengeType := range s.challengeTypes {
+		if challengeType != ChallengeHTTP01 && challengeType != ChallengeTLSALPN01 {
+			return nil, fmt.Errorf("acme source: unsupported challenge type: %q", challengeType)
+		}
+	}
+	if s.renewBefore <= 0 {
+		return nil, fmt.Errorf("acme source: renew before must be positive: %v", s.renewBefore)
+	}
+	accountKey, err := s.loadAccountKey()
+	if err != nil {
+		return nil, err
+	}
+	s.client = &acme.Client{
+		Key:          accountKey,
+		DirectoryURL: s.directoryURL,
+		HTTPClient:   s.httpClient,
+		UserAgent:    "cert-source",
+	}
+	cached, err := s.loadCachedCert()
+	if err != nil {
+		s.logger.Warn("cannot load cached acme certificate", slog.String("error", err.Error()))
+	}
+	s.current = cached
+	return s, nil
+}
+
+func MustNew(opts ...Option) Source {
+	source, err := New(opts...)
+	if err != nil {
+		panic(`acmesource: New(): ` + err.Error())
+	}
+	return source
+}
+
+// ServerCerts sends the cached certificate or, if there is none, empty server certificates at once,
+// as the server must be running to answer the challenges. The certificate is obtained and renewed in the background.
+func (s *acmeSource) ServerCerts(ctx context.Context) chan source.ServerCerts {
+	ch := make(chan source.ServerCerts, 1)
+
+	init := &source.ServerCerts{}
+	if current := s.loadCurrent(); current != nil {
+		if certs, err := newServerCerts(current); err == nil {
+			init = certs
+		}
+	}
+	ch <- *init
+
+	go func() {
+		defer close(ch)
+		watcher.Watch(ctx, s.logger, ch, s.checkInterval, init, func() (*source.ServerCerts, error) {
+			cert, err := s.load(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return newServerCerts(cert)
+		}, s.notifyFunc, watcher.WithBackoff(s.backoff), watcher.WithErrorFunc(s.errorFunc), watcher.WithStatus(&s.status))
+	}()
+	return ch
+}
+
+// Status returns the status of the certificate loads. The cached certificate is not counted as a load.
+func (s *acmeSource) Status() *watcher.Status {
+	return &s.status
+}
+
+func (s *acmeSource) HTTPHandler(fallback http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, httpChallengeDir) {
+			if fallback == nil {
+				http.NotFound(w, r)
+				return
+			}
+			fallback.ServeHTTP(w, r)
+			return
+		}
+		s.challengeMu.RLock()
+		response, ok := s.http01[r.URL.Path]
+		s.challengeMu.RUnlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(response))
+	})
+}
+
+func (s *acmeSource) TLSServerConfigOption() tlsserver.TLSServerConfigOption {
+	return func(c *tls.Config) {
+		if !slices.Contains(c.NextProtos, acme.ALPNProto) {
+			c.NextProtos = append(slices.Clone(c.NextProtos), acme.ALPNProto)
+		}
+		getCertificate := c.GetCertificate
+		c.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if slices.Contains(hello.SupportedProtos, acme.ALPNProto) {
+				s.challengeMu.RLock()
+				cert, ok := s.tlsALPN[hello.ServerName]
+				s.challengeMu.RUnlock()
+				if !ok {
+					return nil, fmt.Errorf("acme source: no tls-alpn-01 challenge for %q", hello.ServerName)
+				}
+				return cert, nil
+			}
+			if getCertificate != nil {
+				return getCertificate(hello)
+			}
+			// use the configured certificates
+			return nil, nil
+		}
+	}
+}
+
+// load returns the current certificate and obtains a new one when the renewal time is reached.
+// The current certificate can be read while a new one is obtained.
+func (s *acmeSource) load(ctx context.Context) (*obtained, error) {
+	if current := s.loadCurrent(); current != nil && time.Now().Before(current.renewAt) {
+		return current, nil
+	}
+	s.obtainMu.Lock()
+	defer s.obtainMu.Unlock()
+	// the certificate could have been obtained while waiting
+	if current := s.loadCurrent(); current != nil && time.Now().Before(current.renewAt) {
+		return current, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	cert, err := s.obtain(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.saveCert(cert); err != nil {
+		s.logger.Warn("cannot cache acme certificate", slog.String("error", err.Error()))
+	}
+	s.mu.Lock()
+	s.current = cert
+	s.mu.Unlock()
+	s.logger.Info(fmt.Sprintf("acme certificate for %s obtained, renewal at %s", strings.Join(s.domains, ","), cert.renewAt.Format(time.RFC3339)))
+	return cert, nil
+}
+
+func (s *acmeSource) loadCurrent() *obtained {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+func (s *acmeSource) obtain(ctx context.Context) (*obtained, error) {
+	if err := s.register(ctx); err != nil {
+		return nil, err
+	}
+	order, err := s.client.AuthorizeOrder(ctx, acme.DomainIDs(s.domains...))
+	if err != nil {
+		return nil, fmt.Errorf("acme source: authorize order: %w", err)
+	}
+	for _, authzURL := range order.AuthzURLs {
+		if err = s.authorize(ctx, authzURL); err != nil {
+			return nil, err
+		}
+	}
+	if order, err = s.client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, fmt.Errorf("acme source: wait order: %w", err)
+	}
+	privateKey, keyPEMBlock, _, _, err := keyutil.GenerateECKeys()
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: s.domains}, privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("acme source: create CSR: %w", err)
+	}
+	chain, _, err := s.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, fmt.Errorf("acme source: create certificate: %w", err)
+	}
+	var certPEMBlock bytes.Buffer
+	for _, der := range chain {
+		_ = pem.Encode(&certPEMBlock, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+	return s.newObtained(certPEMBlock.Bytes(), keyPEMBlock)
+}
+
+func (s *acmeSource) register(ctx context.Context) error {
+	if s.registered {
+		return nil
+	}
+	account := &acme.Account{}
+	if s.email != "" {
+		account.Contact = []string{"mailto:" + s.email}
+	}
+	if _, err := s.client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return fmt.Errorf("acme source: register account: %w", err)
+	}
+	s.registered = true
+	return nil
+}
+
+func (s *acmeSource) authorize(ctx context.Context, authzURL string) error {
+	authz, err := s.client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("acme source: get authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+	domain := authz.Identifier.Value
+	chal := s.selectChallenge(authz.Challenges)
+	if chal == nil {
+		return fmt.Errorf("acme source: no supported challenge for %s", domain)
+	}
+	cleanup, err := s.fulfill(chal, domain)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if _, err = s.client.Accept(ctx, chal); err != nil {
+		return fmt.Errorf("acme source: accept %s challenge for %s: %w", chal.Type, domain, err)
+	}
+	if _, err = s.client.WaitAuthorization(ctx, authzURL); err != nil {
+		return fmt.Errorf("acme source: %s challenge for %s: %w", chal.Type, domain, err)
+	}
+	return nil
+}
+
+// selectChallenge returns the first offered challenge in the order of the configured challenge types.
+func (s *acmeSource) selectChallenge(challenges []*acme.Challenge) *acme.Challenge {
+	for _, challengeType := range s.challengeTypes {
+		for _, chal := range challenges {
+			if chal.Type == challengeType {
+				return chal
+			}
+		}
+	}
+	return nil
+}
+
+// fulfill provisions the challenge response and returns the function removing it.
+func (s *acmeSource) fulfill(chal *acme.Challenge, domain string) (func(), error) {
+	s.challengeMu.Lock()
+	defer s.challengeMu.Unlock()
+
+	switch chal.Type {
+	case ChallengeTLSALPN01:
+		cert, err := s.client.TLSALPN01ChallengeCert(chal.Token, domain)
+		if err != nil {
+			return nil, fmt.Errorf("acme source: tls-alpn-01 challenge certificate for %s: %w", domain, err)
+		}
+		s.tlsALPN[domain] = &cert
+		return func() {
+			s.challengeMu.Lock()
+			defer s.challengeMu.Unlock()
+			delete(s.tlsALPN, domain)
+		}, nil
+	default:
+		response, err := s.client.HTTP01ChallengeResponse(chal.Token)
+		if err != nil {
+			return nil, fmt.Errorf("acme source: http-01 challenge response for %s: %w", domain, err)
+		}
+		path := s.client.HTTP01ChallengePath(chal.Token)
+		s.http01[path] = response
+		return func() {
+			s.challengeMu.Lock()
+			defer s.challengeMu.Unlock()
+			delete(s.http01, path)
+		}, nil
+	}
+}
+
+// newObtained validates the certificate and computes the renewal time.
+// If the certificate lifetime is shorter than the renew before duration, it is renewed after 2/3 of the lifetime.
+func (s *acmeSource) newObtained(certPEMBlock, keyPEMBlock []byte) (*obtained, error) {
+	certs, err := keyutil.ParseCertsPEM(certPEMBlock)
+	if err != nil {
+		return nil, fmt.Errorf("acme source: parse certificate: %w", err)
+	}
+	leaf := certs[0]
+	for _, domain := range s.domains {
+		if err = leaf.VerifyHostname(domain); err != nil {
+			return nil, fmt.Errorf("acme source: %w", err)
+		}
+	}
+	renewAt := leaf.NotAfter.Add(-s.renewBefore)
+	if lifetime := leaf.NotAfter.Sub(leaf.NotBefore); lifetime <= s.renewBefore {
+		renewAt = leaf.NotBefore.Add(lifetime * 2 / 3)
+	}
+	return &obtained{
+		certPEMBlock: certPEMBlock,
+		keyPEMBlock:  keyPEMBlock,
+		notAfter:     leaf.NotAfter,
+		renewAt:      renewAt,
+	}, nil
+}
+
+func (s *acmeSource) loadAccountKey() (crypto.Signer, error) {
+	if s.cacheDir != "" {
+		keyPEMBlock, err := os.ReadFile(filepath.Join(s.cacheDir, accountKeyFile))
+		if err == nil {
+			key, err := keyutil.ParsePrivateKeyPEM(keyPEMBlock)
+			if err != nil {
+				return nil, fmt.Errorf("acme source: parse account key: %w", err)
+			}
+			signer, ok := key.(crypto.Signer)
+			if !ok {
+				return nil, errors.New("acme source: account key is not a signer")
+			}
+			return signer, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("acme source: read account key: %w", err)
+		}
+	}
+	key, keyPEMBlock, _, _, err := keyutil.GenerateECKeys()
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("acme source: account key is not a signer")
+	}
+	if s.cacheDir != "" {
+		if err = writeCacheFile(s.cacheDir, accountKeyFile, keyPEMBlock); err != nil {
+			return nil, fmt.Errorf("acme source: write account key: %w", err)
+		}
+	}
+	return signer, nil
+}
+
+// loadCachedCert returns the cached certificate if it is valid for the configured domains.
+func (s *acmeSource) loadCachedCert() (*obtained, error) {
+	if s.cacheDir == "" {
+		return nil, nil
+	}
+	certPEMBlock, err := os.ReadFile(filepath.Join(s.cacheDir, s.certFile()))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	keyPEMBlock, err := os.ReadFile(filepath.Join(s.cacheDir, s.keyFile()))
+	if err != nil {
+		return nil, err
+	}
+	cert, err := s.newObtained(certPEMBlock, keyPEMBlock)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = tls.X509KeyPair(certPEMBlock, keyPEMBlock); err != nil {
+		return nil, err
+	}
+	if time.Now().After(cert.notAfter) {
+		return nil, nil
+	}
+	return cert, nil
+}
+
+func (s *acmeSource) saveCert(cert *obtained) error {
+	if s.cacheDir == "" {
+		return nil
+	}
+	if err := writeCacheFile(s.cacheDir, s.keyFile(), cert.keyPEMBlock); err != nil {
+		return err
+	}
+	return writeCacheFile(s.cacheDir, s.certFile(), cert.certPEMBlock)
+}
+
+func (s *acmeSource) certFile() string {
+	return s.domains[0] + ".crt"
+}
+
+func (s *acmeSource) keyFile() string {
+	return s.domains[0] + ".key"
+}
+
+func newServerCerts(cert *obtained) (*source.ServerCerts, error) {
+	return source.NewServerCerts(&source.ServerPEMs{
+		CertPEMBlock: cert.certPEMBlock,
+		KeyPEMBlock:  cert.keyPEMBlock,
+	})
+}
+
+// writeCacheFile replaces the file atomically, so a concurrent reader never sees a partial file.
+func writeCacheFile(dir, name string, data []byte) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, name+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(dir, name))
+}
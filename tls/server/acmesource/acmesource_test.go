@@ -0,0 +1,210 @@
+package acmesource
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/cert-source/internal/testutil"
+	tlsserver "github.com/grepplabs/cert-source/tls/server"
+	"github.com/grepplabs/cert-source/tls/server/source"
+	"github.com/stretchr/testify/require"
+)
+
+func newACME(t *testing.T) (*testutil.ACMEServer, *x509.Certificate) {
+	t.Helper()
+	bundle := testutil.NewCertsBundle()
+	t.Cleanup(bundle.Close)
+	acmeServer := testutil.NewACMEServer(bundle.CATLSCert, bundle.CAX509Cert)
+	t.Cleanup(acmeServer.Close)
+	return acmeServer, bundle.CAX509Cert
+}
+
+// startTLSServer starts a TLS server which answers the tls-alpn-01 challenges.
+func startTLSServer(t *testing.T, acmeServer *testutil.ACMEServer, src Source) (*httptest.Server, *source.ServerCertsStore) {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(ts.Close)
+	acmeServer.SetTLSALPNAddr(ts.Listener.Addr().String())
+
+	store, err := tlsserver.NewServerCertsStore(t.Context(), slog.Default(), src)
+	require.NoError(t, err)
+	ts.TLS = tlsserver.NewStoreServerConfig(slog.Default(), store, src.TLSServerConfigOption())
+	ts.StartTLS()
+	return ts, store
+}
+
+func waitForCertificate(t *testing.T, store *source.ServerCertsStore) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		return len(store.LoadServerCerts().Certificates) != 0
+	}, 10*time.Second, 50*time.Millisecond)
+}
+
+func get(t *testing.T, caCert *x509.Certificate, url string) {
+	t.Helper()
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(caCert)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: rootCAs, ServerName: "localhost"}}}
+	resp, err := client.Get(url)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestTLSALPN01Challenge(t *testing.T) {
+	acmeServer, caCert := newACME(t)
+	cacheDir := t.TempDir()
+
+	src := MustNew(
+		WithDirectoryURL(acmeServer.DirectoryURL()),
+		WithDomains("localhost"),
+		WithCacheDir(cacheDir),
+		WithChallengeTypes(ChallengeTLSALPN01),
+	)
+	ts, store := startTLSServer(t, acmeServer, src)
+	waitForCertificate(t, store)
+	get(t, caCert, ts.URL)
+
+	require.Equal(t, int32(1), acmeServer.Orders.Load())
+	require.FileExists(t, filepath.Join(cacheDir, "acme_account.key"))
+	require.FileExists(t, filepath.Join(cacheDir, "localhost.crt"))
+	require.FileExists(t, filepath.Join(cacheDir, "localhost.key"))
+	info, err := os.Stat(filepath.Join(cacheDir, "localhost.key"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// the cached certificate is served at once and the account is reused
+	cached := MustNew(
+		WithDirectoryURL(acmeServer.DirectoryURL()),
+		WithDomains("localhost"),
+		WithCacheDir(cacheDir),
+	)
+	cachedStore, err := tlsserver.NewServerCertsStore(t.Context(), slog.Default(), cached)
+	require.NoError(t, err)
+	require.Equal(t, store.LoadServerCerts().Checksum, cachedStore.LoadServerCerts().Checksum)
+	require.Equal(t, int32(1), acmeServer.Orders.Load())
+}
+
+func TestFirstCertificateIsRotation(t *testing.T) {
+	acmeServer, caCert := newACME(t)
+
+	src := MustNew(
+		WithDirectoryURL(acmeServer.DirectoryURL()),
+		WithDomains("localhost"),
+		WithChallengeTypes(ChallengeTLSALPN01),
+	)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	acmeServer.SetTLSALPNAddr(ts.Listener.Addr().String())
+
+	// the empty placeholder is not validated
+	store, err := tlsserver.NewServerCertsStore(t.Context(), slog.Default(), src,
+		source.WithServerCertsValidators(source.ValidateSANs("localhost")),
+	)
+	require.NoError(t, err)
+	rotations := store.Subscribe(t.Context())
+	ts.TLS = tlsserver.NewStoreServerConfig(slog.Default(), store, src.TLSServerConfigOption())
+	ts.StartTLS()
+
+	select {
+	case rotation := <-rotations:
+		require.Empty(t, rotation.Old.Certificates)
+		require.NotEmpty(t, rotation.Current.Certificates)
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected rotation to the obtained certificate")
+	}
+	get(t, caCert, ts.URL)
+}
+
+func TestHTTP01Challenge(t *testing.T) {
+	acmeServer, caCert := newACME(t)
+
+	src := MustNew(
+		WithDirectoryURL(acmeServer.DirectoryURL()),
+		WithDomains("localhost"),
+		WithChallengeTypes(ChallengeHTTP01),
+	)
+	fallback := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	httpServer := httptest.NewServer(src.HTTPHandler(fallback))
+	defer httpServer.Close()
+	acmeServer.SetHTTPAddr(httpServer.Listener.Addr().String())
+
+	store, err := tlsserver.NewServerCertsStore(t.Context(), slog.Default(), src)
+	require.NoError(t, err)
+	require.Empty(t, store.LoadServerCerts().Certificates)
+	waitForCertificate(t, store)
+
+	resp, err := http.Get(httpServer.URL + "/index.html")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusTeapot, resp.StatusCode)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	ts.TLS = tlsserver.NewStoreServerConfig(slog.Default(), store)
+	ts.StartTLS()
+	get(t, caCert, ts.URL)
+}
+
+func TestRenewal(t *testing.T) {
+	acmeServer, caCert := newACME(t)
+	acmeServer.CertValidity = 3 * time.Second
+
+	src := MustNew(
+		WithDirectoryURL(acmeServer.DirectoryURL()),
+		WithDomains("localhost"),
+		WithCacheDir(t.TempDir()),
+		WithCheckInterval(time.Second),
+	)
+	ts, store := startTLSServer(t, acmeServer, src)
+	waitForCertificate(t, store)
+	first := store.LoadServerCerts().Checksum
+
+	require.Eventually(t, func() bool {
+		return acmeServer.Orders.Load() >= 2
+	}, 10*time.Second, 100*time.Millisecond)
+	require.Eventually(t, func() bool {
+		return string(store.LoadServerCerts().Checksum) != string(first)
+	}, 5*time.Second, 100*time.Millisecond)
+	get(t, caCert, ts.URL)
+}
+
+func TestChallengeFailure(t *testing.T) {
+	acmeServer, _ := newACME(t)
+
+	src := MustNew(
+		WithDirectoryURL(acmeServer.DirectoryURL()),
+		WithDomains("localhost"),
+		WithChallengeTypes(ChallengeHTTP01),
+	)
+	// no http-01 address, the validation fails
+	store, err := tlsserver.NewServerCertsStore(t.Context(), slog.Default(), src)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return acmeServer.Validations.Load() == 1
+	}, 10*time.Second, 50*time.Millisecond)
+	require.Empty(t, store.LoadServerCerts().Certificates)
+}
+
+func TestNewValidation(t *testing.T) {
+	_, err := New()
+	require.ErrorContains(t, err, "domains are required")
+
+	_, err = New(WithDomains("localhost"), WithChallengeTypes("dns-01"))
+	require.ErrorContains(t, err, "unsupported challenge type")
+}
@@ -0,0 +1,101 @@
+package acmesource
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/grepplabs/cert-source/tls/watcher"
+)
+
+type Option func(*acmeSource)
+
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *acmeSource) {
+		s.logger = logger
+	}
+}
+
+// WithDirectoryURL sets the ACME directory URL. The default is the Let's Encrypt production directory.
+func WithDirectoryURL(directoryURL string) Option {
+	return func(s *acmeSource) {
+		s.directoryURL = directoryURL
+	}
+}
+
+// WithEmail sets the contact email of the ACME account.
+func WithEmail(email string) Option {
+	return func(s *acmeSource) {
+		s.email = email
+	}
+}
+
+// WithDomains sets the domains of the certificate. The first domain names the cached certificate files.
+func WithDomains(domains ...string) Option {
+	return func(s *acmeSource) {
+		s.domains = domains
+	}
+}
+
+// WithCacheDir persists the account key and the certificate in the directory.
+// Without a cache directory a new account and certificate are created on every start.
+func WithCacheDir(cacheDir string) Option {
+	return func(s *acmeSource) {
+		s.cacheDir = cacheDir
+	}
+}
+
+// WithChallengeTypes sets the accepted challenge types in the order of preference.
+// By default, tls-alpn-01 is preferred over http-01.
+func WithChallengeTypes(challengeTypes ...string) Option {
+	return func(s *acmeSource) {
+		s.challengeTypes = challengeTypes
+	}
+}
+
+// WithRenewBefore sets how long before the expiry the certificate is renewed.
+func WithRenewBefore(renewBefore time.Duration) Option {
+	return func(s *acmeSource) {
+		s.renewBefore = renewBefore
+	}
+}
+
+// WithCheckInterval sets how often the renewal time is checked. Failures are retried with the backoff up to the interval.
+func WithCheckInterval(checkInterval time.Duration) Option {
+	return func(s *acmeSource) {
+		s.checkInterval = checkInterval
+	}
+}
+
+// WithTimeout sets the timeout of obtaining a certificate.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *acmeSource) {
+		s.timeout = timeout
+	}
+}
+
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *acmeSource) {
+		s.httpClient = client
+	}
+}
+
+func WithNotifyFunc(notifyFunc func()) Option {
+	return func(s *acmeSource) {
+		s.notifyFunc = notifyFunc
+	}
+}
+
+// WithErrorFunc sets the function called with every load error.
+func WithErrorFunc(errorFunc func(error)) Option {
+	return func(s *acmeSource) {
+		s.errorFunc = errorFunc
+	}
+}
+
+// WithBackoff sets the retries of failed loads. The default starts at 1 minute.
+func WithBackoff(backoff watcher.Backoff) Option {
+	return func(s *acmeSource) {
+		s.backoff = backoff
+	}
+}
@@ -0,0 +1,275 @@
+package tlsserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"sync/atomic"
+	"time"
+
+	"github.com/grepplabs/cert-source/tls/keyutil"
+	"github.com/grepplabs/cert-source/tls/watcher"
+)
+
+// PeerPolicy authorizes client certificates. A client is rejected when any deny rule matches.
+// Otherwise, it is accepted when any allow rule matches or when there are no allow rules.
+type PeerPolicy struct {
+	Allow []PeerRule `json:"allow"`
+	Deny  []PeerRule `json:"deny"`
+
+	Checksum []byte `json:"-"`
+}
+
+func (p *PeerPolicy) GetChecksum() []byte {
+	if p == nil {
+		return nil
+	}
+	return p.Checksum
+}
+
+// PeerRule matches a client certificate when all of its set fields match.
+// The fields are patterns with the syntax of path.Match, e.g. spiffe://example.org/ns/*/sa/web or *.example.org.
+// As in path.Match, '*' does not match '/'.
+// A SAN pattern matches when any of the certificate SANs of the kind matches.
+type PeerRule struct {
+	// SPIFFEID matches the URI SANs with the spiffe scheme.
+	SPIFFEID string `json:"spiffeID,omitempty"`
+	URI      string `json:"uri,omitempty"`
+	DNS      string `json:"dns,omitempty"`
+	Email    string `json:"email,omitempty"`
+	// CommonName matches the subject common name.
+	CommonName string `json:"commonName,omitempty"`
+	// OrganizationalUnit matches any of the subject organizational units.
+	OrganizationalUnit string `json:"organizationalUnit,omitempty"`
+	// Issuer matches the issuer common name or the issuer distinguished name, e.g. CN=ca,O=example.
+	Issuer string `json:"issuer,omitempty"`
+}
+
+func (r PeerRule) validate() error {
+	patterns := []string{r.SPIFFEID, r.URI, r.DNS, r.Email, r.CommonName, r.OrganizationalUnit, r.Issuer}
+	empty := true
+	for _, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		empty = false
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	if empty {
+		return errors.New("empty rule")
+	}
+	return nil
+}
+
+// Matches reports whether the rule matches the certificate.
+func (r PeerRule) Matches(cert *x509.Certificate) bool {
+	if r.SPIFFEID != "" && !matchAny(r.SPIFFEID, spiffeIDs(cert)) {
+		return false
+	}
+	if r.URI != "" && !matchAny(r.URI, uris(cert)) {
+		return false
+	}
+	if r.DNS != "" && !matchAny(r.DNS, cert.DNSNames) {
+		return false
+	}
+	if r.Email != "" && !matchAny(r.Email, cert.EmailAddresses) {
+		return false
+	}
+	if r.CommonName != "" && !matchAny(r.CommonName, []string{cert.Subject.CommonName}) {
+		return false
+	}
+	if r.OrganizationalUnit != "" && !matchAny(r.OrganizationalUnit, cert.Subject.OrganizationalUnit) {
+		return false
+	}
+	if r.Issuer != "" && !matchAny(r.Issuer, []string{cert.Issuer.CommonName, cert.Issuer.String()}) {
+		return false
+	}
+	return true
+}
+
+// Authorize returns an error when the policy does not accept the certificate.
+func (p *PeerPolicy) Authorize(cert *x509.Certificate) error {
+	for i, rule := range p.Deny {
+		if rule.Matches(cert) {
+			return fmt.Errorf("client certificate %s is denied by rule %d", keyutil.GetHexFormatted(cert.SerialNumber.Bytes(), ":"), i)
+		}
+	}
+	if len(p.Allow) == 0 {
+		return nil
+	}
+	for _, rule := range p.Allow {
+		if rule.Matches(cert) {
+			return nil
+		}
+	}
+	return fmt.Errorf("client certificate %s is not allowed", keyutil.GetHexFormatted(cert.SerialNumber.Bytes(), ":"))
+}
+
+// ParsePeerPolicy parses the JSON representation of a policy.
+func ParsePeerPolicy(data []byte) (*PeerPolicy, error) {
+	var policy PeerPolicy
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("parse peer policy: %w", err)
+	}
+	for i, rule := range policy.Allow {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("peer policy allow rule %d: %w", i, err)
+		}
+	}
+	for i, rule := range policy.Deny {
+		if err := rule.validate(); err != nil {
+			return nil, fmt.Errorf("peer policy deny rule %d: %w", i, err)
+		}
+	}
+	sum := sha256.Sum256(data)
+	policy.Checksum = sum[:]
+	return &policy, nil
+}
+
+// PeerAuthorizer authorizes client certificates with a policy loaded from a JSON file.
+// It is used with WithTLSServerVerifyPeerCertificate or WithTLSServerPeerAuthorizer after the chain is verified.
+type PeerAuthorizer struct {
+	logger    *slog.Logger
+	file      string
+	refresh   time.Duration
+	fileWatch bool
+	policy    atomic.Pointer[PeerPolicy]
+}
+
+type PeerAuthorizerOption func(*PeerAuthorizer)
+
+// WithPeerAuthorizerRefresh sets the interval for reloading the policy file.
+func WithPeerAuthorizerRefresh(refresh time.Duration) PeerAuthorizerOption {
+	return func(a *PeerAuthorizer) {
+		a.refresh = refresh
+	}
+}
+
+// WithPeerAuthorizerFileWatch reloads the policy file on file system events.
+func WithPeerAuthorizerFileWatch(fileWatch bool) PeerAuthorizerOption {
+	return func(a *PeerAuthorizer) {
+		a.fileWatch = fileWatch
+	}
+}
+
+// NewPeerAuthorizer loads the policy file and keeps reloading it until ctx is done, if the refresh or the file watch is enabled.
+func NewPeerAuthorizer(ctx context.Context, logger *slog.Logger, file string, opts ...PeerAuthorizerOption) (*PeerAuthorizer, error) {
+	a := &PeerAuthorizer{
+		logger: logger,
+		file:   file,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	policy, err := a.load()
+	if err != nil {
+		return nil, err
+	}
+	a.policy.Store(policy)
+	if a.refresh <= 0 && !a.fileWatch {
+		return a, nil
+	}
+	var files []string
+	if a.fileWatch {
+		files = []string{file}
+	}
+	ch := make(chan PeerPolicy, 1)
+	go func() {
+		defer close(ch)
+		watcher.WatchFilesEvents(ctx, logger, ch, a.refresh, files, watcher.DefaultDebounce, policy, a.load, nil)
+	}()
+	go func() {
+		for policy := range ch {
+			a.policy.Store(&policy)
+			logger.Info("peer policy reloaded", slog.String("file", file), slog.Int("allow", len(policy.Allow)), slog.Int("deny", len(policy.Deny)))
+		}
+	}()
+	return a, nil
+}
+
+// NewStaticPeerAuthorizer authorizes client certificates with a fixed policy.
+func NewStaticPeerAuthorizer(logger *slog.Logger, policy *PeerPolicy) *PeerAuthorizer {
+	a := &PeerAuthorizer{logger: logger}
+	a.policy.Store(policy)
+	return a
+}
+
+// Policy returns the current policy.
+func (a *PeerAuthorizer) Policy() *PeerPolicy {
+	return a.policy.Load()
+}
+
+func (a *PeerAuthorizer) load() (*PeerPolicy, error) {
+	data, err := os.ReadFile(a.file)
+	if err != nil {
+		return nil, fmt.Errorf("read peer policy: %w", err)
+	}
+	return ParsePeerPolicy(data)
+}
+
+// VerifyPeerCertificate authorizes the leaf of the verified client certificate chain.
+// Certificates which were not verified, e.g. with the request or require-any client auth, are rejected,
+// as their names can be chosen freely. A client without certificate is accepted only when there are no allow rules.
+func (a *PeerAuthorizer) VerifyPeerCertificate(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	policy := a.policy.Load()
+	var leaf *x509.Certificate
+	switch {
+	case len(verifiedChains) != 0 && len(verifiedChains[0]) != 0:
+		leaf = verifiedChains[0][0]
+	case len(rawCerts) != 0:
+		return errors.New("client certificate chain is not verified")
+	default:
+		if len(policy.Allow) != 0 {
+			return errors.New("client certificate is required")
+		}
+		return nil
+	}
+	if err := policy.Authorize(leaf); err != nil {
+		a.logger.Debug(err.Error())
+		return err
+	}
+	return nil
+}
+
+// WithTLSServerPeerAuthorizer authorizes client certificates after the other verifications succeed.
+func WithTLSServerPeerAuthorizer(authorizer *PeerAuthorizer) TLSServerConfigOption {
+	return WithTLSServerVerifyPeerCertificate(authorizer.VerifyPeerCertificate)
+}
+
+func matchAny(pattern string, values []string) bool {
+	for _, value := range values {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func spiffeIDs(cert *x509.Certificate) []string {
+	var result []string
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			result = append(result, uri.String())
+		}
+	}
+	return result
+}
+
+func uris(cert *x509.Certificate) []string {
+	result := make([]string, 0, len(cert.URIs))
+	for _, uri := range cert.URIs {
+		result = append(result, uri.String())
+	}
+	return result
+}
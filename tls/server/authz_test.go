@@ -0,0 +1,155 @@
+package tlsserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/cert-source/internal/testutil"
+	"github.com/grepplabs/cert-source/tls/server/filesource"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerPolicyAuthorize(t *testing.T) {
+	cert := &x509.Certificate{
+		SerialNumber:   big.NewInt(1),
+		Subject:        pkix.Name{CommonName: "web", OrganizationalUnit: []string{"payments", "ops"}},
+		Issuer:         pkix.Name{CommonName: "issuing-ca", Organization: []string{"example"}},
+		DNSNames:       []string{"web.prod.example.org"},
+		EmailAddresses: []string{"web@example.org"},
+		URIs: []*url.URL{
+			{Scheme: "spiffe", Host: "example.org", Path: "/ns/prod/sa/web"},
+			{Scheme: "https", Host: "web.example.org"},
+		},
+	}
+	tests := []struct {
+		name      string
+		policy    PeerPolicy
+		wantError bool
+	}{
+		{name: "empty policy"},
+		{name: "spiffe ID", policy: PeerPolicy{Allow: []PeerRule{{SPIFFEID: "spiffe://example.org/ns/*/sa/web"}}}},
+		{name: "spiffe ID not matching", policy: PeerPolicy{Allow: []PeerRule{{SPIFFEID: "spiffe://example.org/ns/*/sa/db"}}}, wantError: true},
+		{name: "spiffe ID does not match other URIs", policy: PeerPolicy{Allow: []PeerRule{{SPIFFEID: "https://web.example.org"}}}, wantError: true},
+		{name: "uri", policy: PeerPolicy{Allow: []PeerRule{{URI: "https://*.example.org"}}}},
+		{name: "dns", policy: PeerPolicy{Allow: []PeerRule{{DNS: "*.prod.example.org"}}}},
+		{name: "email", policy: PeerPolicy{Allow: []PeerRule{{Email: "*@example.org"}}}},
+		{name: "common name", policy: PeerPolicy{Allow: []PeerRule{{CommonName: "web"}}}},
+		{name: "organizational unit", policy: PeerPolicy{Allow: []PeerRule{{OrganizationalUnit: "ops"}}}},
+		{name: "issuer common name", policy: PeerPolicy{Allow: []PeerRule{{Issuer: "issuing-*"}}}},
+		{name: "issuer distinguished name", policy: PeerPolicy{Allow: []PeerRule{{Issuer: "CN=issuing-ca,O=example"}}}},
+		{name: "all fields of a rule must match", policy: PeerPolicy{Allow: []PeerRule{{CommonName: "web", OrganizationalUnit: "hr"}}}, wantError: true},
+		{name: "any allow rule", policy: PeerPolicy{Allow: []PeerRule{{CommonName: "db"}, {DNS: "web.*"}}}},
+		{name: "deny wins", policy: PeerPolicy{Allow: []PeerRule{{CommonName: "web"}}, Deny: []PeerRule{{OrganizationalUnit: "payments"}}}, wantError: true},
+		{name: "deny only", policy: PeerPolicy{Deny: []PeerRule{{CommonName: "db"}}}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.policy.Authorize(cert)
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestParsePeerPolicy(t *testing.T) {
+	policy, err := ParsePeerPolicy([]byte(`{"allow":[{"spiffeID":"spiffe://example.org/*"}],"deny":[{"commonName":"test"}]}`))
+	require.NoError(t, err)
+	require.Equal(t, []PeerRule{{SPIFFEID: "spiffe://example.org/*"}}, policy.Allow)
+	require.Equal(t, []PeerRule{{CommonName: "test"}}, policy.Deny)
+	require.NotEmpty(t, policy.Checksum)
+
+	_, err = ParsePeerPolicy([]byte(`{"allow":[{"cn":"test"}]}`))
+	require.ErrorContains(t, err, "unknown field")
+
+	_, err = ParsePeerPolicy([]byte(`{"allow":[{}]}`))
+	require.ErrorContains(t, err, "empty rule")
+
+	_, err = ParsePeerPolicy([]byte(`{"deny":[{"dns":"[a-"}]}`))
+	require.ErrorContains(t, err, "invalid pattern")
+}
+
+func TestPeerAuthorizerReload(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	clientCert, _, err := testutil.GenerateSVID(bundle.CATLSCert, "spiffe://example.org/ns/prod/sa/web")
+	require.NoError(t, err)
+
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(policyFile, []byte(`{"allow":[{"spiffeID":"spiffe://example.org/ns/prod/sa/*"}]}`), 0o600))
+	authorizer, err := NewPeerAuthorizer(t.Context(), slog.Default(), policyFile, WithPeerAuthorizerFileWatch(true))
+	require.NoError(t, err)
+
+	serverURL := startServer(t, filesource.MustNew(
+		filesource.WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
+		filesource.WithClientAuthFile(bundle.CACert.Name()),
+		filesource.WithClientCRLFile(bundle.ClientCRL.Name()),
+	), WithTLSServerPeerAuthorizer(authorizer))
+	client := newHTTPClient(bundle.CAX509Cert, clientCert)
+
+	resp, err := client.Get(serverURL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+
+	// revoked client certificates are still rejected by the CRL check
+	// nolint:bodyclose
+	_, err = newHTTPClient(bundle.CAX509Cert, bundle.ClientTLSCert).Get(serverURL)
+	require.Error(t, err)
+
+	require.NoError(t, os.WriteFile(policyFile, []byte(`{"deny":[{"spiffeID":"spiffe://example.org/ns/prod/sa/web"}]}`), 0o600))
+	require.Eventually(t, func() bool {
+		return len(authorizer.Policy().Deny) == 1
+	}, 5*time.Second, 20*time.Millisecond)
+
+	client.CloseIdleConnections()
+	// nolint:bodyclose
+	_, err = client.Get(serverURL)
+	require.Error(t, err)
+
+	// an invalid policy keeps the previous one
+	require.NoError(t, os.WriteFile(policyFile, []byte(`{"deny":[{}]}`), 0o600))
+	time.Sleep(300 * time.Millisecond)
+	require.Len(t, authorizer.Policy().Deny, 1)
+}
+
+func TestPeerAuthorizerWithoutClientCertificate(t *testing.T) {
+	allow := NewStaticPeerAuthorizer(slog.Default(), &PeerPolicy{Allow: []PeerRule{{CommonName: "web"}}})
+	require.ErrorContains(t, allow.VerifyPeerCertificate(nil, nil), "client certificate is required")
+
+	deny := NewStaticPeerAuthorizer(slog.Default(), &PeerPolicy{Deny: []PeerRule{{CommonName: "web"}}})
+	require.NoError(t, deny.VerifyPeerCertificate(nil, nil))
+}
+
+func TestPeerAuthorizerUnverifiedClientCertificate(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+	otherBundle := testutil.NewCertsBundle()
+	defer otherBundle.Close()
+
+	const spiffeID = "spiffe://example.org/ns/prod/sa/web"
+	authorizer := NewStaticPeerAuthorizer(slog.Default(), &PeerPolicy{Allow: []PeerRule{{SPIFFEID: spiffeID}}})
+
+	// the client certificate is issued by an untrusted CA, but has the allowed SPIFFE ID
+	clientCert, _, err := testutil.GenerateSVID(otherBundle.CATLSCert, spiffeID)
+	require.NoError(t, err)
+	require.ErrorContains(t, authorizer.VerifyPeerCertificate(clientCert.Certificate, nil), "client certificate chain is not verified")
+
+	serverURL := startServer(t, filesource.MustNew(
+		filesource.WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
+	), WithTLSServerClientAuth(tls.RequireAnyClientCert), WithTLSServerPeerAuthorizer(authorizer))
+
+	// nolint:bodyclose
+	_, err = newHTTPClient(bundle.CAX509Cert, clientCert).Get(serverURL)
+	require.Error(t, err)
+}
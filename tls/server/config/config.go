@@ -1,6 +1,7 @@
 package config
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"log/slog"
@@ -8,23 +9,74 @@ import (
 	"github.com/grepplabs/cert-source/config"
 	tlsserver "github.com/grepplabs/cert-source/tls/server"
 	"github.com/grepplabs/cert-source/tls/server/filesource"
+	"github.com/grepplabs/cert-source/tls/server/source"
 )
 
-func GetServerTLSConfig(logger *slog.Logger, conf *config.TLSServerConfig, opts ...tlsserver.TLSServerConfigOption) (*tls.Config, error) {
+func GetServerTLSConfig(ctx context.Context, logger *slog.Logger, conf *config.TLSServerConfig, opts ...tlsserver.TLSServerConfigOption) (*tls.Config, error) {
+	return GetServerTLSConfigWithStoreOptions(ctx, logger, conf, nil, opts...)
+}
+
+// GetServerTLSConfigWithStoreOptions is like GetServerTLSConfig, but adds the store options, e.g. custom validators,
+// to the ones of the configuration.
+func GetServerTLSConfigWithStoreOptions(ctx context.Context, logger *slog.Logger, conf *config.TLSServerConfig, storeOpts []source.ServerCertsStoreOption, opts ...tlsserver.TLSServerConfigOption) (*tls.Config, error) {
+	crlExpiryPolicy, err := source.ParseCRLExpiryPolicy(conf.ClientCRLExpiryPolicy)
+	if err != nil {
+		return nil, err
+	}
+	if conf.ClientAuth != "" && conf.ClientAuth != "auto" {
+		clientAuth, err := tlsserver.ParseClientAuthType(conf.ClientAuth)
+		if err != nil {
+			return nil, err
+		}
+		opts = append([]tlsserver.TLSServerConfigOption{tlsserver.WithTLSServerClientAuth(clientAuth)}, opts...)
+	}
+	if conf.File.ClientPolicy != "" {
+		authorizer, err := tlsserver.NewPeerAuthorizer(ctx, logger, conf.File.ClientPolicy,
+			tlsserver.WithPeerAuthorizerRefresh(conf.Refresh),
+			tlsserver.WithPeerAuthorizerFileWatch(conf.FileWatch),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("setup client peer authorizer: %w", err)
+		}
+		opts = append(opts, tlsserver.WithTLSServerPeerAuthorizer(authorizer))
+	}
 	fs, err := filesource.New(
 		filesource.WithLogger(logger),
 		filesource.WithX509KeyPair(conf.File.Cert, conf.File.Key),
 		filesource.WithClientAuthFile(conf.File.ClientCAs),
 		filesource.WithClientCRLFile(conf.File.ClientCRL),
+		filesource.WithClientCRLExpiryPolicy(crlExpiryPolicy),
 		filesource.WithRefresh(conf.Refresh),
+		filesource.WithFileWatch(conf.FileWatch),
 		filesource.WithKeyPassword(conf.KeyPassword),
+		filesource.WithPKCS12File(conf.File.PKCS12, conf.KeyPassword),
+		filesource.WithPKCS12ClientCAs(conf.File.PKCS12ClientCAs),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("setup server cert file source: %w", err)
 	}
-	tlsConfig, err := tlsserver.NewServerConfig(logger, fs, opts...)
+	storeOpts = append(GetServerCertsStoreOptions(conf), storeOpts...)
+	tlsConfig, err := tlsserver.NewServerConfigWithStoreOptions(ctx, logger, fs, storeOpts, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("setup server TLS config: %w", err)
 	}
 	return tlsConfig, nil
 }
+
+// GetServerCertsStoreOptions returns the store options with the validators of the configuration.
+func GetServerCertsStoreOptions(conf *config.TLSServerConfig) []source.ServerCertsStoreOption {
+	var validators []source.ServerCertsValidator
+	if conf.Validate.MinValidity > 0 {
+		validators = append(validators, source.ValidateValidity(conf.Validate.MinValidity))
+	}
+	if len(conf.Validate.SANs) != 0 {
+		validators = append(validators, source.ValidateSANs(conf.Validate.SANs...))
+	}
+	if conf.Validate.MinRSABits > 0 || conf.Validate.MinECDSABits > 0 {
+		validators = append(validators, source.ValidateKeySize(conf.Validate.MinRSABits, conf.Validate.MinECDSABits))
+	}
+	if len(validators) == 0 {
+		return nil
+	}
+	return []source.ServerCertsStoreOption{source.WithServerCertsValidators(validators...)}
+}
@@ -5,7 +5,10 @@ import (
 	"crypto/x509"
 	"errors"
 	"log/slog"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/grepplabs/cert-source/config"
 	"github.com/grepplabs/cert-source/internal/testutil"
@@ -17,7 +20,7 @@ func TestGetServerTLSConfig(t *testing.T) {
 	bundle := testutil.NewCertsBundle()
 	defer bundle.Close()
 
-	tlsConfig, err := GetServerTLSConfig(slog.Default(), &config.TLSServerConfig{
+	tlsConfig, err := GetServerTLSConfig(t.Context(), slog.Default(), &config.TLSServerConfig{
 		Enable:  true,
 		Refresh: 0,
 		File: config.TLSServerFiles{
@@ -42,11 +45,55 @@ func TestGetServerTLSConfig(t *testing.T) {
 	require.Nil(t, tlsConfig.CurvePreferences)
 }
 
+func TestGetServerTLSClientAuthConfig(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	tests := []struct {
+		name       string
+		clientAuth string
+		clientCAs  string
+		expected   tls.ClientAuthType
+		wantError  bool
+	}{
+		{name: "auto without client CA", clientAuth: "auto", expected: tls.NoClientCert},
+		{name: "auto with client CA", clientAuth: "auto", clientCAs: bundle.CACert.Name(), expected: tls.RequireAndVerifyClientCert},
+		{name: "empty with client CA", clientCAs: bundle.CACert.Name(), expected: tls.RequireAndVerifyClientCert},
+		{name: "verify if given", clientAuth: "verify-if-given", clientCAs: bundle.CACert.Name(), expected: tls.VerifyClientCertIfGiven},
+		{name: "request", clientAuth: "request", expected: tls.RequestClientCert},
+		{name: "require any", clientAuth: "require-any", clientCAs: bundle.CACert.Name(), expected: tls.RequireAnyClientCert},
+		{name: "none", clientAuth: "none", clientCAs: bundle.CACert.Name(), expected: tls.NoClientCert},
+		{name: "unknown", clientAuth: "optional", wantError: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tlsConfig, err := GetServerTLSConfig(t.Context(), slog.Default(), &config.TLSServerConfig{
+				Enable:     true,
+				ClientAuth: tc.clientAuth,
+				File: config.TLSServerFiles{
+					Key:       bundle.ServerKey.Name(),
+					Cert:      bundle.ServerCert.Name(),
+					ClientCAs: tc.clientCAs,
+				},
+			})
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, tlsConfig.ClientAuth)
+			perClient, err := tlsConfig.GetConfigForClient(&tls.ClientHelloInfo{})
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, perClient.ClientAuth)
+		})
+	}
+}
+
 func TestGetServerTLSOptionsConfig(t *testing.T) {
 	bundle := testutil.NewCertsBundle()
 	defer bundle.Close()
 
-	tlsConfig, err := GetServerTLSConfig(slog.Default(), &config.TLSServerConfig{
+	tlsConfig, err := GetServerTLSConfig(t.Context(), slog.Default(), &config.TLSServerConfig{
 		Enable:  true,
 		Refresh: 0,
 		File: config.TLSServerFiles{
@@ -196,7 +243,7 @@ func TestGetServerTLSVerifyPeerCertificateConfig(t *testing.T) {
 			for _, f := range tc.verifyFuncs {
 				opts = append(opts, tlsserver.WithTLSServerVerifyPeerCertificate(f))
 			}
-			tlsConfig, err := GetServerTLSConfig(slog.Default(), &config.TLSServerConfig{
+			tlsConfig, err := GetServerTLSConfig(t.Context(), slog.Default(), &config.TLSServerConfig{
 				Enable:  true,
 				Refresh: 0,
 				File: config.TLSServerFiles{
@@ -216,3 +263,114 @@ func TestGetServerTLSVerifyPeerCertificateConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestGetServerTLSClientPolicyConfig(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	policyFile := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(policyFile, []byte(`{"allow":[{"commonName":"web"}]}`), 0o600))
+	conf := &config.TLSServerConfig{
+		Enable: true,
+		File: config.TLSServerFiles{
+			Key:          bundle.ServerKey.Name(),
+			Cert:         bundle.ServerCert.Name(),
+			ClientCAs:    bundle.CACert.Name(),
+			ClientPolicy: policyFile,
+		},
+	}
+	tlsConfig, err := GetServerTLSConfig(t.Context(), slog.Default(), conf)
+	require.NoError(t, err)
+	perClient, err := tlsConfig.GetConfigForClient(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	// the bundle client is not allowed by the policy
+	require.ErrorContains(t, perClient.VerifyPeerCertificate(nil, [][]*x509.Certificate{{bundle.ClientX509Cert, bundle.CAX509Cert}}), "is not allowed")
+
+	conf.File.ClientPolicy = filepath.Join(t.TempDir(), "missing.json")
+	_, err = GetServerTLSConfig(t.Context(), slog.Default(), conf)
+	require.ErrorContains(t, err, "peer policy")
+}
+
+func TestGetServerTLSPKCS12Config(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	pkcs12File := filepath.Join(t.TempDir(), "server.p12")
+	require.NoError(t, testutil.WritePKCS12File(pkcs12File, bundle.ServerTLSCert, bundle.CAX509Cert, testutil.DefaultKeyPassword))
+
+	tlsConfig, err := GetServerTLSConfig(t.Context(), slog.Default(), &config.TLSServerConfig{
+		Enable:      true,
+		KeyPassword: testutil.DefaultKeyPassword,
+		File: config.TLSServerFiles{
+			PKCS12: pkcs12File,
+		},
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, tlsConfig.Certificates)
+	require.Equal(t, tls.NoClientCert, tlsConfig.ClientAuth)
+
+	tlsConfig, err = GetServerTLSConfig(t.Context(), slog.Default(), &config.TLSServerConfig{
+		Enable:      true,
+		KeyPassword: testutil.DefaultKeyPassword,
+		File: config.TLSServerFiles{
+			PKCS12:          pkcs12File,
+			PKCS12ClientCAs: true,
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, tls.RequireAndVerifyClientCert, tlsConfig.ClientAuth)
+
+	_, err = GetServerTLSConfig(t.Context(), slog.Default(), &config.TLSServerConfig{
+		Enable:      true,
+		KeyPassword: testutil.DefaultKeyPassword,
+		File: config.TLSServerFiles{
+			Cert:   bundle.ServerCert.Name(),
+			Key:    bundle.ServerKey.Name(),
+			PKCS12: pkcs12File,
+		},
+	})
+	require.ErrorContains(t, err, "mutually exclusive")
+
+	_, err = GetServerTLSConfig(t.Context(), slog.Default(), &config.TLSServerConfig{
+		Enable:      true,
+		KeyPassword: "wrong",
+		File: config.TLSServerFiles{
+			PKCS12: pkcs12File,
+		},
+	})
+	require.Error(t, err)
+}
+
+func TestGetServerTLSValidationConfig(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	tests := []struct {
+		name      string
+		validate  config.TLSServerValidation
+		errorText string
+	}{
+		{name: "no validation"},
+		{name: "valid", validate: config.TLSServerValidation{MinValidity: time.Hour, SANs: []string{"localhost"}, MinRSABits: 2048}},
+		{name: "SAN not matching", validate: config.TLSServerValidation{SANs: []string{"example.com"}}, errorText: "no certificate is valid for example.com"},
+		{name: "expires too early", validate: config.TLSServerValidation{MinValidity: 100 * 365 * 24 * time.Hour}, errorText: "expires at"},
+		{name: "key too small", validate: config.TLSServerValidation{MinRSABits: 8192}, errorText: "is less than 8192"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := GetServerTLSConfig(t.Context(), slog.Default(), &config.TLSServerConfig{
+				Enable: true,
+				File: config.TLSServerFiles{
+					Key:  bundle.ServerKey.Name(),
+					Cert: bundle.ServerCert.Name(),
+				},
+				Validate: tc.validate,
+			})
+			if tc.errorText != "" {
+				require.ErrorContains(t, err, tc.errorText)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
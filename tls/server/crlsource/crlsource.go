@@ -0,0 +1,252 @@
+package crlsource
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grepplabs/cert-source/tls/keyutil"
+	tlscert "github.com/grepplabs/cert-source/tls/server/source"
+)
+
+const (
+	defaultTimeout       = 30 * time.Second
+	defaultMaxRefresh    = 1 * time.Hour
+	defaultRetryInterval = 1 * time.Minute
+	maxCRLSize           = 32 << 20
+)
+
+// crlSource downloads client CRLs from the CRL distribution points of the client CAs and from explicit URLs.
+// A CRL is downloaded again when its NextUpdate is reached; the last good CRL is kept when the endpoint is unreachable.
+// The cert sources reload at NextRefresh, so the CRLs are refreshed without a refresh interval.
+type crlSource struct {
+	urls              []string
+	distributionPoint bool
+	client            *http.Client
+	timeout           time.Duration
+	maxRefresh        time.Duration
+	retryInterval     time.Duration
+	logger            *slog.Logger
+
+	mu      sync.Mutex
+	entries map[string]*crlEntry
+}
+
+type crlEntry struct {
+	pemBlock   []byte
+	nextFetch  time.Time
+	caChecksum [sha256.Size]byte
+}
+
+func New(opts ...Option) tlscert.ClientCRLSource {
+	s := &crlSource{
+		distributionPoint: true,
+		client:            http.DefaultClient,
+		timeout:           defaultTimeout,
+		maxRefresh:        defaultMaxRefresh,
+		retryInterval:     defaultRetryInterval,
+		logger:            slog.Default(),
+		entries:           make(map[string]*crlEntry),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// ClientCRLs returns the concatenated PEM CRLs for the client CAs. Only CRLs which are due are downloaded.
+// The downloads run in parallel and do not block NextRefresh, so an unreachable endpoint delays the load by one timeout at most.
+// A CRL which was never downloaded is left out and retried after the retry interval, so it does not block the certificates.
+func (s *crlSource) ClientCRLs(clientAuthPEMBlock []byte) ([]byte, error) {
+	if len(clientAuthPEMBlock) == 0 {
+		return nil, errors.New("crl source: client CAs are required")
+	}
+	urls, err := s.crlURLs(clientAuthPEMBlock)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	caChecksum := sha256.Sum256(clientAuthPEMBlock)
+	due := s.dueURLs(urls, clientAuthPEMBlock, caChecksum, now)
+
+	fetched := make([]fetchResult, len(due))
+	var wg sync.WaitGroup
+	for i, url := range due {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fetched[i] = s.fetch(url, clientAuthPEMBlock, now)
+		}()
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, url := range due {
+		entry, ok := s.entries[url]
+		if !ok || entry.caChecksum != caChecksum {
+			// the entry was changed by a load with other client CAs
+			continue
+		}
+		if fetched[i].pemBlock != nil {
+			entry.pemBlock = fetched[i].pemBlock
+		}
+		entry.nextFetch = fetched[i].nextFetch
+	}
+	var result bytes.Buffer
+	for _, url := range urls {
+		entry, ok := s.entries[url]
+		if !ok || entry.pemBlock == nil {
+			s.logger.Warn("no CRL available, client certificates are not checked against it", slog.String("url", url))
+			continue
+		}
+		result.Write(entry.pemBlock)
+	}
+	return result.Bytes(), nil
+}
+
+// dueURLs updates the entries for the client CAs and returns the URLs of the CRLs which are due to be downloaded.
+func (s *crlSource) dueURLs(urls []string, clientAuthPEMBlock []byte, caChecksum [sha256.Size]byte, now time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for url := range s.entries {
+		if !slices.Contains(urls, url) {
+			delete(s.entries, url)
+		}
+	}
+	var due []string
+	for _, url := range urls {
+		entry, ok := s.entries[url]
+		if !ok {
+			entry = &crlEntry{}
+			s.entries[url] = entry
+		}
+		if entry.caChecksum != caChecksum {
+			// client CAs were rotated, the CRL is downloaded again and kept meanwhile only if the new CAs verify it
+			if entry.pemBlock != nil && (tlscert.ServerPEMs{ClientAuthPEMBlock: clientAuthPEMBlock, CRLPEMBlock: entry.pemBlock}).ValidateCRLs() != nil {
+				entry.pemBlock = nil
+			}
+			entry.nextFetch = time.Time{}
+			entry.caChecksum = caChecksum
+		}
+		if !now.Before(entry.nextFetch) {
+			due = append(due, url)
+		}
+	}
+	return due
+}
+
+// NextRefresh returns the earliest time a CRL is due to be downloaded or the zero time if no CRL is known.
+func (s *crlSource) NextRefresh() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var next time.Time
+	for _, entry := range s.entries {
+		if next.IsZero() || entry.nextFetch.Before(next) {
+			next = entry.nextFetch
+		}
+	}
+	return next
+}
+
+// fetchResult is a downloaded CRL. The PEM block is nil if the download failed, so the last good CRL is kept.
+type fetchResult struct {
+	pemBlock  []byte
+	nextFetch time.Time
+}
+
+func (s *crlSource) fetch(url string, clientAuthPEMBlock []byte, now time.Time) fetchResult {
+	failed := fetchResult{nextFetch: now.Add(s.retryInterval)}
+	pemBlock, err := s.download(url)
+	if err == nil {
+		err = tlscert.ServerPEMs{ClientAuthPEMBlock: clientAuthPEMBlock, CRLPEMBlock: pemBlock}.ValidateCRLs()
+	}
+	if err != nil {
+		s.logger.Error("cannot download CRL, keeping the last good CRL", slog.String("url", url), slog.String("error", err.Error()))
+		return failed
+	}
+	crls, err := keyutil.ParseCRLsPEM(pemBlock)
+	if err != nil {
+		s.logger.Error("cannot parse CRL, keeping the last good CRL", slog.String("url", url), slog.String("error", err.Error()))
+		return failed
+	}
+	nextFetch := now.Add(s.maxRefresh)
+	for _, crl := range crls {
+		if !crl.NextUpdate.IsZero() && crl.NextUpdate.Before(nextFetch) {
+			nextFetch = crl.NextUpdate
+		}
+	}
+	if nextFetch.Before(now.Add(s.retryInterval)) {
+		nextFetch = now.Add(s.retryInterval)
+	}
+	s.logger.Info("downloaded CRL", slog.String("url", url), slog.Time("nextFetch", nextFetch))
+	return fetchResult{pemBlock: pemBlock, nextFetch: nextFetch}
+}
+
+func (s *crlSource) download(url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCRLSize))
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		return data, nil
+	}
+	// distribution points usually serve DER encoded CRLs
+	return pem.EncodeToMemory(&pem.Block{Type: keyutil.X509CRLBlockType, Bytes: data}), nil
+}
+
+func (s *crlSource) crlURLs(clientAuthPEMBlock []byte) ([]string, error) {
+	urls := make([]string, 0, len(s.urls))
+	seen := make(map[string]struct{})
+	add := func(url string) {
+		if _, ok := seen[url]; ok {
+			return
+		}
+		seen[url] = struct{}{}
+		urls = append(urls, url)
+	}
+	for _, url := range s.urls {
+		add(url)
+	}
+	if s.distributionPoint {
+		certs, err := keyutil.ParseCertsPEM(clientAuthPEMBlock)
+		if err != nil {
+			return nil, err
+		}
+		for _, cert := range certs {
+			for _, url := range cert.CRLDistributionPoints {
+				if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+					add(url)
+				}
+			}
+		}
+	}
+	if len(urls) == 0 {
+		return nil, errors.New("crl source: no CRL URLs configured or found in client CAs")
+	}
+	return urls, nil
+}
@@ -0,0 +1,265 @@
+package crlsource
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/cert-source/internal/testutil"
+	servertls "github.com/grepplabs/cert-source/tls/server"
+	"github.com/grepplabs/cert-source/tls/server/filesource"
+	"github.com/stretchr/testify/require"
+)
+
+type crlServer struct {
+	*httptest.Server
+	requests    atomic.Int32
+	unavailable atomic.Bool
+	crl         atomic.Pointer[[]byte]
+}
+
+func newCRLServer(t *testing.T, crlFile string) *crlServer {
+	t.Helper()
+	s := &crlServer{}
+	s.setCRL(t, crlFile)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		if s.unavailable.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pkix-crl")
+		_, _ = w.Write(*s.crl.Load())
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *crlServer) setCRL(t *testing.T, crlFile string) {
+	t.Helper()
+	data, err := os.ReadFile(crlFile)
+	require.NoError(t, err)
+	block, _ := pem.Decode(data)
+	require.NotNil(t, block)
+	// serve DER as distribution points usually do
+	s.crl.Store(&block.Bytes)
+}
+
+func TestClientCertRevokedByDownloadedCRL(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	srv := newCRLServer(t, bundle.ClientCRL.Name())
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	ts.TLS = servertls.MustNewServerConfig(t.Context(), slog.Default(), filesource.MustNew(
+		filesource.WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
+		filesource.WithClientAuthFile(bundle.CACert.Name()),
+		filesource.WithClientCRLSource(New(WithURLs(srv.URL), WithDistributionPoints(false))),
+	))
+	ts.StartTLS()
+
+	// nolint:bodyclose
+	_, err := bundle.NewHttpClient().Get(ts.URL)
+	require.Error(t, err)
+	require.Equal(t, int32(1), srv.requests.Load())
+}
+
+func TestClientCRLsRefresh(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	caPEM, err := os.ReadFile(bundle.CACert.Name())
+	require.NoError(t, err)
+
+	srv := newCRLServer(t, bundle.CAEmptyCRL.Name())
+	src := New(WithURLs(srv.URL), WithRetryInterval(0)).(*crlSource)
+
+	crls1, err := src.ClientCRLs(caPEM)
+	require.NoError(t, err)
+	require.NotEmpty(t, crls1)
+	require.Equal(t, int32(1), srv.requests.Load())
+
+	// NextUpdate is not reached
+	_, err = src.ClientCRLs(caPEM)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), srv.requests.Load())
+
+	// endpoint is unreachable, the last good CRL is kept
+	srv.unavailable.Store(true)
+	src.entries[srv.URL].nextFetch = time.Time{}
+	crls2, err := src.ClientCRLs(caPEM)
+	require.NoError(t, err)
+	require.Equal(t, crls1, crls2)
+	require.Equal(t, int32(2), srv.requests.Load())
+
+	// new CRL is downloaded when due
+	srv.unavailable.Store(false)
+	srv.setCRL(t, bundle.ClientCRL.Name())
+	src.entries[srv.URL].nextFetch = time.Time{}
+	crls3, err := src.ClientCRLs(caPEM)
+	require.NoError(t, err)
+	require.NotEqual(t, crls1, crls3)
+}
+
+func TestClientCRLsParallelDownloads(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	caPEM, err := os.ReadFile(bundle.CACert.Name())
+	require.NoError(t, err)
+
+	srv := newCRLServer(t, bundle.CAEmptyCRL.Name())
+	release := make(chan struct{})
+	unreachable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer unreachable.Close()
+	defer close(release)
+
+	timeout := 300 * time.Millisecond
+	src := New(WithURLs(unreachable.URL+"/1.crl", unreachable.URL+"/2.crl", unreachable.URL+"/3.crl", srv.URL), WithTimeout(timeout)).(*crlSource)
+
+	var crls []byte
+	done := make(chan struct{})
+	start := time.Now()
+	go func() {
+		defer close(done)
+		crls, err = src.ClientCRLs(caPEM)
+	}()
+	// the source is not locked during the downloads
+	time.Sleep(timeout / 3)
+	nextRefresh := make(chan time.Time, 1)
+	go func() { nextRefresh <- src.NextRefresh() }()
+	select {
+	case <-nextRefresh:
+	case <-time.After(timeout / 3):
+		t.Fatal("NextRefresh is blocked by the downloads")
+	}
+	<-done
+	require.Less(t, time.Since(start), 2*timeout)
+	require.NoError(t, err)
+	require.NotEmpty(t, crls)
+}
+
+func TestClientCRLsRefreshedBySource(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	srv := newCRLServer(t, bundle.ClientCRL.Name())
+	srv.unavailable.Store(true)
+
+	// the unavailable CRL does not block the certificates
+	src := filesource.MustNew(
+		filesource.WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
+		filesource.WithClientAuthFile(bundle.CACert.Name()),
+		filesource.WithClientCRLSource(New(WithURLs(srv.URL), WithDistributionPoints(false), WithRetryInterval(100*time.Millisecond))),
+	)
+	store, err := servertls.NewServerCertsStore(t.Context(), slog.Default(), src)
+	require.NoError(t, err)
+	require.Empty(t, store.LoadServerCerts().ClientCRLs)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	ts.TLS = servertls.NewStoreServerConfig(slog.Default(), store)
+	ts.StartTLS()
+
+	// without refresh interval, the source retries the download on its own
+	srv.unavailable.Store(false)
+	require.Eventually(t, func() bool {
+		return len(store.LoadServerCerts().ClientCRLs) != 0
+	}, 3*time.Second, 20*time.Millisecond)
+
+	// nolint:bodyclose
+	_, err = bundle.NewHttpClient().Get(ts.URL)
+	require.Error(t, err)
+}
+
+func TestClientCRLsRefreshedAtNextUpdate(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	crlFile, err := os.CreateTemp(t.TempDir(), "crl-")
+	require.NoError(t, err)
+	defer crlFile.Close()
+	require.NoError(t, testutil.GenerateCRLWithValidity(bundle.CAX509Cert, bundle.CATLSCert.PrivateKey, nil, time.Now().Add(-time.Minute), time.Now().Add(300*time.Millisecond), crlFile))
+	srv := newCRLServer(t, crlFile.Name())
+
+	_, err = servertls.NewServerCertsStore(t.Context(), slog.Default(), filesource.MustNew(
+		filesource.WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
+		filesource.WithClientAuthFile(bundle.CACert.Name()),
+		filesource.WithClientCRLSource(New(WithURLs(srv.URL), WithDistributionPoints(false), WithRetryInterval(100*time.Millisecond))),
+	))
+	require.NoError(t, err)
+	require.Equal(t, int32(1), srv.requests.Load())
+	require.Eventually(t, func() bool {
+		return srv.requests.Load() >= 2
+	}, 3*time.Second, 20*time.Millisecond)
+}
+
+func TestClientCRLsValidation(t *testing.T) {
+	bundle1 := testutil.NewCertsBundle()
+	defer bundle1.Close()
+	bundle2 := testutil.NewCertsBundle()
+	defer bundle2.Close()
+
+	caPEM, err := os.ReadFile(bundle1.CACert.Name())
+	require.NoError(t, err)
+
+	// CRL is signed by an untrusted CA, it is left out and retried
+	srv := newCRLServer(t, bundle2.CAEmptyCRL.Name())
+	src := New(WithURLs(srv.URL))
+	crls, err := src.ClientCRLs(caPEM)
+	require.NoError(t, err)
+	require.Empty(t, crls)
+	require.WithinDuration(t, time.Now().Add(defaultRetryInterval), src.(*crlSource).NextRefresh(), time.Second)
+
+	_, err = New(WithDistributionPoints(false)).ClientCRLs(caPEM)
+	require.Error(t, err)
+
+	_, err = New(WithURLs(srv.URL)).ClientCRLs(nil)
+	require.Error(t, err)
+}
+
+func TestCRLDistributionPoints(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		CRLDistributionPoints: []string{"http://crl.example.com/ca.crl", "ldap://crl.example.com/ca.crl"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	urls, err := New(WithURLs("http://other.example.com/ca.crl", "http://crl.example.com/ca.crl")).(*crlSource).crlURLs(caPEM)
+	require.NoError(t, err)
+	require.Equal(t, []string{"http://other.example.com/ca.crl", "http://crl.example.com/ca.crl"}, urls)
+
+	urls, err = New().(*crlSource).crlURLs(caPEM)
+	require.NoError(t, err)
+	require.Equal(t, []string{"http://crl.example.com/ca.crl"}, urls)
+}
@@ -0,0 +1,55 @@
+package crlsource
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type Option func(*crlSource)
+
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *crlSource) {
+		c.logger = logger
+	}
+}
+
+// WithURLs adds explicit CRL URLs.
+func WithURLs(urls ...string) Option {
+	return func(c *crlSource) {
+		c.urls = append(c.urls, urls...)
+	}
+}
+
+// WithDistributionPoints enables or disables downloading from the CRL distribution points of the client CAs. Enabled by default.
+func WithDistributionPoints(enabled bool) Option {
+	return func(c *crlSource) {
+		c.distributionPoint = enabled
+	}
+}
+
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *crlSource) {
+		c.client = client
+	}
+}
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *crlSource) {
+		c.timeout = timeout
+	}
+}
+
+// WithMaxRefresh sets the maximum interval between downloads, used when the CRL NextUpdate is later or missing.
+func WithMaxRefresh(maxRefresh time.Duration) Option {
+	return func(c *crlSource) {
+		c.maxRefresh = maxRefresh
+	}
+}
+
+// WithRetryInterval sets the delay before a failed download is retried.
+func WithRetryInterval(retryInterval time.Duration) Option {
+	return func(c *crlSource) {
+		c.retryInterval = retryInterval
+	}
+}
@@ -0,0 +1,207 @@
+package dirsource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/grepplabs/cert-source/internal/datadir"
+	"github.com/grepplabs/cert-source/tls/keyutil"
+	tlscert "github.com/grepplabs/cert-source/tls/server/source"
+	"github.com/grepplabs/cert-source/tls/watcher"
+)
+
+const (
+	DefaultCertFileName = "tls.crt"
+	DefaultKeyFileName  = "tls.key"
+	DefaultCAFileName   = "ca.crt"
+)
+
+// dirSource loads server certificates from a directory, e.g. a mounted Kubernetes TLS secret.
+// When the directory contains the ..data symlink, all files are read from the same generation.
+type dirSource struct {
+	dir                   string
+	certFileName          string
+	keyFileName           string
+	keyPassword           string
+	clientAuthFileName    string
+	clientCRLFileName     string
+	clientCRLExpiryPolicy tlscert.CRLExpiryPolicy
+	clientCRLSource       tlscert.ClientCRLSource
+	refresh               time.Duration
+	fileWatch             bool
+	fileWatchDebounce     time.Duration
+	logger                *slog.Logger
+	notifyFunc            func()
+	errorFunc             func(error)
+	backoff               watcher.Backoff
+	status                watcher.Status
+	lastServerCerts       atomic.Pointer[tlscert.ServerCerts]
+}
+
+func New(opts ...Option) (tlscert.ServerCertsSource, error) {
+	s := &dirSource{
+		certFileName: DefaultCertFileName,
+		keyFileName:  DefaultKeyFileName,
+		logger:       slog.Default(),
+		backoff:      watcher.DefaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	lastServerCerts, err := s.getServerCerts()
+	if err != nil {
+		return nil, err
+	}
+	s.lastServerCerts.Store(lastServerCerts)
+	s.status.RecordSuccess()
+	return s, nil
+}
+
+func MustNew(opts ...Option) tlscert.ServerCertsSource {
+	serverSource, err := New(opts...)
+	if err != nil {
+		panic(`dirsource: New(): ` + err.Error())
+	}
+	return serverSource
+}
+
+// NewAll creates a source for every subdirectory of parentDir, e.g. one mounted secret per served host name.
+// The sources are ordered by subdirectory name; the options are applied to every source and WithDir is overridden.
+func NewAll(parentDir string, opts ...Option) ([]tlscert.ServerCertsSource, error) {
+	entries, err := os.ReadDir(parentDir)
+	if err != nil {
+		return nil, err
+	}
+	var sources []tlscert.ServerCertsSource
+	for _, entry := range entries {
+		dir := filepath.Join(parentDir, entry.Name())
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		// subdirectories can be symlinks, e.g. in projected volumes
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			continue
+		}
+		src, err := New(append(slices.Clip(opts), WithDir(dir))...)
+		if err != nil {
+			return nil, fmt.Errorf("cert dir source %s: %w", entry.Name(), err)
+		}
+		sources = append(sources, src)
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("cert dir source: no subdirectories found in %s", parentDir)
+	}
+	return sources, nil
+}
+
+func (s *dirSource) getServerCerts() (*tlscert.ServerCerts, error) {
+	pemBlocks, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+	serverCerts, err := tlscert.NewServerCerts(pemBlocks)
+	if err != nil {
+		return nil, err
+	}
+	serverCerts.CRLExpiryPolicy = s.clientCRLExpiryPolicy
+	return serverCerts, nil
+}
+
+func (s *dirSource) refreshServerCerts() (*tlscert.ServerCerts, error) {
+	serverCerts, err := s.getServerCerts()
+	if err != nil {
+		return nil, err
+	}
+	s.lastServerCerts.Store(serverCerts)
+	return serverCerts, nil
+}
+
+func (s *dirSource) ServerCerts(ctx context.Context) chan tlscert.ServerCerts {
+	initialServerCert := s.lastServerCerts.Load()
+	ch := make(chan tlscert.ServerCerts, 1)
+	if initialServerCert != nil {
+		ch <- *initialServerCert
+	}
+	if s.refresh <= 0 && !s.fileWatch && s.crlRefresher() == nil {
+		close(ch)
+	} else {
+		go func() {
+			watcher.WatchFilesEvents(ctx, s.logger, ch, s.refresh, s.watchedFiles(), s.fileWatchDebounce, initialServerCert, s.refreshServerCerts, s.notifyFunc, s.watchOptions()...)
+			close(ch)
+		}()
+	}
+	return ch
+}
+
+func (s *dirSource) Load() (*tlscert.ServerPEMs, error) {
+	if s.dir == "" {
+		return nil, errors.New("cert dir source: dir is required")
+	}
+	if s.certFileName == "" {
+		return nil, errors.New("cert dir source: certFileName is required")
+	}
+	if s.keyFileName == "" {
+		return nil, errors.New("cert dir source: keyFileName is required")
+	}
+	if s.clientAuthFileName == "" && s.clientCRLSource != nil {
+		return nil, errors.New("cert dir source: clientAuthFileName is required when clientCRLSource is provided")
+	}
+	if s.clientAuthFileName == "" && s.clientCRLFileName != "" {
+		return nil, errors.New("cert dir source: clientAuthFileName is required when clientCRLFileName is provided")
+	}
+	contents, err := datadir.ReadFiles(s.dir, s.certFileName, s.keyFileName, s.clientAuthFileName, s.clientCRLFileName)
+	if err != nil {
+		return nil, err
+	}
+	pemBlocks := &tlscert.ServerPEMs{
+		CertPEMBlock:       contents[0],
+		KeyPEMBlock:        contents[1],
+		ClientAuthPEMBlock: contents[2],
+		CRLPEMBlock:        contents[3],
+	}
+	if pemBlocks.KeyPEMBlock, err = keyutil.DecryptPrivateKeyPEM(pemBlocks.KeyPEMBlock, s.keyPassword); err != nil {
+		return nil, err
+	}
+	if s.clientCRLSource != nil {
+		clientCRLs, err := s.clientCRLSource.ClientCRLs(pemBlocks.ClientAuthPEMBlock)
+		if err != nil {
+			return nil, err
+		}
+		pemBlocks.CRLPEMBlock = append(pemBlocks.CRLPEMBlock, clientCRLs...)
+	}
+	return pemBlocks, nil
+}
+
+func (s *dirSource) watchedFiles() []string {
+	if !s.fileWatch {
+		return nil
+	}
+	return datadir.Paths(s.dir, s.certFileName, s.keyFileName, s.clientAuthFileName, s.clientCRLFileName)
+}
+
+// Status returns the status of the certificate loads.
+func (s *dirSource) Status() *watcher.Status {
+	return &s.status
+}
+
+func (s *dirSource) watchOptions() []watcher.Option {
+	opts := []watcher.Option{watcher.WithBackoff(s.backoff), watcher.WithErrorFunc(s.errorFunc), watcher.WithStatus(&s.status)}
+	if refresher := s.crlRefresher(); refresher != nil {
+		// downloaded CRLs are refreshed when due
+		opts = append(opts, watcher.WithReloadAt(refresher.NextRefresh))
+	}
+	return opts
+}
+
+func (s *dirSource) crlRefresher() tlscert.ClientCRLRefresher {
+	refresher, _ := s.clientCRLSource.(tlscert.ClientCRLRefresher)
+	return refresher
+}
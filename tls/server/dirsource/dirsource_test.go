@@ -0,0 +1,103 @@
+package dirsource
+
+import (
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/cert-source/internal/testutil"
+	servertls "github.com/grepplabs/cert-source/tls/server"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirSourceLoad(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	dir := t.TempDir()
+	require.NoError(t, bundle.WriteServerDataDir(dir))
+
+	_, err := New()
+	require.EqualError(t, err, "cert dir source: dir is required")
+
+	_, err = New(WithDir(dir), WithClientCRLFileName("ca.crl"))
+	require.EqualError(t, err, "cert dir source: clientAuthFileName is required when clientCRLFileName is provided")
+
+	_, err = New(WithDir(dir), WithClientAuthFileName("missing.crt"))
+	require.Error(t, err)
+
+	src, err := New(WithDir(dir), WithClientAuthFileName(DefaultCAFileName))
+	require.NoError(t, err)
+	certs := <-src.ServerCerts(t.Context())
+	require.Len(t, certs.Certificates, 1)
+	require.NotNil(t, certs.ClientCAs)
+	require.Equal(t, bundle.ServerX509Cert.SerialNumber, certs.Certificates[0].Leaf.SerialNumber)
+}
+
+func TestCertRotation(t *testing.T) {
+	bundle1 := testutil.NewCertsBundle()
+	defer bundle1.Close()
+
+	bundle2 := testutil.NewCertsBundle()
+	defer bundle2.Close()
+
+	dir := t.TempDir()
+	require.NoError(t, bundle1.WriteServerDataDir(dir))
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	rotatedCh := make(chan struct{}, 1)
+	notifyFunc := func() {
+		rotatedCh <- struct{}{}
+	}
+	source := MustNew(
+		WithDir(dir),
+		WithClientAuthFileName(DefaultCAFileName),
+		WithRefresh(1*time.Second),
+		WithNotifyFunc(notifyFunc),
+	)
+	ts.TLS = servertls.MustNewServerConfig(t.Context(), slog.Default(), source)
+	ts.StartTLS()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+	require.NoError(t, err)
+
+	resp, err := bundle1.NewHttpClient().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// swap the ..data symlink to a new generation
+	require.NoError(t, bundle2.WriteServerDataDir(dir))
+
+	select {
+	case <-rotatedCh:
+		t.Log("certificates were changed")
+		time.Sleep(100 * time.Millisecond)
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected certificate change notification")
+	}
+	// old client - bad certificate
+	// nolint:bodyclose
+	_, err = bundle1.NewHttpClient().Do(req)
+	require.Error(t, err)
+
+	var unknownAuthorityError x509.UnknownAuthorityError
+	require.ErrorAs(t, func() *url.Error {
+		target := &url.Error{}
+		_ = errors.As(err, &target)
+		return target
+	}().Err, &unknownAuthorityError)
+
+	// new client - success
+	resp, err = bundle2.NewHttpClient().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+}
@@ -0,0 +1,102 @@
+package dirsource
+
+import (
+	"log/slog"
+	"time"
+
+	tlscert "github.com/grepplabs/cert-source/tls/server/source"
+	"github.com/grepplabs/cert-source/tls/watcher"
+)
+
+type Option func(*dirSource)
+
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *dirSource) {
+		c.logger = logger
+	}
+}
+
+func WithDir(dir string) Option {
+	return func(c *dirSource) {
+		c.dir = dir
+	}
+}
+
+func WithX509KeyPairFileNames(certFileName, keyFileName string) Option {
+	return func(c *dirSource) {
+		c.certFileName = certFileName
+		c.keyFileName = keyFileName
+	}
+}
+
+func WithKeyPassword(keyPassword string) Option {
+	return func(c *dirSource) {
+		c.keyPassword = keyPassword
+	}
+}
+
+func WithClientAuthFileName(clientAuthFileName string) Option {
+	return func(c *dirSource) {
+		c.clientAuthFileName = clientAuthFileName
+	}
+}
+
+func WithClientCRLFileName(clientCRLFileName string) Option {
+	return func(c *dirSource) {
+		c.clientCRLFileName = clientCRLFileName
+	}
+}
+
+// WithClientCRLSource adds CRLs provided by the source, e.g. downloaded from CRL distribution points, to the client CRL file.
+func WithClientCRLSource(clientCRLSource tlscert.ClientCRLSource) Option {
+	return func(c *dirSource) {
+		c.clientCRLSource = clientCRLSource
+	}
+}
+
+// WithClientCRLExpiryPolicy sets how client certificates are handled when a client CRL is expired or not yet valid.
+func WithClientCRLExpiryPolicy(policy tlscert.CRLExpiryPolicy) Option {
+	return func(c *dirSource) {
+		c.clientCRLExpiryPolicy = policy
+	}
+}
+
+func WithRefresh(refresh time.Duration) Option {
+	return func(c *dirSource) {
+		c.refresh = refresh
+	}
+}
+
+func WithNotifyFunc(notifyFunc func()) Option {
+	return func(c *dirSource) {
+		c.notifyFunc = notifyFunc
+	}
+}
+
+// WithErrorFunc sets the function called with every reload error.
+func WithErrorFunc(errorFunc func(error)) Option {
+	return func(c *dirSource) {
+		c.errorFunc = errorFunc
+	}
+}
+
+// WithBackoff sets the retries of failed reloads. The default is watcher.DefaultBackoff.
+func WithBackoff(backoff watcher.Backoff) Option {
+	return func(c *dirSource) {
+		c.backoff = backoff
+	}
+}
+
+// WithFileWatch enables reloading on file system events. The refresh interval is kept as a polling fallback.
+func WithFileWatch(fileWatch bool) Option {
+	return func(c *dirSource) {
+		c.fileWatch = fileWatch
+	}
+}
+
+// WithFileWatchDebounce sets the quiet period after the last file system event before the certificates are reloaded.
+func WithFileWatchDebounce(debounce time.Duration) Option {
+	return func(c *dirSource) {
+		c.fileWatchDebounce = debounce
+	}
+}
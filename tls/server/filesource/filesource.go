@@ -1,7 +1,9 @@
 package filesource
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
@@ -19,20 +21,32 @@ const (
 )
 
 type fileSource struct {
-	certFile        string
-	keyFile         string
-	keyPassword     string
-	clientAuthFile  string
-	clientCRLFile   string
-	refresh         time.Duration
-	logger          *slog.Logger
-	notifyFunc      func()
-	lastServerCerts atomic.Pointer[tlscert.ServerCerts]
+	certFile              string
+	keyFile               string
+	x509KeyPair           bool
+	keyPassword           string
+	pkcs12File            string
+	pkcs12Password        string
+	pkcs12ClientCAs       bool
+	clientAuthFile        string
+	clientCRLFile         string
+	clientCRLExpiryPolicy tlscert.CRLExpiryPolicy
+	clientCRLSource       tlscert.ClientCRLSource
+	refresh               time.Duration
+	fileWatch             bool
+	fileWatchDebounce     time.Duration
+	logger                *slog.Logger
+	notifyFunc            func()
+	errorFunc             func(error)
+	backoff               watcher.Backoff
+	status                watcher.Status
+	lastServerCerts       atomic.Pointer[tlscert.ServerCerts]
 }
 
 func New(opts ...Option) (tlscert.ServerCertsSource, error) {
 	s := &fileSource{
-		logger: slog.Default(),
+		logger:  slog.Default(),
+		backoff: watcher.DefaultBackoff,
 	}
 	if dir, err := os.Getwd(); err == nil {
 		s.certFile = filepath.Join(dir, defaultCertFile)
@@ -48,6 +62,7 @@ func New(opts ...Option) (tlscert.ServerCertsSource, error) {
 		return nil, err
 	}
 	s.lastServerCerts.Store(lastServerCerts)
+	s.status.RecordSuccess()
 	return s, nil
 }
 
@@ -64,28 +79,12 @@ func (s *fileSource) getServerCerts() (*tlscert.ServerCerts, error) {
 	if err != nil {
 		return nil, err
 	}
-	certificates, err := pemBlocks.Certificates()
+	serverCerts, err := tlscert.NewServerCerts(pemBlocks)
 	if err != nil {
 		return nil, err
 	}
-	clientCAs, err := pemBlocks.ClientCAs()
-	if err != nil {
-		return nil, err
-	}
-	clientCRLs, err := pemBlocks.ClientCRLs()
-	if err != nil {
-		return nil, err
-	}
-	if err = pemBlocks.ValidateCRLs(); err != nil {
-		return nil, err
-	}
-	return &tlscert.ServerCerts{
-		Certificates:         certificates,
-		ClientCAs:            clientCAs,
-		ClientCRLs:           clientCRLs,
-		RevokedSerialNumbers: tlscert.NewRevokedSerialNumbers(clientCRLs),
-		Checksum:             pemBlocks.Checksum(),
-	}, nil
+	serverCerts.CRLExpiryPolicy = s.clientCRLExpiryPolicy
+	return serverCerts, nil
 }
 
 func (s *fileSource) refreshServerCerts() (*tlscert.ServerCerts, error) {
@@ -97,17 +96,17 @@ func (s *fileSource) refreshServerCerts() (*tlscert.ServerCerts, error) {
 	return serverCerts, nil
 }
 
-func (s *fileSource) ServerCerts() chan tlscert.ServerCerts {
+func (s *fileSource) ServerCerts(ctx context.Context) chan tlscert.ServerCerts {
 	initialServerCert := s.lastServerCerts.Load()
 	ch := make(chan tlscert.ServerCerts, 1)
 	if initialServerCert != nil {
 		ch <- *initialServerCert
 	}
-	if s.refresh <= 0 {
+	if s.refresh <= 0 && !s.fileWatch && s.crlRefresher() == nil {
 		close(ch)
 	} else {
 		go func() {
-			watcher.Watch(s.logger, ch, s.refresh, initialServerCert, s.refreshServerCerts, s.notifyFunc)
+			watcher.WatchFilesEvents(ctx, s.logger, ch, s.refresh, s.watchedFiles(), s.fileWatchDebounce, initialServerCert, s.refreshServerCerts, s.notifyFunc, s.watchOptions()...)
 			close(ch)
 		}()
 	}
@@ -115,32 +114,61 @@ func (s *fileSource) ServerCerts() chan tlscert.ServerCerts {
 }
 
 func (s *fileSource) Load() (*tlscert.ServerPEMs, error) {
-	if s.certFile == "" {
+	if s.certFile == "" && s.pkcs12File == "" {
 		return nil, errors.New("cert file source: certFile is required")
 	}
-	if s.keyFile == "" {
+	if s.keyFile == "" && s.pkcs12File == "" {
 		return nil, errors.New("cert file source: keyFile is required")
 	}
-	if s.clientAuthFile == "" && s.clientCRLFile != "" {
-		return nil, errors.New("cert file source: clientAuthFile is required when clientCRLFile is provided")
+	if s.pkcs12File != "" && s.x509KeyPair && (s.certFile != "" || s.keyFile != "") {
+		return nil, errors.New("cert file source: pkcs12File and certFile/keyFile are mutually exclusive")
 	}
-	pemBlocks := &tlscert.ServerPEMs{}
-	var err error
-	if pemBlocks.CertPEMBlock, err = s.readFile(s.certFile); err != nil {
-		return nil, err
+	hasClientCAs := s.clientAuthFile != "" || (s.pkcs12File != "" && s.pkcs12ClientCAs)
+	if !hasClientCAs && s.clientCRLSource != nil {
+		return nil, errors.New("cert file source: clientAuthFile is required when clientCRLSource is provided")
 	}
-	if pemBlocks.KeyPEMBlock, err = s.readFile(s.keyFile); err != nil {
-		return nil, err
+	if !hasClientCAs && s.clientCRLFile != "" {
+		return nil, errors.New("cert file source: clientAuthFile is required when clientCRLFile is provided")
 	}
-	if pemBlocks.KeyPEMBlock, err = keyutil.DecryptPrivateKeyPEM(pemBlocks.KeyPEMBlock, s.keyPassword); err != nil {
-		return nil, err
+	pemBlocks := &tlscert.ServerPEMs{}
+	var (
+		caPEMBlock []byte
+		err        error
+	)
+	if s.pkcs12File != "" {
+		if pemBlocks.CertPEMBlock, pemBlocks.KeyPEMBlock, caPEMBlock, err = s.readPKCS12File(); err != nil {
+			return nil, err
+		}
+	} else {
+		if pemBlocks.CertPEMBlock, err = s.readFile(s.certFile); err != nil {
+			return nil, err
+		}
+		if pemBlocks.KeyPEMBlock, err = s.readFile(s.keyFile); err != nil {
+			return nil, err
+		}
+		if pemBlocks.KeyPEMBlock, err = keyutil.DecryptPrivateKeyPEM(pemBlocks.KeyPEMBlock, s.keyPassword); err != nil {
+			return nil, err
+		}
 	}
 	if pemBlocks.ClientAuthPEMBlock, err = s.readFile(s.clientAuthFile); err != nil {
 		return nil, err
 	}
+	if s.pkcs12File != "" && s.pkcs12ClientCAs {
+		if len(caPEMBlock) == 0 {
+			return nil, fmt.Errorf("cert file source: %s has no self-signed CA certificate for the client CAs", s.pkcs12File)
+		}
+		pemBlocks.ClientAuthPEMBlock = append(pemBlocks.ClientAuthPEMBlock, caPEMBlock...)
+	}
 	if pemBlocks.CRLPEMBlock, err = s.readFile(s.clientCRLFile); err != nil {
 		return nil, err
 	}
+	if s.clientCRLSource != nil {
+		clientCRLs, err := s.clientCRLSource.ClientCRLs(pemBlocks.ClientAuthPEMBlock)
+		if err != nil {
+			return nil, err
+		}
+		pemBlocks.CRLPEMBlock = append(pemBlocks.CRLPEMBlock, clientCRLs...)
+	}
 	return pemBlocks, nil
 }
 
@@ -151,3 +179,44 @@ func (s *fileSource) readFile(name string) ([]byte, error) {
 	// nolint:gosec
 	return os.ReadFile(name)
 }
+
+func (s *fileSource) readPKCS12File() ([]byte, []byte, []byte, error) {
+	data, err := s.readFile(s.pkcs12File)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	certPEMBlock, keyPEMBlock, caPEMBlock, err := keyutil.PKCS12ToPEM(data, s.pkcs12Password)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("cert file source: decode %s: %w", s.pkcs12File, err)
+	}
+	return certPEMBlock, keyPEMBlock, caPEMBlock, nil
+}
+
+func (s *fileSource) watchedFiles() []string {
+	if !s.fileWatch {
+		return nil
+	}
+	if s.pkcs12File != "" {
+		return []string{s.pkcs12File, s.clientAuthFile, s.clientCRLFile}
+	}
+	return []string{s.certFile, s.keyFile, s.clientAuthFile, s.clientCRLFile}
+}
+
+// Status returns the status of the certificate loads.
+func (s *fileSource) Status() *watcher.Status {
+	return &s.status
+}
+
+func (s *fileSource) watchOptions() []watcher.Option {
+	opts := []watcher.Option{watcher.WithBackoff(s.backoff), watcher.WithErrorFunc(s.errorFunc), watcher.WithStatus(&s.status)}
+	if refresher := s.crlRefresher(); refresher != nil {
+		// downloaded CRLs are refreshed when due
+		opts = append(opts, watcher.WithReloadAt(refresher.NextRefresh))
+	}
+	return opts
+}
+
+func (s *fileSource) crlRefresher() tlscert.ClientCRLRefresher {
+	refresher, _ := s.clientCRLSource.(tlscert.ClientCRLRefresher)
+	return refresher
+}
@@ -1,21 +1,29 @@
 package filesource
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"io"
 	"log/slog"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/grepplabs/cert-source/internal/testutil"
 	tlsclient "github.com/grepplabs/cert-source/tls/client"
+	"github.com/grepplabs/cert-source/tls/keyutil"
 	servertls "github.com/grepplabs/cert-source/tls/server"
+	"github.com/grepplabs/cert-source/tls/watcher"
 	"github.com/stretchr/testify/require"
 )
 
@@ -36,7 +44,7 @@ func TestServerConfig(t *testing.T) {
 				return tlsclient.NewDefaultRoundTripper()
 			},
 			configFunc: func() *tls.Config {
-				return servertls.MustNewServerConfig(logger, MustNew(
+				return servertls.MustNewServerConfig(t.Context(), logger, MustNew(
 					WithLogger(logger),
 					WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
 				))
@@ -49,7 +57,7 @@ func TestServerConfig(t *testing.T) {
 				return tlsclient.NewDefaultRoundTripper(tlsclient.WithClientTLSSkipVerify(true))
 			},
 			configFunc: func() *tls.Config {
-				return servertls.MustNewServerConfig(logger, MustNew(
+				return servertls.MustNewServerConfig(t.Context(), logger, MustNew(
 					WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
 				))
 			},
@@ -60,7 +68,7 @@ func TestServerConfig(t *testing.T) {
 				return tlsclient.NewDefaultRoundTripper(tlsclient.WithRootCA(bundle.CAX509Cert))
 			},
 			configFunc: func() *tls.Config {
-				return servertls.MustNewServerConfig(logger, MustNew(
+				return servertls.MustNewServerConfig(t.Context(), logger, MustNew(
 					WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
 				))
 			},
@@ -71,7 +79,7 @@ func TestServerConfig(t *testing.T) {
 				return tlsclient.NewDefaultRoundTripper(tlsclient.WithSystemRootCA(bundle.CAX509Cert))
 			},
 			configFunc: func() *tls.Config {
-				return servertls.MustNewServerConfig(logger, MustNew(
+				return servertls.MustNewServerConfig(t.Context(), logger, MustNew(
 					WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
 				))
 			},
@@ -82,7 +90,7 @@ func TestServerConfig(t *testing.T) {
 				return tlsclient.NewDefaultRoundTripper(tlsclient.WithRootCA(bundle.CAX509Cert))
 			},
 			configFunc: func() *tls.Config {
-				return servertls.MustNewServerConfig(logger, MustNew(
+				return servertls.MustNewServerConfig(t.Context(), logger, MustNew(
 					WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
 					WithClientAuthFile(bundle.CACert.Name()),
 				))
@@ -95,7 +103,7 @@ func TestServerConfig(t *testing.T) {
 				return tlsclient.NewDefaultRoundTripper(tlsclient.WithRootCA(bundle.CAX509Cert), tlsclient.WithClientCertificate(bundle.ClientTLSCert))
 			},
 			configFunc: func() *tls.Config {
-				return servertls.MustNewServerConfig(logger, MustNew(
+				return servertls.MustNewServerConfig(t.Context(), logger, MustNew(
 					WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
 					WithClientAuthFile(bundle.CACert.Name()),
 				))
@@ -107,7 +115,7 @@ func TestServerConfig(t *testing.T) {
 				return tlsclient.NewDefaultRoundTripper(tlsclient.WithRootCA(bundle.CAX509Cert), tlsclient.WithClientCertificate(bundle.ClientTLSCert))
 			},
 			configFunc: func() *tls.Config {
-				return servertls.MustNewServerConfig(logger, MustNew(
+				return servertls.MustNewServerConfig(t.Context(), logger, MustNew(
 					WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
 					WithClientAuthFile(bundle.CACert.Name()),
 					WithClientCRLFile(bundle.CAEmptyCRL.Name()),
@@ -120,7 +128,7 @@ func TestServerConfig(t *testing.T) {
 				return tlsclient.NewDefaultRoundTripper(tlsclient.WithRootCA(bundle.CAX509Cert), tlsclient.WithClientCertificate(bundle.ClientTLSCert))
 			},
 			configFunc: func() *tls.Config {
-				return servertls.MustNewServerConfig(logger, MustNew(
+				return servertls.MustNewServerConfig(t.Context(), logger, MustNew(
 					WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
 					WithClientAuthFile(bundle.CACert.Name()),
 					WithClientCRLFile(bundle.ClientCRL.Name()),
@@ -190,7 +198,7 @@ func TestCertRotation(t *testing.T) {
 		WithNotifyFunc(notifyFunc),
 	).(*fileSource)
 
-	ts.TLS = servertls.MustNewServerConfig(slog.Default(), source)
+	ts.TLS = servertls.MustNewServerConfig(t.Context(), slog.Default(), source)
 	ts.StartTLS()
 
 	req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
@@ -231,3 +239,218 @@ func TestCertRotation(t *testing.T) {
 	require.NoError(t, err)
 	defer resp.Body.Close()
 }
+
+func TestCertRotationFileWatch(t *testing.T) {
+	bundle1 := testutil.NewCertsBundle()
+	defer bundle1.Close()
+
+	bundle2 := testutil.NewCertsBundle()
+	defer bundle2.Close()
+
+	rotatedCh := make(chan struct{}, 1)
+	source := MustNew(
+		WithX509KeyPair(bundle1.ServerCert.Name(), bundle1.ServerKey.Name()),
+		WithClientAuthFile(bundle1.CACert.Name()),
+		WithRefresh(1*time.Hour),
+		WithFileWatch(true),
+		WithFileWatchDebounce(50*time.Millisecond),
+		WithNotifyFunc(func() {
+			rotatedCh <- struct{}{}
+		}),
+	)
+	store, err := servertls.NewServerCertsStore(t.Context(), slog.Default(), source)
+	require.NoError(t, err)
+	require.Equal(t, bundle1.ServerX509Cert.SerialNumber, store.LoadServerCerts().Certificates[0].Leaf.SerialNumber)
+
+	require.NoError(t, os.Rename(bundle2.ServerCert.Name(), bundle1.ServerCert.Name()))
+	require.NoError(t, os.Rename(bundle2.ServerKey.Name(), bundle1.ServerKey.Name()))
+
+	select {
+	case <-rotatedCh:
+		t.Log("certificates were changed")
+		time.Sleep(100 * time.Millisecond)
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected certificate change notification")
+	}
+	require.Equal(t, bundle2.ServerX509Cert.SerialNumber, store.LoadServerCerts().Certificates[0].Leaf.SerialNumber)
+}
+
+func TestServerCertsContextCancel(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	source := MustNew(
+		WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
+		WithRefresh(1*time.Second),
+		WithFileWatch(true),
+	)
+	ctx, cancel := context.WithCancel(t.Context())
+	ch := source.ServerCerts(ctx)
+
+	_, ok := <-ch
+	require.True(t, ok)
+
+	cancel()
+	select {
+	case _, ok = <-ch:
+		require.False(t, ok)
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected server certs channel to be closed")
+	}
+
+	_, err := servertls.NewServerCertsStore(ctx, slog.Default(), source)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestLoadErrorStatus(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	keyPEMBlock, err := os.ReadFile(bundle.ServerKey.Name())
+	require.NoError(t, err)
+
+	errCh := make(chan error, 10)
+	source := MustNew(
+		WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
+		WithRefresh(1*time.Hour),
+		WithFileWatch(true),
+		WithFileWatchDebounce(50*time.Millisecond),
+		WithBackoff(watcher.Backoff{Initial: 50 * time.Millisecond}),
+		WithErrorFunc(func(err error) {
+			errCh <- err
+		}),
+	)
+	status := source.(watcher.StatusProvider).Status()
+	require.False(t, status.LastSuccess().IsZero())
+	_, err = servertls.NewServerCertsStore(t.Context(), slog.Default(), source)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(bundle.ServerKey.Name(), []byte("broken"), 0o600))
+	select {
+	case err = <-errCh:
+		require.Error(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected load error")
+	}
+	// the failed load is retried with the backoff
+	require.Eventually(t, func() bool {
+		return status.ConsecutiveFailures() >= 2
+	}, 3*time.Second, 20*time.Millisecond)
+	require.Error(t, status.LastError())
+
+	require.NoError(t, os.WriteFile(bundle.ServerKey.Name(), keyPEMBlock, 0o600))
+	require.Eventually(t, func() bool {
+		return status.ConsecutiveFailures() == 0
+	}, 3*time.Second, 20*time.Millisecond)
+	require.NoError(t, status.LastError())
+}
+
+func TestEncryptedEd25519Key(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, bundle.CAX509Cert, publicKey, bundle.CATLSCert.PrivateKey)
+	require.NoError(t, err)
+	keyPEMBlock, err := keyutil.MarshalPrivateKeyToPEM(privateKey)
+	require.NoError(t, err)
+	encryptedKeyPEMBlock, err := keyutil.EncryptPKCS8PrivateKeyPEM(keyPEMBlock, testutil.DefaultKeyPassword)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: keyutil.CertificateBlockType, Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, encryptedKeyPEMBlock, 0o600))
+
+	store, err := servertls.NewServerCertsStore(t.Context(), slog.Default(), MustNew(
+		WithX509KeyPair(certFile, keyFile),
+		WithKeyPassword(testutil.DefaultKeyPassword),
+	))
+	require.NoError(t, err)
+	require.Equal(t, privateKey, store.LoadServerCerts().Certificates[0].PrivateKey)
+}
+
+func TestPKCS12File(t *testing.T) {
+	bundle1 := testutil.NewCertsBundle()
+	defer bundle1.Close()
+
+	bundle2 := testutil.NewCertsBundle()
+	defer bundle2.Close()
+
+	dir := t.TempDir()
+	pkcs12File := filepath.Join(dir, "server.p12")
+	require.NoError(t, testutil.WritePKCS12File(pkcs12File, bundle1.ServerTLSCert, bundle1.CAX509Cert, testutil.DefaultKeyPassword))
+
+	_, err := New(WithPKCS12File(pkcs12File, "wrong"))
+	require.ErrorContains(t, err, "cert file source: decode")
+
+	_, err = New(
+		WithPKCS12File(pkcs12File, testutil.DefaultKeyPassword),
+		WithX509KeyPair(bundle1.ServerCert.Name(), bundle1.ServerKey.Name()),
+	)
+	require.ErrorContains(t, err, "mutually exclusive")
+
+	rotatedCh := make(chan struct{}, 1)
+	source := MustNew(
+		WithPKCS12File(pkcs12File, testutil.DefaultKeyPassword),
+		WithPKCS12ClientCAs(true),
+		WithRefresh(1*time.Hour),
+		WithFileWatch(true),
+		WithFileWatchDebounce(50*time.Millisecond),
+		WithNotifyFunc(func() {
+			rotatedCh <- struct{}{}
+		}),
+	)
+	store, err := servertls.NewServerCertsStore(t.Context(), slog.Default(), source)
+	require.NoError(t, err)
+	serverCerts := store.LoadServerCerts()
+	require.Equal(t, bundle1.ServerX509Cert.SerialNumber, serverCerts.Certificates[0].Leaf.SerialNumber)
+	require.NotNil(t, serverCerts.ClientCAs)
+	_, err = bundle1.ClientX509Cert.Verify(x509.VerifyOptions{Roots: serverCerts.ClientCAs, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	require.NoError(t, err)
+
+	tmpFile := filepath.Join(dir, "server.p12.tmp")
+	require.NoError(t, testutil.WritePKCS12File(tmpFile, bundle2.ServerTLSCert, bundle2.CAX509Cert, testutil.DefaultKeyPassword))
+	require.NoError(t, os.Rename(tmpFile, pkcs12File))
+
+	select {
+	case <-rotatedCh:
+		t.Log("certificates were changed")
+		time.Sleep(100 * time.Millisecond)
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected certificate change notification")
+	}
+	require.Equal(t, bundle2.ServerX509Cert.SerialNumber, store.LoadServerCerts().Certificates[0].Leaf.SerialNumber)
+}
+
+func TestPKCS12FileWithoutClientCAs(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	leaf, err := x509.ParseCertificate(bundle.ServerTLSCert.Certificate[0])
+	require.NoError(t, err)
+	data, err := keyutil.EncodePKCS12(bundle.ServerTLSCert.PrivateKey, leaf, nil, testutil.DefaultKeyPassword)
+	require.NoError(t, err)
+	pkcs12File := filepath.Join(t.TempDir(), "server.p12")
+	require.NoError(t, os.WriteFile(pkcs12File, data, 0o600))
+
+	_, err = New(WithPKCS12File(pkcs12File, testutil.DefaultKeyPassword))
+	require.NoError(t, err)
+
+	_, err = New(
+		WithPKCS12File(pkcs12File, testutil.DefaultKeyPassword),
+		WithPKCS12ClientCAs(true),
+		WithClientCRLFile(bundle.CAEmptyCRL.Name()),
+	)
+	require.ErrorContains(t, err, "has no self-signed CA certificate")
+}
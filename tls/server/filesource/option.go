@@ -3,6 +3,9 @@ package filesource
 import (
 	"log/slog"
 	"time"
+
+	tlscert "github.com/grepplabs/cert-source/tls/server/source"
+	"github.com/grepplabs/cert-source/tls/watcher"
 )
 
 type Option func(*fileSource)
@@ -17,6 +20,7 @@ func WithX509KeyPair(certFile, keyFile string) Option {
 	return func(c *fileSource) {
 		c.certFile = certFile
 		c.keyFile = keyFile
+		c.x509KeyPair = true
 	}
 }
 
@@ -26,6 +30,23 @@ func WithKeyPassword(keyPassword string) Option {
 	}
 }
 
+// WithPKCS12File loads the certificate, the chain and the private key from a PKCS#12 keystore instead of the PEM files.
+// It is mutually exclusive with WithX509KeyPair.
+func WithPKCS12File(pkcs12File, password string) Option {
+	return func(c *fileSource) {
+		c.pkcs12File = pkcs12File
+		c.pkcs12Password = password
+	}
+}
+
+// WithPKCS12ClientCAs adds the self-signed CA certificates of the PKCS#12 keystore to the client CAs, so client certificates are required.
+// Loading fails if the keystore has no self-signed CA certificate.
+func WithPKCS12ClientCAs(clientCAs bool) Option {
+	return func(c *fileSource) {
+		c.pkcs12ClientCAs = clientCAs
+	}
+}
+
 func WithClientAuthFile(clientAuthFile string) Option {
 	return func(c *fileSource) {
 		c.clientAuthFile = clientAuthFile
@@ -38,6 +59,20 @@ func WithClientCRLFile(clientCRLFile string) Option {
 	}
 }
 
+// WithClientCRLSource adds CRLs provided by the source, e.g. downloaded from CRL distribution points, to the client CRL file.
+func WithClientCRLSource(clientCRLSource tlscert.ClientCRLSource) Option {
+	return func(c *fileSource) {
+		c.clientCRLSource = clientCRLSource
+	}
+}
+
+// WithClientCRLExpiryPolicy sets how client certificates are handled when a client CRL is expired or not yet valid.
+func WithClientCRLExpiryPolicy(policy tlscert.CRLExpiryPolicy) Option {
+	return func(c *fileSource) {
+		c.clientCRLExpiryPolicy = policy
+	}
+}
+
 func WithRefresh(refresh time.Duration) Option {
 	return func(c *fileSource) {
 		c.refresh = refresh
@@ -49,3 +84,31 @@ func WithNotifyFunc(notifyFunc func()) Option {
 		c.notifyFunc = notifyFunc
 	}
 }
+
+// WithErrorFunc sets the function called with every reload error.
+func WithErrorFunc(errorFunc func(error)) Option {
+	return func(c *fileSource) {
+		c.errorFunc = errorFunc
+	}
+}
+
+// WithBackoff sets the retries of failed reloads. The default is watcher.DefaultBackoff.
+func WithBackoff(backoff watcher.Backoff) Option {
+	return func(c *fileSource) {
+		c.backoff = backoff
+	}
+}
+
+// WithFileWatch enables reloading on file system events. The refresh interval is kept as a polling fallback.
+func WithFileWatch(fileWatch bool) Option {
+	return func(c *fileSource) {
+		c.fileWatch = fileWatch
+	}
+}
+
+// WithFileWatchDebounce sets the quiet period after the last file system event before the certificates are reloaded.
+func WithFileWatchDebounce(debounce time.Duration) Option {
+	return func(c *fileSource) {
+		c.fileWatchDebounce = debounce
+	}
+}
@@ -0,0 +1,143 @@
+package tlsserver
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/grepplabs/cert-source/internal/conntrack"
+	"github.com/grepplabs/cert-source/tls/server/source"
+)
+
+// DefaultHandshakeTimeout is the default maximum duration of a TLS handshake.
+const DefaultHandshakeTimeout = 10 * time.Second
+
+type listener struct {
+	net.Listener
+	logger           *slog.Logger
+	config           *tls.Config
+	tlsOpts          []TLSServerConfigOption
+	handshakeTimeout time.Duration
+	closeRotated     bool
+	gracePeriod      time.Duration
+	conns            conntrack.Conns
+	unregister       func()
+}
+
+type ListenerOption func(*listener)
+
+func WithListenerLogger(logger *slog.Logger) ListenerOption {
+	return func(l *listener) {
+		l.logger = logger
+	}
+}
+
+func WithListenerTLSConfigOptions(opts ...TLSServerConfigOption) ListenerOption {
+	return func(l *listener) {
+		l.tlsOpts = append(l.tlsOpts, opts...)
+	}
+}
+
+// WithListenerHandshakeTimeout sets the maximum duration of the TLS handshake. Zero disables the timeout.
+func WithListenerHandshakeTimeout(timeout time.Duration) ListenerOption {
+	return func(l *listener) {
+		l.handshakeTimeout = timeout
+	}
+}
+
+// WithListenerCloseRotatedConns closes connections established with a server certificate which was rotated out.
+// The connections are closed with a TLS close notification after the grace period.
+func WithListenerCloseRotatedConns(gracePeriod time.Duration) ListenerOption {
+	return func(l *listener) {
+		l.closeRotated = true
+		l.gracePeriod = gracePeriod
+	}
+}
+
+// NewListener creates a TLS listener which accepts connections from the inner listener and
+// uses the current certificates of the store on every handshake.
+// With a handshake timeout, the handshake is started when the connection is accepted,
+// otherwise it is performed on the first Read or Write of the accepted connection.
+func NewListener(inner net.Listener, store *source.ServerCertsStore, opts ...ListenerOption) net.Listener {
+	l := &listener{
+		Listener:         inner,
+		logger:           slog.Default(),
+		handshakeTimeout: DefaultHandshakeTimeout,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	l.config = NewStoreServerConfig(l.logger, store, l.tlsOpts...)
+	if l.closeRotated {
+		l.unregister = store.OnRotation(l.onRotation)
+	}
+	return l
+}
+
+// Accept returns a *tls.Conn, so http.Server detects TLS and negotiates HTTP/2.
+// The handshake timeout is enforced by a handshake in the background, which closes the connection when it expires.
+// Deadlines set by the caller are not changed.
+func (l *listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	var tlsConn *tls.Conn
+	config := l.config
+	if l.closeRotated {
+		config = config.Clone()
+		getConfigForClient := config.GetConfigForClient
+		config.GetConfigForClient = func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+			x, err := getConfigForClient(info)
+			if err != nil || x == nil || len(x.Certificates) == 0 || len(x.Certificates[0].Certificate) == 0 {
+				return x, err
+			}
+			x = x.Clone()
+			leaf := x.Certificates[0].Certificate[0]
+			verifyConnection := x.VerifyConnection
+			x.VerifyConnection = func(state tls.ConnectionState) error {
+				if verifyConnection != nil {
+					if err := verifyConnection(state); err != nil {
+						return err
+					}
+				}
+				// closed connections are dropped when they are garbage collected
+				conntrack.AddWeak(&l.conns, tlsConn, leaf)
+				return nil
+			}
+			return x, nil
+		}
+	}
+	tlsConn = tls.Server(conn, config)
+	if l.handshakeTimeout > 0 {
+		// the caller waits for the result on its first Read, Write or Handshake
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), l.handshakeTimeout)
+			defer cancel()
+			_ = tlsConn.HandshakeContext(ctx)
+		}()
+	}
+	return tlsConn, nil
+}
+
+func (l *listener) Close() error {
+	if l.unregister != nil {
+		l.unregister()
+	}
+	return l.Listener.Close()
+}
+
+func (l *listener) onRotation(_, current source.ServerCerts) {
+	leaves := make([][]byte, 0, len(current.Certificates))
+	for _, cert := range current.Certificates {
+		if len(cert.Certificate) != 0 {
+			leaves = append(leaves, cert.Certificate[0])
+		}
+	}
+	if n := l.conns.CloseRotated(leaves, l.gracePeriod); n != 0 {
+		l.logger.Info(fmt.Sprintf("closing %d connections with rotated server certificate", n))
+	}
+}
@@ -0,0 +1,266 @@
+package tlsserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/cert-source/internal/testutil"
+	"github.com/grepplabs/cert-source/tls/server/filesource"
+	"github.com/grepplabs/cert-source/tls/server/source"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenerCloseRotatedConns(t *testing.T) {
+	bundle1 := testutil.NewCertsBundle()
+	defer bundle1.Close()
+	bundle2 := testutil.NewCertsBundle()
+	defer bundle2.Close()
+
+	store := newListenerStore(t, bundle1)
+	lis := startEchoListener(t, store, WithListenerCloseRotatedConns(0))
+
+	conn := dialEcho(t, lis.Addr().String(), bundle1.CAX509Cert)
+	defer conn.Close()
+
+	// unchanged server certificate keeps the connection
+	cs := store.LoadServerCerts()
+	cs.Checksum = []byte("rotated client CA")
+	store.SetServerCerts(cs)
+	requireEcho(t, conn)
+
+	store.SetServerCerts(newListenerStore(t, bundle2).LoadServerCerts())
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err := conn.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+
+	conn2 := dialEcho(t, lis.Addr().String(), bundle2.CAX509Cert)
+	defer conn2.Close()
+}
+
+func TestListenerHandshakeTimeout(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	lis := NewListener(inner, newListenerStore(t, bundle), WithListenerHandshakeTimeout(100*time.Millisecond))
+	defer lis.Close()
+
+	// client does not start the handshake
+	rawConn, err := net.Dial("tcp", lis.Addr().String())
+	require.NoError(t, err)
+	defer rawConn.Close()
+
+	conn, err := lis.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	start := time.Now()
+	_, err = conn.Read(make([]byte, 1))
+	require.Error(t, err)
+	require.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestListenerHandshakeTimeoutStalledClient(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	lis := NewListener(inner, newListenerStore(t, bundle), WithListenerHandshakeTimeout(100*time.Millisecond))
+	defer lis.Close()
+
+	// client sends the ClientHello and then goes silent, so the server waits for the client Finished
+	rawConn, err := net.Dial("tcp", lis.Addr().String())
+	require.NoError(t, err)
+	defer rawConn.Close()
+	conn, err := lis.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(bundle.CAX509Cert)
+	client := tls.Client(&stallingConn{Conn: rawConn}, &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		RootCAs:    rootCAs,
+		ServerName: "localhost",
+	})
+	require.NoError(t, client.Handshake())
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		readErr <- err
+	}()
+	select {
+	case err = <-readErr:
+		require.Error(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected handshake timeout")
+	}
+}
+
+func TestListenerHandshakeKeepsCallerDeadline(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	lis := NewListener(inner, newListenerStore(t, bundle), WithListenerHandshakeTimeout(5*time.Second))
+	defer lis.Close()
+
+	rawConn, err := net.Dial("tcp", lis.Addr().String())
+	require.NoError(t, err)
+	defer rawConn.Close()
+	conn, err := lis.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(500*time.Millisecond)))
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(bundle.CAX509Cert)
+	client := tls.Client(rawConn, &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    rootCAs,
+		ServerName: "localhost",
+	})
+	require.NoError(t, client.Handshake())
+
+	// the client sends no data, so the deadline of the caller expires
+	start := time.Now()
+	_, err = conn.Read(make([]byte, 1))
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	require.True(t, netErr.Timeout())
+	require.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestListenerHTTPServer(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	store, err := NewServerCertsStore(t.Context(), slog.Default(), filesource.MustNew(
+		filesource.WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
+		filesource.WithClientAuthFile(bundle.CACert.Name()),
+	))
+	require.NoError(t, err)
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	lis := NewListener(inner, store,
+		WithListenerTLSConfigOptions(WithTLSServerNextProtos([]string{"h2", "http/1.1"})),
+		WithListenerCloseRotatedConns(0),
+	)
+
+	type request struct {
+		protoMajor int
+		peerCerts  []*x509.Certificate
+	}
+	requests := make(chan request, 1)
+	server := &http.Server{
+		ReadHeaderTimeout: 5 * time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req := request{protoMajor: r.ProtoMajor}
+			if r.TLS != nil {
+				req.peerCerts = r.TLS.PeerCertificates
+			}
+			requests <- req
+			w.WriteHeader(http.StatusOK)
+		}),
+	}
+	go func() { _ = server.Serve(lis) }()
+	defer server.Close()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(bundle.CAX509Cert)
+	client := &http.Client{Transport: &http.Transport{
+		ForceAttemptHTTP2: true,
+		TLSClientConfig: &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			RootCAs:      rootCAs,
+			Certificates: []tls.Certificate{*bundle.ClientTLSCert},
+		},
+	}}
+	resp, err := client.Get("https://" + lis.Addr().String())
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, 2, resp.ProtoMajor)
+
+	req := <-requests
+	require.Equal(t, 2, req.protoMajor)
+	require.NotEmpty(t, req.peerCerts)
+	require.Equal(t, bundle.ClientX509Cert.SerialNumber, req.peerCerts[0].SerialNumber)
+}
+
+// stallingConn sends only the first write, e.g. the ClientHello, and drops the following ones.
+type stallingConn struct {
+	net.Conn
+	written bool
+}
+
+func (c *stallingConn) Write(b []byte) (int, error) {
+	if c.written {
+		return len(b), nil
+	}
+	c.written = true
+	return c.Conn.Write(b)
+}
+
+func newListenerStore(t *testing.T, bundle *testutil.CertsBundle) *source.ServerCertsStore {
+	t.Helper()
+	store, err := NewServerCertsStore(t.Context(), slog.Default(), filesource.MustNew(
+		filesource.WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
+	))
+	require.NoError(t, err)
+	return store
+}
+
+func startEchoListener(t *testing.T, store *source.ServerCertsStore, opts ...ListenerOption) net.Listener {
+	t.Helper()
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	lis := NewListener(inner, store, opts...)
+	t.Cleanup(func() { _ = lis.Close() })
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return lis
+}
+
+func dialEcho(t *testing.T, addr string, caCert *x509.Certificate) *tls.Conn {
+	t.Helper()
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(caCert)
+	conn, err := tls.Dial("tcp", addr, &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    rootCAs,
+		ServerName: "localhost",
+	})
+	require.NoError(t, err)
+	requireEcho(t, conn)
+	return conn
+}
+
+func requireEcho(t *testing.T, conn net.Conn) {
+	t.Helper()
+	_, err := conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(buf))
+}
@@ -0,0 +1,138 @@
+package multisource
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"log/slog"
+	"sync"
+
+	tlscert "github.com/grepplabs/cert-source/tls/server/source"
+)
+
+// multiSource combines certificates of several server sources, e.g. one per served host name.
+// Each source is watched independently; the merged certificates are sent whenever any of the sources rotates.
+// The first source provides the default certificate as well as the client CAs and CRLs;
+// if it closes without initial certs, no certs are sent and the load fails.
+type multiSource struct {
+	sources    []tlscert.ServerCertsSource
+	logger     *slog.Logger
+	notifyFunc func()
+}
+
+func New(opts ...Option) (tlscert.ServerCertsSource, error) {
+	s := &multiSource{
+		logger: slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if len(s.sources) == 0 {
+		return nil, errors.New("multi source: at least one source is required")
+	}
+	return s, nil
+}
+
+func MustNew(opts ...Option) tlscert.ServerCertsSource {
+	serverSource, err := New(opts...)
+	if err != nil {
+		panic(`multisource: New(): ` + err.Error())
+	}
+	return serverSource
+}
+
+type update struct {
+	index int
+	certs tlscert.ServerCerts
+}
+
+func (s *multiSource) ServerCerts(ctx context.Context) chan tlscert.ServerCerts {
+	ch := make(chan tlscert.ServerCerts, 1)
+	go func() {
+		defer close(ch)
+		s.run(ctx, ch)
+	}()
+	return ch
+}
+
+func (s *multiSource) run(ctx context.Context, ch chan tlscert.ServerCerts) {
+	latest := make([]*tlscert.ServerCerts, len(s.sources))
+	updates := make(chan update)
+
+	var wg sync.WaitGroup
+	for i, src := range s.sources {
+		srcChan := src.ServerCerts(ctx)
+		select {
+		case certs, ok := <-srcChan:
+			if !ok {
+				s.logger.Error("multi source: source closed without initial certs", slog.Int("index", i))
+				if i == 0 {
+					// the client CAs and CRLs must not be taken from another source
+					return
+				}
+				continue
+			}
+			latest[i] = &certs
+		case <-ctx.Done():
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for certs := range srcChan {
+				select {
+				case updates <- update{index: i, certs: certs}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(updates)
+	}()
+
+	initial := true
+	for {
+		merged, ok := merge(latest)
+		if ok {
+			select {
+			case ch <- merged:
+			case <-ctx.Done():
+				return
+			}
+			if !initial && s.notifyFunc != nil {
+				s.notifyFunc()
+			}
+			initial = false
+		}
+		u, more := <-updates
+		if !more {
+			return
+		}
+		latest[u.index] = &u.certs
+	}
+}
+
+func merge(latest []*tlscert.ServerCerts) (tlscert.ServerCerts, bool) {
+	if latest[0] == nil {
+		return tlscert.ServerCerts{}, false
+	}
+	merged := tlscert.ServerCerts{
+		ClientCAs:           latest[0].ClientCAs,
+		ClientCRLs:          latest[0].ClientCRLs,
+		CRLExpiryPolicy:     latest[0].CRLExpiryPolicy,
+		RevokedCertificates: latest[0].RevokedCertificates,
+	}
+	hash := sha256.New()
+	for _, certs := range latest {
+		if certs == nil {
+			continue
+		}
+		merged.Certificates = append(merged.Certificates, certs.Certificates...)
+		hash.Write(certs.Checksum)
+	}
+	merged.Checksum = hash.Sum(nil)
+	return merged, true
+}
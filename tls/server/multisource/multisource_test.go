@@ -0,0 +1,181 @@
+package multisource
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/cert-source/internal/testutil"
+	servertls "github.com/grepplabs/cert-source/tls/server"
+	"github.com/grepplabs/cert-source/tls/server/dirsource"
+	"github.com/grepplabs/cert-source/tls/server/filesource"
+	tlscert "github.com/grepplabs/cert-source/tls/server/source"
+	"github.com/stretchr/testify/require"
+)
+
+type namedPair struct {
+	certFile *os.File
+	keyFile  *os.File
+}
+
+func newNamedPair(t *testing.T, bundle *testutil.CertsBundle, dnsNames ...string) namedPair {
+	t.Helper()
+	dir := t.TempDir()
+	certFile, err := os.CreateTemp(dir, "cert-")
+	require.NoError(t, err)
+	defer certFile.Close()
+	keyFile, err := os.CreateTemp(dir, "key-")
+	require.NoError(t, err)
+	defer keyFile.Close()
+	_, _, err = testutil.GenerateServerCertWithNames(bundle.CATLSCert, dnsNames, certFile, keyFile)
+	require.NoError(t, err)
+	return namedPair{certFile: certFile, keyFile: keyFile}
+}
+
+func peerCertificate(t *testing.T, serverURL string, caCert *x509.Certificate, serverName string) *x509.Certificate {
+	t.Helper()
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(caCert)
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:    rootCAs,
+				ServerName: serverName,
+			},
+		},
+	}
+	resp, err := client.Get(serverURL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	return resp.TLS.PeerCertificates[0]
+}
+
+func TestSNICertificateSelection(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	defaultPair := newNamedPair(t, bundle, "default.example.com")
+	apiPair := newNamedPair(t, bundle, "api.example.com")
+	wildcardPair := newNamedPair(t, bundle, "*.example.com")
+
+	rotatedCh := make(chan struct{}, 1)
+	source := MustNew(
+		WithSources(
+			filesource.MustNew(filesource.WithX509KeyPair(wildcardPair.certFile.Name(), wildcardPair.keyFile.Name())),
+			filesource.MustNew(filesource.WithX509KeyPair(apiPair.certFile.Name(), apiPair.keyFile.Name()), filesource.WithRefresh(time.Second)),
+		),
+		WithDefaultSource(filesource.MustNew(filesource.WithX509KeyPair(defaultPair.certFile.Name(), defaultPair.keyFile.Name()))),
+		WithNotifyFunc(func() {
+			rotatedCh <- struct{}{}
+		}),
+	)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	ts.TLS = servertls.MustNewServerConfig(t.Context(), slog.Default(), source)
+	ts.StartTLS()
+
+	require.Equal(t, []string{"default.example.com"}, peerCertificate(t, ts.URL, bundle.CAX509Cert, "default.example.com").DNSNames)
+	require.Equal(t, []string{"api.example.com"}, peerCertificate(t, ts.URL, bundle.CAX509Cert, "api.example.com").DNSNames)
+	require.Equal(t, []string{"*.example.com"}, peerCertificate(t, ts.URL, bundle.CAX509Cert, "admin.example.com").DNSNames)
+
+	// rotate only the api pair
+	rotatedPair := newNamedPair(t, bundle, "api.example.com")
+	require.NoError(t, os.Rename(rotatedPair.certFile.Name(), apiPair.certFile.Name()))
+	require.NoError(t, os.Rename(rotatedPair.keyFile.Name(), apiPair.keyFile.Name()))
+
+	select {
+	case <-rotatedCh:
+		t.Log("certificates were changed")
+		time.Sleep(100 * time.Millisecond)
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected certificate change notification")
+	}
+	rotatedX509Cert, err := x509.ParseCertificate(mustReadCert(t, apiPair.certFile.Name()))
+	require.NoError(t, err)
+	require.Equal(t, rotatedX509Cert.SerialNumber, peerCertificate(t, ts.URL, bundle.CAX509Cert, "api.example.com").SerialNumber)
+	require.Equal(t, []string{"*.example.com"}, peerCertificate(t, ts.URL, bundle.CAX509Cert, "admin.example.com").DNSNames)
+}
+
+func TestDirSources(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	parentDir := t.TempDir()
+	for dir, name := range map[string]string{"a-default": "default.example.com", "b-api": "api.example.com"} {
+		pair := newNamedPair(t, bundle, name)
+		require.NoError(t, os.Mkdir(filepath.Join(parentDir, dir), 0o700))
+		require.NoError(t, testutil.WriteDataDir(filepath.Join(parentDir, dir), map[string][]byte{
+			dirsource.DefaultCertFileName: mustReadFile(t, pair.certFile.Name()),
+			dirsource.DefaultKeyFileName:  mustReadFile(t, pair.keyFile.Name()),
+		}))
+	}
+	sources, err := dirsource.NewAll(parentDir)
+	require.NoError(t, err)
+	require.Len(t, sources, 2)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	ts.TLS = servertls.MustNewServerConfig(t.Context(), slog.Default(), MustNew(WithSources(sources...)))
+	ts.StartTLS()
+
+	require.Equal(t, []string{"api.example.com"}, peerCertificate(t, ts.URL, bundle.CAX509Cert, "api.example.com").DNSNames)
+	require.Equal(t, []string{"default.example.com"}, peerCertificate(t, ts.URL, bundle.CAX509Cert, "default.example.com").DNSNames)
+}
+
+// closedSource closes its channel without initial certs, as a source failing its initial load.
+type closedSource struct{}
+
+func (closedSource) ServerCerts(_ context.Context) chan tlscert.ServerCerts {
+	ch := make(chan tlscert.ServerCerts)
+	close(ch)
+	return ch
+}
+
+func TestDefaultSourceClosedWithoutInitialCerts(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	apiPair := newNamedPair(t, bundle, "api.example.com")
+	source := MustNew(
+		WithSources(filesource.MustNew(
+			filesource.WithX509KeyPair(apiPair.certFile.Name(), apiPair.keyFile.Name()),
+			filesource.WithClientAuthFile(bundle.CACert.Name()),
+		)),
+		WithDefaultSource(closedSource{}),
+	)
+	// the client CAs of the other source must not be used instead
+	_, err := servertls.NewServerCertsStore(t.Context(), slog.Default(), source)
+	require.Error(t, err)
+}
+
+func TestNewWithoutSources(t *testing.T) {
+	_, err := New()
+	require.Error(t, err)
+}
+
+func mustReadFile(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+	return data
+}
+
+func mustReadCert(t *testing.T, name string) []byte {
+	t.Helper()
+	block, _ := pem.Decode(mustReadFile(t, name))
+	require.NotNil(t, block)
+	return block.Bytes
+}
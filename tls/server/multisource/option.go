@@ -0,0 +1,35 @@
+package multisource
+
+import (
+	"log/slog"
+
+	tlscert "github.com/grepplabs/cert-source/tls/server/source"
+)
+
+type Option func(*multiSource)
+
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *multiSource) {
+		c.logger = logger
+	}
+}
+
+// WithSources appends the sources. The first source overall provides the default certificate.
+func WithSources(sources ...tlscert.ServerCertsSource) Option {
+	return func(c *multiSource) {
+		c.sources = append(c.sources, sources...)
+	}
+}
+
+// WithDefaultSource prepends the source, so its certificate is used when no certificate matches the SNI server name.
+func WithDefaultSource(source tlscert.ServerCertsSource) Option {
+	return func(c *multiSource) {
+		c.sources = append([]tlscert.ServerCertsSource{source}, c.sources...)
+	}
+}
+
+func WithNotifyFunc(notifyFunc func()) Option {
+	return func(c *multiSource) {
+		c.notifyFunc = notifyFunc
+	}
+}
@@ -0,0 +1,86 @@
+package tlsserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	ocspRequestContentType  = "application/ocsp-request"
+	ocspResponseContentType = "application/ocsp-response"
+	ocspMaxResponseSize     = 1 << 20
+	defaultOCSPTimeout      = 10 * time.Second
+)
+
+// fetchOCSP queries the OCSP responder for the status of cert issued by issuer.
+func fetchOCSP(ctx context.Context, client *http.Client, responderURL string, cert, issuer *x509.Certificate) (*ocsp.Response, []byte, error) {
+	reqBytes, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ocsp: create request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, responderURL, bytes.NewReader(reqBytes))
+	if err != nil {
+		return nil, nil, fmt.Errorf("ocsp: create http request: %w", err)
+	}
+	req.Header.Set("Content-Type", ocspRequestContentType)
+	req.Header.Set("Accept", ocspResponseContentType)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ocsp: request %s: %w", responderURL, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("ocsp: responder %s returned status %d", responderURL, resp.StatusCode)
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, ocspMaxResponseSize))
+	if err != nil {
+		return nil, nil, fmt.Errorf("ocsp: read response: %w", err)
+	}
+	parsed, err := ocsp.ParseResponseForCert(raw, cert, issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ocsp: parse response: %w", err)
+	}
+	return parsed, raw, nil
+}
+
+// leafAndIssuer returns the parsed leaf and its issuer from the certificate chain.
+func leafAndIssuer(cert *tls.Certificate) (*x509.Certificate, *x509.Certificate, error) {
+	if len(cert.Certificate) < 2 {
+		return nil, nil, errors.New("ocsp: certificate chain does not contain the issuer")
+	}
+	leaf := cert.Leaf
+	if leaf == nil {
+		var err error
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, nil, err
+		}
+	}
+	issuer, err := x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	return leaf, issuer, nil
+}
+
+// ocspRefreshTime returns the time at which the response should be refreshed: halfway through its validity.
+func ocspRefreshTime(resp *ocsp.Response, defaultValidity time.Duration) time.Time {
+	if resp.NextUpdate.IsZero() {
+		return resp.ThisUpdate.Add(defaultValidity)
+	}
+	return resp.ThisUpdate.Add(resp.NextUpdate.Sub(resp.ThisUpdate) / 2)
+}
+
+func ocspCacheKey(cert, issuer *x509.Certificate) string {
+	return string(issuer.RawSubject) + "/" + string(issuer.SubjectKeyId) + "/" + string(cert.SerialNumber.Bytes())
+}
@@ -0,0 +1,221 @@
+package tlsserver
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/grepplabs/cert-source/tls/keyutil"
+	"golang.org/x/crypto/ocsp"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultOCSPGoodTTL    = 1 * time.Hour
+	defaultOCSPRevokedTTL = 24 * time.Hour
+	ocspVerifierMaxCache  = 10000
+)
+
+// OCSPFailurePolicy defines how client certificates are handled when their OCSP status cannot be determined.
+type OCSPFailurePolicy int
+
+const (
+	// OCSPSoftFail accepts the client certificate when the responder is unreachable or the status is unknown.
+	OCSPSoftFail OCSPFailurePolicy = iota
+	// OCSPHardFail rejects the client certificate when the responder is unreachable or the status is unknown.
+	OCSPHardFail
+)
+
+// OCSPVerifier checks the revocation status of client and intermediate CA certificates with their OCSP responder.
+// It is used with WithTLSServerVerifyPeerCertificate and can be combined with the CRL check.
+type OCSPVerifier struct {
+	logger        *slog.Logger
+	client        *http.Client
+	responderURL  string
+	failurePolicy OCSPFailurePolicy
+	goodTTL       time.Duration
+	revokedTTL    time.Duration
+	timeout       time.Duration
+
+	mu    sync.Mutex
+	cache map[string]ocspVerifierEntry
+	group singleflight.Group
+}
+
+type ocspVerifierEntry struct {
+	status  int
+	expires time.Time
+}
+
+type OCSPVerifierOption func(*OCSPVerifier)
+
+func WithOCSPVerifierHTTPClient(client *http.Client) OCSPVerifierOption {
+	return func(v *OCSPVerifier) {
+		v.client = client
+	}
+}
+
+// WithOCSPVerifierResponderURL overrides the responder URL from the certificate authority information access extension.
+// It is used for the client and the intermediate CA certificates.
+func WithOCSPVerifierResponderURL(responderURL string) OCSPVerifierOption {
+	return func(v *OCSPVerifier) {
+		v.responderURL = responderURL
+	}
+}
+
+func WithOCSPVerifierFailurePolicy(failurePolicy OCSPFailurePolicy) OCSPVerifierOption {
+	return func(v *OCSPVerifier) {
+		v.failurePolicy = failurePolicy
+	}
+}
+
+// WithOCSPVerifierGoodTTL sets the maximum caching time of good answers. The response NextUpdate is honored if earlier.
+func WithOCSPVerifierGoodTTL(goodTTL time.Duration) OCSPVerifierOption {
+	return func(v *OCSPVerifier) {
+		v.goodTTL = goodTTL
+	}
+}
+
+// WithOCSPVerifierRevokedTTL sets the caching time of revoked answers.
+func WithOCSPVerifierRevokedTTL(revokedTTL time.Duration) OCSPVerifierOption {
+	return func(v *OCSPVerifier) {
+		v.revokedTTL = revokedTTL
+	}
+}
+
+// WithOCSPVerifierTimeout sets the timeout of a single OCSP request done during the handshake.
+func WithOCSPVerifierTimeout(timeout time.Duration) OCSPVerifierOption {
+	return func(v *OCSPVerifier) {
+		v.timeout = timeout
+	}
+}
+
+func NewOCSPVerifier(logger *slog.Logger, opts ...OCSPVerifierOption) *OCSPVerifier {
+	v := &OCSPVerifier{
+		logger:     logger,
+		client:     http.DefaultClient,
+		goodTTL:    defaultOCSPGoodTTL,
+		revokedTTL: defaultOCSPRevokedTTL,
+		timeout:    defaultOCSPTimeout,
+		cache:      make(map[string]ocspVerifierEntry),
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// VerifyPeerCertificate checks the OCSP status of the client certificate and the intermediate CA certificates
+// of every verified chain. Intermediate CA certificates without a responder URL are not checked.
+func (v *OCSPVerifier) VerifyPeerCertificate(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+	for _, chain := range verifiedChains {
+		// the root of the chain is trusted
+		for i := 0; i < len(chain)-1; i++ {
+			if err := v.verify(chain[i], chain[i+1], i > 0); err != nil {
+				v.logger.Debug(err.Error())
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v *OCSPVerifier) verify(cert, issuer *x509.Certificate, intermediate bool) error {
+	kind := "client certificate"
+	if intermediate {
+		kind = "intermediate certificate"
+	}
+	responderURL := v.responderURL
+	if responderURL == "" && len(cert.OCSPServer) != 0 {
+		responderURL = cert.OCSPServer[0]
+	}
+	if responderURL == "" && intermediate {
+		return nil
+	}
+	serial := keyutil.GetHexFormatted(cert.SerialNumber.Bytes(), ":")
+	status, err := v.status(cert, issuer, responderURL)
+	if err != nil {
+		if v.failurePolicy == OCSPHardFail {
+			return fmt.Errorf("%s %s OCSP check failed: %w", kind, serial, err)
+		}
+		v.logger.Warn(kind+" OCSP check failed, soft-fail", slog.String("serial", serial), slog.String("error", err.Error()))
+		return nil
+	}
+	switch status {
+	case ocsp.Good:
+		return nil
+	case ocsp.Revoked:
+		return fmt.Errorf("%s %s was revoked", kind, serial)
+	default:
+		if v.failurePolicy == OCSPHardFail {
+			return fmt.Errorf("%s %s OCSP status is unknown", kind, serial)
+		}
+		v.logger.Warn(kind+" OCSP status is unknown, soft-fail", slog.String("serial", serial))
+		return nil
+	}
+}
+
+func (v *OCSPVerifier) status(cert, issuer *x509.Certificate, responderURL string) (int, error) {
+	key := ocspCacheKey(cert, issuer)
+
+	v.mu.Lock()
+	entry, ok := v.cache[key]
+	v.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.status, nil
+	}
+	if responderURL == "" {
+		return ocsp.Unknown, errors.New("no OCSP responder URL")
+	}
+	// concurrent handshakes with the same uncached certificate share one request
+	status, err, _ := v.group.Do(key, func() (any, error) {
+		return v.fetch(key, cert, issuer, responderURL)
+	})
+	if err != nil {
+		return ocsp.Unknown, err
+	}
+	// nolint:forcetypeassert
+	return status.(int), nil
+}
+
+func (v *OCSPVerifier) fetch(key string, cert, issuer *x509.Certificate, responderURL string) (int, error) {
+	now := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), v.timeout)
+	defer cancel()
+	resp, _, err := fetchOCSP(ctx, v.client, responderURL, cert, issuer)
+	if err != nil {
+		return ocsp.Unknown, err
+	}
+	var expires time.Time
+	switch resp.Status {
+	case ocsp.Good:
+		expires = now.Add(v.goodTTL)
+		if !resp.NextUpdate.IsZero() && resp.NextUpdate.Before(expires) {
+			expires = resp.NextUpdate
+		}
+	case ocsp.Revoked:
+		expires = now.Add(v.revokedTTL)
+	default:
+		return resp.Status, nil
+	}
+	v.store(key, ocspVerifierEntry{status: resp.Status, expires: expires}, now)
+	return resp.Status, nil
+}
+
+func (v *OCSPVerifier) store(key string, entry ocspVerifierEntry, now time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.cache) >= ocspVerifierMaxCache {
+		for k, e := range v.cache {
+			if !now.Before(e.expires) {
+				delete(v.cache, k)
+			}
+		}
+	}
+	v.cache[key] = entry
+}
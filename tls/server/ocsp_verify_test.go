@@ -0,0 +1,215 @@
+package tlsserver
+
+import (
+	"bytes"
+	"crypto/x509"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/cert-source/internal/testutil"
+	"github.com/grepplabs/cert-source/tls/server/filesource"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestOCSPVerifier(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	responder := testutil.NewOCSPResponder(bundle.CATLSCert, bundle.CAX509Cert)
+	defer responder.Close()
+
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	tests := []struct {
+		name         string
+		revoked      bool
+		responderURL string
+		policy       OCSPFailurePolicy
+		withCRL      bool
+		requestError bool
+	}{
+		{
+			name:         "good",
+			responderURL: responder.URL,
+		},
+		{
+			name:         "revoked",
+			revoked:      true,
+			responderURL: responder.URL,
+			requestError: true,
+		},
+		{
+			name:         "responder unavailable soft-fail",
+			responderURL: unavailable.URL,
+			policy:       OCSPSoftFail,
+		},
+		{
+			name:         "responder unavailable hard-fail",
+			responderURL: unavailable.URL,
+			policy:       OCSPHardFail,
+			requestError: true,
+		},
+		{
+			name:         "no responder hard-fail",
+			policy:       OCSPHardFail,
+			requestError: true,
+		},
+		{
+			name:         "good with revoked CRL",
+			responderURL: responder.URL,
+			withCRL:      true,
+			requestError: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.revoked {
+				responder.Revoke(bundle.ClientX509Cert.SerialNumber)
+				defer responder.Unrevoke(bundle.ClientX509Cert.SerialNumber)
+			}
+			fileOpts := []filesource.Option{
+				filesource.WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
+				filesource.WithClientAuthFile(bundle.CACert.Name()),
+			}
+			if tc.withCRL {
+				fileOpts = append(fileOpts, filesource.WithClientCRLFile(bundle.ClientCRL.Name()))
+			}
+			verifier := NewOCSPVerifier(slog.Default(),
+				WithOCSPVerifierResponderURL(tc.responderURL),
+				WithOCSPVerifierFailurePolicy(tc.policy),
+			)
+			ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer ts.Close()
+			ts.TLS = MustNewServerConfig(t.Context(), slog.Default(), filesource.MustNew(fileOpts...),
+				WithTLSServerVerifyPeerCertificate(verifier.VerifyPeerCertificate),
+			)
+			ts.StartTLS()
+
+			resp, err := bundle.NewHttpClient().Get(ts.URL)
+			if tc.requestError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+		})
+	}
+}
+
+func TestOCSPVerifierCache(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	responder := testutil.NewOCSPResponder(bundle.CATLSCert, bundle.CAX509Cert)
+	defer responder.Close()
+
+	verifier := NewOCSPVerifier(slog.Default(), WithOCSPVerifierResponderURL(responder.URL))
+	require.NoError(t, verifier.verify(bundle.ClientX509Cert, bundle.CAX509Cert, false))
+	require.NoError(t, verifier.verify(bundle.ClientX509Cert, bundle.CAX509Cert, false))
+	require.Equal(t, int32(1), responder.Requests.Load())
+
+	// cached good answer is served until it expires
+	responder.Revoke(bundle.ClientX509Cert.SerialNumber)
+	require.NoError(t, verifier.verify(bundle.ClientX509Cert, bundle.CAX509Cert, false))
+
+	verifier = NewOCSPVerifier(slog.Default(), WithOCSPVerifierResponderURL(responder.URL), WithOCSPVerifierGoodTTL(0))
+	require.Error(t, verifier.verify(bundle.ClientX509Cert, bundle.CAX509Cert, false))
+	require.Error(t, verifier.verify(bundle.ClientX509Cert, bundle.CAX509Cert, false))
+	require.Equal(t, int32(2), responder.Requests.Load())
+}
+
+func TestOCSPVerifierIntermediateCA(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	dir := t.TempDir()
+	intermediateCertFile, intermediateKeyFile := createTempPair(t, dir)
+	intermediateTLSCert, intermediateX509Cert, err := testutil.GenerateIntermediateCA(bundle.CATLSCert, intermediateCertFile, intermediateKeyFile)
+	require.NoError(t, err)
+	leafCertFile, leafKeyFile := createTempPair(t, dir)
+	_, leafX509Cert, err := testutil.GenerateCert(intermediateTLSCert, true, leafCertFile, leafKeyFile)
+	require.NoError(t, err)
+
+	// the root CA answers for the intermediate CA and the intermediate CA for the client certificate
+	rootResponder := testutil.NewOCSPResponder(bundle.CATLSCert, bundle.CAX509Cert)
+	defer rootResponder.Close()
+	intermediateResponder := testutil.NewOCSPResponder(intermediateTLSCert, intermediateX509Cert)
+	defer intermediateResponder.Close()
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		target := intermediateResponder.URL
+		if req, err := ocsp.ParseRequest(body); err == nil && req.SerialNumber.Cmp(intermediateX509Cert.SerialNumber) == 0 {
+			target = rootResponder.URL
+		}
+		resp, err := http.Post(target, r.Header.Get("Content-Type"), bytes.NewReader(body))
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(w, resp.Body)
+	}))
+	defer responder.Close()
+
+	chains := [][]*x509.Certificate{{leafX509Cert, intermediateX509Cert, bundle.CAX509Cert}}
+	verifier := NewOCSPVerifier(slog.Default(), WithOCSPVerifierResponderURL(responder.URL), WithOCSPVerifierFailurePolicy(OCSPHardFail))
+	require.NoError(t, verifier.VerifyPeerCertificate(nil, chains))
+	require.Equal(t, int32(1), rootResponder.Requests.Load())
+	require.Equal(t, int32(1), intermediateResponder.Requests.Load())
+
+	rootResponder.Revoke(intermediateX509Cert.SerialNumber)
+	verifier = NewOCSPVerifier(slog.Default(), WithOCSPVerifierResponderURL(responder.URL))
+	require.ErrorContains(t, verifier.VerifyPeerCertificate(nil, chains), "intermediate certificate")
+
+	// intermediate CA certificates without a responder URL are not checked
+	verifier = NewOCSPVerifier(slog.Default(), WithOCSPVerifierFailurePolicy(OCSPHardFail))
+	require.ErrorContains(t, verifier.VerifyPeerCertificate(nil, chains), "client certificate")
+	require.NoError(t, verifier.verify(intermediateX509Cert, bundle.CAX509Cert, true))
+}
+
+func TestOCSPVerifierConcurrentRequests(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	responder := testutil.NewOCSPResponder(bundle.CATLSCert, bundle.CAX509Cert)
+	defer responder.Close()
+	slowResponder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		resp, err := http.Post(responder.URL, r.Header.Get("Content-Type"), r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(w, resp.Body)
+	}))
+	defer slowResponder.Close()
+
+	verifier := NewOCSPVerifier(slog.Default(), WithOCSPVerifierResponderURL(slowResponder.URL), WithOCSPVerifierFailurePolicy(OCSPHardFail))
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- verifier.verify(bundle.ClientX509Cert, bundle.CAX509Cert, false)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(1), responder.Requests.Load())
+}
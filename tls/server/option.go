@@ -3,6 +3,8 @@ package tlsserver
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"fmt"
+	"strings"
 )
 
 type TLSServerConfigOption func(*tls.Config)
@@ -38,6 +40,33 @@ func WithTLSServerCipherSuites(cipherSuites []uint16) TLSServerConfigOption {
 	}
 }
 
+// WithTLSServerClientAuth sets the client authentication mode.
+// By default, client certificates are required and verified when client CAs are configured.
+func WithTLSServerClientAuth(clientAuth tls.ClientAuthType) TLSServerConfigOption {
+	return func(c *tls.Config) {
+		c.ClientAuth = clientAuth
+	}
+}
+
+// ParseClientAuthType parses the name of a client authentication mode.
+// Supported names are none, request, require-any, verify-if-given and require-and-verify.
+func ParseClientAuthType(name string) (tls.ClientAuthType, error) {
+	switch strings.ToLower(name) {
+	case "none":
+		return tls.NoClientCert, nil
+	case "request":
+		return tls.RequestClientCert, nil
+	case "require-any":
+		return tls.RequireAnyClientCert, nil
+	case "verify-if-given":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require-and-verify":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("unknown client auth type: %q", name)
+	}
+}
+
 type VerifyPeerCertificateFunc func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error
 
 // WithTLSServerVerifyPeerCertificate sets or chains a custom VerifyPeerCertificate function on a *tls.Config.
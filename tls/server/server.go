@@ -1,11 +1,13 @@
 package tlsserver
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
 	"fmt"
 	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"github.com/grepplabs/cert-source/tls/keyutil"
@@ -13,12 +15,13 @@ import (
 )
 
 const (
-	initLoadTimeout = 5 * time.Second
+	initLoadTimeout    = 5 * time.Second
+	crlWarningInterval = 1 * time.Minute
 )
 
 // MustNewServerConfig is like NewServerConfig but panics if the config cannot be created.
-func MustNewServerConfig(logger *slog.Logger, src source.ServerCertsSource, opts ...TLSServerConfigOption) *tls.Config {
-	c, err := NewServerConfig(logger, src, opts...)
+func MustNewServerConfig(ctx context.Context, logger *slog.Logger, src source.ServerCertsSource, opts ...TLSServerConfigOption) *tls.Config {
+	c, err := NewServerConfig(ctx, logger, src, opts...)
 	if err != nil {
 		panic(`tls: NewServerConfig(): ` + err.Error())
 	}
@@ -26,11 +29,24 @@ func MustNewServerConfig(logger *slog.Logger, src source.ServerCertsSource, opts
 }
 
 // NewServerConfig provides new server TLS configuration.
-func NewServerConfig(logger *slog.Logger, src source.ServerCertsSource, opts ...TLSServerConfigOption) (*tls.Config, error) {
-	store, err := NewServerCertsStore(logger, src)
+// The certificates are rotated until ctx is done.
+func NewServerConfig(ctx context.Context, logger *slog.Logger, src source.ServerCertsSource, opts ...TLSServerConfigOption) (*tls.Config, error) {
+	return NewServerConfigWithStoreOptions(ctx, logger, src, nil, opts...)
+}
+
+// NewServerConfigWithStoreOptions is like NewServerConfig, but creates the store with the store options, e.g. validators.
+func NewServerConfigWithStoreOptions(ctx context.Context, logger *slog.Logger, src source.ServerCertsSource, storeOpts []source.ServerCertsStoreOption, opts ...TLSServerConfigOption) (*tls.Config, error) {
+	store, err := NewServerCertsStore(ctx, logger, src, storeOpts...)
 	if err != nil {
 		return nil, err
 	}
+	return NewStoreServerConfig(logger, store, opts...), nil
+}
+
+// NewStoreServerConfig provides new server TLS configuration using the current certificates of the store on every handshake.
+func NewStoreServerConfig(logger *slog.Logger, store *source.ServerCertsStore, opts ...TLSServerConfigOption) *tls.Config {
+	// shared by all handshakes, so the stale CRL warnings are throttled per config
+	verifyFunc := verifyClientCertificate(logger, store)
 	// nolint:gosec // G402: TLS MinVersion too low - MinVersion can be changes with WithTLSServerMinVersion option
 	tlsConfig := tls.Config{
 		GetConfigForClient: func(info *tls.ClientHelloInfo) (*tls.Config, error) {
@@ -39,10 +55,13 @@ func NewServerConfig(logger *slog.Logger, src source.ServerCertsSource, opts ...
 				MinVersion:   tls.VersionTLS12,
 				Certificates: cs.Certificates,
 			}
+			if len(cs.Certificates) > 1 {
+				x.Certificates = []tls.Certificate{selectCertificate(cs.Certificates, info.ServerName)}
+			}
 			if cs.ClientCAs != nil {
 				x.ClientCAs = cs.ClientCAs
 				x.ClientAuth = tls.RequireAndVerifyClientCert
-				x.VerifyPeerCertificate = verifyClientCertificate(logger, store)
+				x.VerifyPeerCertificate = verifyFunc
 			}
 			for _, opt := range opts {
 				opt(x)
@@ -56,52 +75,136 @@ func NewServerConfig(logger *slog.Logger, src source.ServerCertsSource, opts ...
 	if cs.ClientCAs != nil {
 		tlsConfig.ClientCAs = cs.ClientCAs
 		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
-		tlsConfig.VerifyPeerCertificate = verifyClientCertificate(logger, store)
+		tlsConfig.VerifyPeerCertificate = verifyFunc
 	}
 	for _, opt := range opts {
 		opt(&tlsConfig)
 	}
-	return &tlsConfig, nil
+	return &tlsConfig
 }
 
-func NewServerCertsStore(logger *slog.Logger, src source.ServerCertsSource) (*source.ServerCertsStore, error) {
-	store := source.NewServerCertsStore(logger)
+// NewServerCertsStore creates a store with the initial certificates of the source and keeps it updated until ctx is done.
+// It fails if the initial certificates are rejected by the validators of the store options.
+func NewServerCertsStore(ctx context.Context, logger *slog.Logger, src source.ServerCertsSource, opts ...source.ServerCertsStoreOption) (*source.ServerCertsStore, error) {
+	store := source.NewServerCertsStore(logger, append([]source.ServerCertsStoreOption{source.WithServerCertsContext(ctx)}, opts...)...)
 	logger.Info("initial server certs loading")
 
-	certsChan := src.ServerCerts()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	certsChan := src.ServerCerts(ctx)
 
 	select {
-	case certs := <-certsChan:
-		store.SetServerCerts(certs)
+	case certs, ok := <-certsChan:
+		if !ok {
+			cancel()
+			return nil, errors.New("server certs source closed")
+		}
+		if err := store.SetServerCerts(certs); err != nil {
+			cancel()
+			return nil, err
+		}
+	case <-ctx.Done():
+		cancel()
+		return nil, ctx.Err()
 	case <-time.After(initLoadTimeout):
+		cancel()
 		return nil, errors.New("get server certs timeout")
 	}
 
 	go func() {
+		defer cancel()
 		for certs := range certsChan {
-			store.SetServerCerts(certs)
+			// rejected certificates are reported by the store, which keeps the previous ones
+			_ = store.SetServerCerts(certs)
 		}
 	}()
 	return store, nil
 }
 
 func verifyClientCertificate(logger *slog.Logger, store *source.ServerCertsStore) func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	var lastWarning atomic.Int64
 	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
 		cs := store.LoadServerCerts()
-		if len(cs.ClientCRLs) == 0 {
+		// nothing to check when no client certificate was presented
+		if len(cs.ClientCRLs) == 0 || len(rawCerts) == 0 {
 			return nil
 		}
+		if err := checkCRLFreshness(logger, &cs, &lastWarning); err != nil {
+			return err
+		}
+		if len(verifiedChains) == 0 {
+			// client auth modes without verification still check the presented certificates
+			chain, err := parseCertificates(rawCerts)
+			if err != nil {
+				return err
+			}
+			return checkRevoked(logger, &cs, chain)
+		}
 		for _, chain := range verifiedChains {
-			for _, cert := range chain {
-				if !cert.IsCA {
-					if cs.IsClientCertRevoked(cert.SerialNumber) {
-						err := fmt.Errorf("client certificte %s was revoked", keyutil.GetHexFormatted(cert.SerialNumber.Bytes(), ":"))
-						logger.Debug(err.Error())
-						return err
-					}
-				}
+			// the trust anchor is not checked
+			if len(chain) > 1 {
+				chain = chain[:len(chain)-1]
+			}
+			if err := checkRevoked(logger, &cs, chain); err != nil {
+				return err
 			}
 		}
 		return nil
 	}
 }
+
+func parseCertificates(rawCerts [][]byte) ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parse client certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+func checkRevoked(logger *slog.Logger, cs *source.ServerCerts, chain []*x509.Certificate) error {
+	for _, cert := range chain {
+		if cs.IsClientCertRevoked(cert) {
+			kind := "client"
+			if cert.IsCA {
+				kind = "intermediate CA"
+			}
+			err := fmt.Errorf("%s certificate %s was revoked", kind, keyutil.GetHexFormatted(cert.SerialNumber.Bytes(), ":"))
+			logger.Debug(err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+func checkCRLFreshness(logger *slog.Logger, cs *source.ServerCerts, lastWarning *atomic.Int64) error {
+	if cs.CRLExpiryPolicy == "" || cs.CRLExpiryPolicy == source.CRLExpiryIgnore {
+		return nil
+	}
+	now := time.Now()
+	status := cs.CRLStatus(now)
+	if !status.Stale() {
+		return nil
+	}
+	var err error
+	if status.Expired {
+		err = fmt.Errorf("client CRL expired at %s", status.NextUpdate.Format(time.RFC3339))
+	} else {
+		err = fmt.Errorf("client CRL is not valid before %s", status.ThisUpdate.Format(time.RFC3339))
+	}
+	if cs.CRLExpiryPolicy == source.CRLExpiryReject {
+		logger.Debug(err.Error())
+		return err
+	}
+	// warn at most once per interval to avoid logging on every handshake
+	last := lastWarning.Load()
+	if now.UnixNano()-last >= int64(crlWarningInterval) && lastWarning.CompareAndSwap(last, now.UnixNano()) {
+		logger.Warn(err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+package tlsserver
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/cert-source/internal/testutil"
+	"github.com/grepplabs/cert-source/tls/server/filesource"
+	"github.com/grepplabs/cert-source/tls/server/source"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevocationScopedByIssuer(t *testing.T) {
+	bundleA := testutil.NewCertsBundle()
+	defer bundleA.Close()
+	bundleB := testutil.NewCertsBundle()
+	defer bundleB.Close()
+
+	// CA B issues a client certificate with the serial number revoked by CA A
+	certFile, keyFile := createTempPair(t, t.TempDir())
+	clientB, _, err := testutil.GenerateClientCertWithSerial(bundleB.CATLSCert, bundleA.ClientX509Cert.SerialNumber, certFile, keyFile)
+	require.NoError(t, err)
+
+	clientCAs := concatFiles(t, bundleA.CACert.Name(), bundleB.CACert.Name())
+	serverURL := startServer(t, filesource.MustNew(
+		filesource.WithX509KeyPair(bundleA.ServerCert.Name(), bundleA.ServerKey.Name()),
+		filesource.WithClientAuthFile(clientCAs),
+		filesource.WithClientCRLFile(bundleA.ClientCRL.Name()),
+	))
+
+	// nolint:bodyclose
+	_, err = newHTTPClient(bundleA.CAX509Cert, bundleA.ClientTLSCert).Get(serverURL)
+	require.ErrorContains(t, err, "bad certificate")
+
+	resp, err := newHTTPClient(bundleA.CAX509Cert, clientB).Get(serverURL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+}
+
+func TestRevokedIntermediateCA(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	dir := t.TempDir()
+	intermediateCertFile, intermediateKeyFile := createTempPair(t, dir)
+	intermediateTLSCert, intermediateX509Cert, err := testutil.GenerateIntermediateCA(bundle.CATLSCert, intermediateCertFile, intermediateKeyFile)
+	require.NoError(t, err)
+
+	leafCertFile, leafKeyFile := createTempPair(t, dir)
+	clientCert, _, err := testutil.GenerateCert(intermediateTLSCert, true, leafCertFile, leafKeyFile)
+	require.NoError(t, err)
+	clientCert.Certificate = append(clientCert.Certificate, intermediateTLSCert.Certificate[0])
+
+	intermediateCRL, err := os.CreateTemp(dir, "intermediate-crl-")
+	require.NoError(t, err)
+	defer intermediateCRL.Close()
+	require.NoError(t, testutil.GenerateCRL(bundle.CAX509Cert, bundle.CATLSCert.PrivateKey, []*x509.Certificate{intermediateX509Cert}, intermediateCRL))
+
+	tests := []struct {
+		name         string
+		crlFile      string
+		requestError bool
+	}{
+		{
+			name:    "intermediate not revoked",
+			crlFile: bundle.CAEmptyCRL.Name(),
+		},
+		{
+			name:         "intermediate revoked",
+			crlFile:      intermediateCRL.Name(),
+			requestError: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			serverURL := startServer(t, filesource.MustNew(
+				filesource.WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
+				filesource.WithClientAuthFile(bundle.CACert.Name()),
+				filesource.WithClientCRLFile(tc.crlFile),
+			))
+			resp, err := newHTTPClient(bundle.CAX509Cert, clientCert).Get(serverURL)
+			if tc.requestError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+		})
+	}
+}
+
+func startServer(t *testing.T, src source.ServerCertsSource, opts ...TLSServerConfigOption) string {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(ts.Close)
+	ts.TLS = MustNewServerConfig(t.Context(), slog.Default(), src, opts...)
+	ts.StartTLS()
+	return ts.URL
+}
+
+func newHTTPClient(caCert *x509.Certificate, clientCert *tls.Certificate) *http.Client {
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(caCert)
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				RootCAs:      rootCAs,
+				Certificates: []tls.Certificate{*clientCert},
+			},
+		},
+	}
+}
+
+func concatFiles(t *testing.T, names ...string) string {
+	t.Helper()
+	var data []byte
+	for _, name := range names {
+		content, err := os.ReadFile(name)
+		require.NoError(t, err)
+		data = append(data, content...)
+	}
+	name := filepath.Join(t.TempDir(), "concat.pem")
+	require.NoError(t, os.WriteFile(name, data, 0o600))
+	return name
+}
+
+func TestCRLExpiryPolicy(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	dir := t.TempDir()
+	newCRL := func(thisUpdate, nextUpdate time.Time) string {
+		crlFile, err := os.CreateTemp(dir, "crl-")
+		require.NoError(t, err)
+		defer crlFile.Close()
+		require.NoError(t, testutil.GenerateCRLWithValidity(bundle.CAX509Cert, bundle.CATLSCert.PrivateKey, nil, thisUpdate, nextUpdate, crlFile))
+		return crlFile.Name()
+	}
+	now := time.Now()
+	expiredCRL := newCRL(now.Add(-2*time.Hour), now.Add(-1*time.Hour))
+	futureCRL := newCRL(now.Add(1*time.Hour), now.Add(2*time.Hour))
+
+	tests := []struct {
+		name         string
+		crlFile      string
+		policy       source.CRLExpiryPolicy
+		expired      bool
+		notYetValid  bool
+		requestError bool
+	}{
+		{name: "fresh CRL reject", crlFile: bundle.CAEmptyCRL.Name(), policy: source.CRLExpiryReject},
+		{name: "expired CRL default", crlFile: expiredCRL, expired: true},
+		{name: "expired CRL ignore", crlFile: expiredCRL, policy: source.CRLExpiryIgnore, expired: true},
+		{name: "expired CRL warn", crlFile: expiredCRL, policy: source.CRLExpiryWarn, expired: true},
+		{name: "expired CRL reject", crlFile: expiredCRL, policy: source.CRLExpiryReject, expired: true, requestError: true},
+		{name: "future CRL warn", crlFile: futureCRL, policy: source.CRLExpiryWarn, notYetValid: true},
+		{name: "future CRL reject", crlFile: futureCRL, policy: source.CRLExpiryReject, notYetValid: true, requestError: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			src := filesource.MustNew(
+				filesource.WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
+				filesource.WithClientAuthFile(bundle.CACert.Name()),
+				filesource.WithClientCRLFile(tc.crlFile),
+				filesource.WithClientCRLExpiryPolicy(tc.policy),
+			)
+			store, err := NewServerCertsStore(t.Context(), slog.Default(), src)
+			require.NoError(t, err)
+			status := store.CRLStatus()
+			require.Equal(t, tc.expired, status.Expired)
+			require.Equal(t, tc.notYetValid, status.NotYetValid)
+			require.False(t, status.NextUpdate.IsZero())
+
+			serverURL := startServer(t, src)
+			resp, err := newHTTPClient(bundle.CAX509Cert, bundle.ClientTLSCert).Get(serverURL)
+			if tc.requestError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+		})
+	}
+}
+
+func TestCRLExpiryWarningThrottled(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	crlFile, err := os.CreateTemp(t.TempDir(), "crl-")
+	require.NoError(t, err)
+	defer crlFile.Close()
+	now := time.Now()
+	require.NoError(t, testutil.GenerateCRLWithValidity(bundle.CAX509Cert, bundle.CATLSCert.PrivateKey, nil, now.Add(-2*time.Hour), now.Add(-1*time.Hour), crlFile))
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	store, err := NewServerCertsStore(t.Context(), logger, filesource.MustNew(
+		filesource.WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
+		filesource.WithClientAuthFile(bundle.CACert.Name()),
+		filesource.WithClientCRLFile(crlFile.Name()),
+		filesource.WithClientCRLExpiryPolicy(source.CRLExpiryWarn),
+	))
+	require.NoError(t, err)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	ts.TLS = NewStoreServerConfig(logger, store)
+	ts.StartTLS()
+	defer ts.Close()
+
+	for range 2 {
+		// a new client for every request, so each request makes a handshake
+		resp, err := newHTTPClient(bundle.CAX509Cert, bundle.ClientTLSCert).Get(ts.URL)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+	}
+	require.Equal(t, 1, strings.Count(logs.String(), "client CRL expired"))
+}
+
+func TestParseCRLExpiryPolicy(t *testing.T) {
+	policy, err := source.ParseCRLExpiryPolicy("")
+	require.NoError(t, err)
+	require.Equal(t, source.CRLExpiryIgnore, policy)
+
+	policy, err = source.ParseCRLExpiryPolicy("Reject")
+	require.NoError(t, err)
+	require.Equal(t, source.CRLExpiryReject, policy)
+
+	_, err = source.ParseCRLExpiryPolicy("fail")
+	require.Error(t, err)
+}
+
+func TestClientAuthMode(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	certFile, keyFile := createTempPair(t, t.TempDir())
+	validClient, _, err := testutil.GenerateCert(bundle.CATLSCert, true, certFile, keyFile)
+	require.NoError(t, err)
+	otherBundle := testutil.NewCertsBundle()
+	defer otherBundle.Close()
+
+	tests := []struct {
+		name       string
+		clientAuth tls.ClientAuthType
+		clientCert *tls.Certificate
+		wantError  bool
+	}{
+		{name: "verify if given without cert", clientAuth: tls.VerifyClientCertIfGiven},
+		{name: "verify if given with valid cert", clientAuth: tls.VerifyClientCertIfGiven, clientCert: validClient},
+		{name: "verify if given with revoked cert", clientAuth: tls.VerifyClientCertIfGiven, clientCert: bundle.ClientTLSCert, wantError: true},
+		{name: "verify if given with unknown CA", clientAuth: tls.VerifyClientCertIfGiven, clientCert: otherBundle.ClientTLSCert, wantError: true},
+		{name: "request without cert", clientAuth: tls.RequestClientCert},
+		{name: "request with unknown CA", clientAuth: tls.RequestClientCert, clientCert: otherBundle.ClientTLSCert},
+		{name: "request with revoked cert", clientAuth: tls.RequestClientCert, clientCert: bundle.ClientTLSCert, wantError: true},
+		{name: "require any without cert", clientAuth: tls.RequireAnyClientCert, wantError: true},
+		{name: "require and verify without cert", clientAuth: tls.RequireAndVerifyClientCert, wantError: true},
+		{name: "require and verify with valid cert", clientAuth: tls.RequireAndVerifyClientCert, clientCert: validClient},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			serverURL := startServer(t, filesource.MustNew(
+				filesource.WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
+				filesource.WithClientAuthFile(bundle.CACert.Name()),
+				filesource.WithClientCRLFile(bundle.ClientCRL.Name()),
+			), WithTLSServerClientAuth(tc.clientAuth))
+
+			clientCert := tc.clientCert
+			if clientCert == nil {
+				clientCert = &tls.Certificate{}
+			}
+			resp, err := newHTTPClient(bundle.CAX509Cert, clientCert).Get(serverURL)
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+		})
+	}
+}
+
+func TestServerCertsStoreValidation(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+	otherBundle := testutil.NewCertsBundle()
+	defer otherBundle.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(bundle.CAX509Cert)
+	rotated := make(chan struct{}, 1)
+	rejected := make(chan error, 1)
+	src := filesource.MustNew(
+		filesource.WithX509KeyPair(bundle.ServerCert.Name(), bundle.ServerKey.Name()),
+		filesource.WithRefresh(time.Hour),
+		filesource.WithFileWatch(true),
+		filesource.WithFileWatchDebounce(50*time.Millisecond),
+		filesource.WithNotifyFunc(func() { rotated <- struct{}{} }),
+	)
+	store, err := NewServerCertsStore(t.Context(), slog.Default(), src,
+		source.WithServerCertsValidators(source.ValidateChain(roots), source.ValidateSANs("localhost")),
+		source.WithServerCertsRejectedFunc(func(_ source.ServerCerts, err error) { rejected <- err }),
+	)
+	require.NoError(t, err)
+
+	// a certificate signed by an untrusted CA is rejected and the previous one is kept
+	require.NoError(t, os.Rename(otherBundle.ServerCert.Name(), bundle.ServerCert.Name()))
+	require.NoError(t, os.Rename(otherBundle.ServerKey.Name(), bundle.ServerKey.Name()))
+	select {
+	case err = <-rejected:
+		require.ErrorContains(t, err, "unknown authority")
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected rejection")
+	}
+	require.Equal(t, bundle.ServerX509Cert.SerialNumber, store.LoadServerCerts().Certificates[0].Leaf.SerialNumber)
+	<-rotated
+
+	// the initial certificates must be valid as well
+	_, err = NewServerCertsStore(t.Context(), slog.Default(), src, source.WithServerCertsValidators(source.ValidateSANs("example.com")))
+	require.ErrorContains(t, err, "no certificate is valid for example.com")
+}
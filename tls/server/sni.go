@@ -0,0 +1,59 @@
+package tlsserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"strings"
+)
+
+// selectCertificate returns the certificate matching the SNI server name.
+// Exact DNS names take precedence over wildcards; if nothing matches, the first (default) certificate is returned.
+func selectCertificate(certs []tls.Certificate, serverName string) tls.Certificate {
+	name := strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if name == "" {
+		return certs[0]
+	}
+	wildcard := -1
+	for i := range certs {
+		leaf := certs[i].Leaf
+		if leaf == nil {
+			var err error
+			if leaf, err = x509.ParseCertificate(certs[i].Certificate[0]); err != nil {
+				continue
+			}
+		}
+		for _, dnsName := range certNames(leaf) {
+			dnsName = strings.ToLower(dnsName)
+			if dnsName == name {
+				return certs[i]
+			}
+			if wildcard < 0 && matchWildcard(dnsName, name) {
+				wildcard = i
+			}
+		}
+	}
+	if wildcard >= 0 {
+		return certs[wildcard]
+	}
+	return certs[0]
+}
+
+func certNames(leaf *x509.Certificate) []string {
+	if len(leaf.DNSNames) != 0 {
+		return leaf.DNSNames
+	}
+	if leaf.Subject.CommonName != "" {
+		return []string{leaf.Subject.CommonName}
+	}
+	return nil
+}
+
+// matchWildcard reports whether pattern "*.example.com" matches exactly one leftmost label of name.
+func matchWildcard(pattern, name string) bool {
+	suffix, ok := strings.CutPrefix(pattern, "*.")
+	if !ok {
+		return false
+	}
+	label, rest, ok := strings.Cut(name, ".")
+	return ok && label != "" && rest == suffix
+}
@@ -0,0 +1,45 @@
+package tlsserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectCertificate(t *testing.T) {
+	newCert := func(cn string, dnsNames ...string) tls.Certificate {
+		return tls.Certificate{
+			Certificate: [][]byte{{}},
+			Leaf:        &x509.Certificate{Subject: pkix.Name{CommonName: cn}, DNSNames: dnsNames},
+		}
+	}
+	defaultCert := newCert("default", "default.example.com")
+	apiCert := newCert("api", "api.example.com")
+	wildcardCert := newCert("wildcard", "*.example.com")
+	cnCert := newCert("legacy.example.org")
+	certs := []tls.Certificate{defaultCert, wildcardCert, apiCert, cnCert}
+
+	tests := []struct {
+		serverName string
+		expected   string
+	}{
+		{serverName: "", expected: "default"},
+		{serverName: "default.example.com", expected: "default"},
+		{serverName: "api.example.com", expected: "api"},
+		{serverName: "API.Example.COM.", expected: "api"},
+		{serverName: "admin.example.com", expected: "wildcard"},
+		{serverName: "a.admin.example.com", expected: "default"},
+		{serverName: "example.com", expected: "default"},
+		{serverName: "legacy.example.org", expected: "legacy.example.org"},
+		{serverName: "unknown.example.net", expected: "default"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.serverName, func(t *testing.T) {
+			cert := selectCertificate(certs, tc.serverName)
+			require.Equal(t, tc.expected, cert.Leaf.Subject.CommonName)
+		})
+	}
+}
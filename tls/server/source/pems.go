@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
+	"time"
 
 	"github.com/grepplabs/cert-source/tls/keyutil"
 )
@@ -13,6 +14,17 @@ type ServerPEMsLoader interface {
 	Load() (*ServerPEMs, error)
 }
 
+// ClientCRLSource provides client CRLs in PEM format for the client CAs, e.g. downloaded from CRL distribution points.
+type ClientCRLSource interface {
+	ClientCRLs(clientAuthPEMBlock []byte) ([]byte, error)
+}
+
+// ClientCRLRefresher is implemented by client CRL sources whose CRLs are due at a given time.
+// The cert sources reload at NextRefresh; the zero time means no refresh is due.
+type ClientCRLRefresher interface {
+	NextRefresh() time.Time
+}
+
 type ServerPEMs struct {
 	CertPEMBlock       []byte
 	KeyPEMBlock        []byte
@@ -20,6 +32,32 @@ type ServerPEMs struct {
 	CRLPEMBlock        []byte
 }
 
+// NewServerCerts parses the PEM blocks and builds server certificates.
+func NewServerCerts(pemBlocks *ServerPEMs) (*ServerCerts, error) {
+	certificates, err := pemBlocks.Certificates()
+	if err != nil {
+		return nil, err
+	}
+	clientCAs, err := pemBlocks.ClientCAs()
+	if err != nil {
+		return nil, err
+	}
+	clientCRLs, err := pemBlocks.ClientCRLs()
+	if err != nil {
+		return nil, err
+	}
+	if err = pemBlocks.ValidateCRLs(); err != nil {
+		return nil, err
+	}
+	return &ServerCerts{
+		Certificates:        certificates,
+		ClientCAs:           clientCAs,
+		ClientCRLs:          clientCRLs,
+		RevokedCertificates: NewRevokedCertificates(clientCRLs),
+		Checksum:            pemBlocks.Checksum(),
+	}, nil
+}
+
 func (s ServerPEMs) Checksum() []byte {
 	hash := sha256.New()
 	hash.Write(s.CertPEMBlock)
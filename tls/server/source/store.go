@@ -1,58 +1,221 @@
 package source
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
 	"log/slog"
-	"math/big"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/grepplabs/cert-source/internal/subscription"
 	"github.com/grepplabs/cert-source/tls/keyutil"
 )
 
+// ServerCertsSource provides server certificates.
+//
+// ServerCerts returns a channel which first delivers the initial certificates and then every rotated generation.
+// The channel is closed by the source when ctx is done or when the source does not watch for changes.
+// After ctx is done, the source stops its background work and sends no further values.
 type ServerCertsSource interface {
-	ServerCerts() chan ServerCerts
+	ServerCerts(ctx context.Context) chan ServerCerts
 }
 
 type ServerCerts struct {
-	Certificates         []tls.Certificate
-	ClientCAs            *x509.CertPool
-	ClientCRLs           []*x509.RevocationList
-	Checksum             []byte
-	RevokedSerialNumbers map[string]struct{}
+	Certificates        []tls.Certificate
+	ClientCAs           *x509.CertPool
+	ClientCRLs          []*x509.RevocationList
+	CRLExpiryPolicy     CRLExpiryPolicy
+	Checksum            []byte
+	RevokedCertificates RevokedCertificates
+}
+
+// CRLExpiryPolicy defines how client certificates are handled when a client CRL is stale,
+// i.e. its NextUpdate has passed or its ThisUpdate is in the future.
+type CRLExpiryPolicy string
+
+const (
+	// CRLExpiryIgnore accepts client certificates and does not report stale CRLs.
+	CRLExpiryIgnore CRLExpiryPolicy = "ignore"
+	// CRLExpiryWarn accepts client certificates and logs a warning.
+	CRLExpiryWarn CRLExpiryPolicy = "warn"
+	// CRLExpiryReject rejects all client certificates while a CRL is stale.
+	CRLExpiryReject CRLExpiryPolicy = "reject"
+)
+
+// ParseCRLExpiryPolicy parses the policy name. An empty name is CRLExpiryIgnore.
+func ParseCRLExpiryPolicy(name string) (CRLExpiryPolicy, error) {
+	switch policy := CRLExpiryPolicy(strings.ToLower(name)); policy {
+	case "":
+		return CRLExpiryIgnore, nil
+	case CRLExpiryIgnore, CRLExpiryWarn, CRLExpiryReject:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown CRL expiry policy %q", name)
+	}
+}
+
+// CRLStatus describes the freshness of the client CRLs.
+type CRLStatus struct {
+	// Expired is set when the NextUpdate of any CRL has passed.
+	Expired bool
+	// NotYetValid is set when the ThisUpdate of any CRL is in the future.
+	NotYetValid bool
+	// ThisUpdate is the latest ThisUpdate of the CRLs.
+	ThisUpdate time.Time
+	// NextUpdate is the earliest NextUpdate of the CRLs.
+	NextUpdate time.Time
+}
+
+// Stale reports whether any CRL is expired or not yet valid.
+func (s CRLStatus) Stale() bool {
+	return s.Expired || s.NotYetValid
+}
+
+// CRLStatus returns the freshness of the client CRLs at the given time.
+func (s *ServerCerts) CRLStatus(now time.Time) CRLStatus {
+	var status CRLStatus
+	for _, crl := range s.ClientCRLs {
+		if crl.ThisUpdate.After(status.ThisUpdate) {
+			status.ThisUpdate = crl.ThisUpdate
+		}
+		if crl.ThisUpdate.After(now) {
+			status.NotYetValid = true
+		}
+		if crl.NextUpdate.IsZero() {
+			continue
+		}
+		if status.NextUpdate.IsZero() || crl.NextUpdate.Before(status.NextUpdate) {
+			status.NextUpdate = crl.NextUpdate
+		}
+		if now.After(crl.NextUpdate) {
+			status.Expired = true
+		}
+	}
+	return status
 }
 
 func (s *ServerCerts) GetChecksum() []byte {
 	return s.Checksum
 }
 
-func NewRevokedSerialNumbers(clientCRLs []*x509.RevocationList) map[string]struct{} {
-	revokedSerialNumbers := make(map[string]struct{})
+// RevokedCertificates indexes revoked certificates by issuer and serial number,
+// so that a serial number revoked by one CA does not reject a certificate with the same serial number issued by another CA.
+type RevokedCertificates map[revocationKey][]string
+
+type revocationKey struct {
+	issuer       string
+	serialNumber string
+}
+
+// NewRevokedCertificates builds the revocation index from the CRLs.
+// Entries are keyed by the CRL issuer name and serial number and scoped by the CRL authority key identifier.
+func NewRevokedCertificates(clientCRLs []*x509.RevocationList) RevokedCertificates {
+	revoked := make(RevokedCertificates)
 	for _, clientCRL := range clientCRLs {
-		for _, revoked := range clientCRL.RevokedCertificateEntries {
-			revokedSerialNumbers[string(revoked.SerialNumber.Bytes())] = struct{}{}
+		authorityKeyID := string(clientCRL.AuthorityKeyId)
+		for _, entry := range clientCRL.RevokedCertificateEntries {
+			key := revocationKey{
+				issuer:       string(clientCRL.RawIssuer),
+				serialNumber: string(entry.SerialNumber.Bytes()),
+			}
+			revoked[key] = append(revoked[key], authorityKeyID)
+		}
+	}
+	return revoked
+}
+
+// IsRevoked reports whether the certificate was revoked by its issuer.
+// The authority key identifiers are compared when both the certificate and the CRL provide them.
+func (r RevokedCertificates) IsRevoked(cert *x509.Certificate) bool {
+	authorityKeyIDs, ok := r[revocationKey{
+		issuer:       string(cert.RawIssuer),
+		serialNumber: string(cert.SerialNumber.Bytes()),
+	}]
+	if !ok {
+		return false
+	}
+	for _, authorityKeyID := range authorityKeyIDs {
+		if authorityKeyID == "" || len(cert.AuthorityKeyId) == 0 || authorityKeyID == string(cert.AuthorityKeyId) {
+			return true
 		}
 	}
-	return revokedSerialNumbers
+	return false
 }
 
-func (s *ServerCerts) IsClientCertRevoked(serialNumber *big.Int) bool {
-	_, ok := s.RevokedSerialNumbers[string(serialNumber.Bytes())]
-	return ok
+func (s *ServerCerts) IsClientCertRevoked(cert *x509.Certificate) bool {
+	return s.RevokedCertificates.IsRevoked(cert)
 }
 
+// DefaultRejectedRetryInterval is the default interval in which rejected certificates are validated again.
+const DefaultRejectedRetryInterval = 1 * time.Minute
+
 type ServerCertsStore struct {
-	cs     atomic.Pointer[ServerCerts]
-	logger *slog.Logger
+	cs            atomic.Pointer[ServerCerts]
+	logger        *slog.Logger
+	validators    []ServerCertsValidator
+	rejectedFunc  func(certs ServerCerts, err error)
+	retryInterval time.Duration
+	ctx           context.Context
+
+	// setMu serializes the stored generations and guards the rejected generation, which is validated again
+	setMu      sync.Mutex
+	stored     bool
+	rejected   *ServerCerts
+	retryTimer *time.Timer
+
+	mu     sync.Mutex
+	hooks  map[int]func(old, current ServerCerts)
+	nextID int
+}
+
+type ServerCertsStoreOption func(*ServerCertsStore)
+
+// WithServerCertsValidators sets the validators which must accept new certificates before they are stored.
+func WithServerCertsValidators(validators ...ServerCertsValidator) ServerCertsStoreOption {
+	return func(s *ServerCertsStore) {
+		s.validators = append(s.validators, validators...)
+	}
+}
+
+// WithServerCertsRejectedFunc sets the function called with the certificates rejected by a validator.
+func WithServerCertsRejectedFunc(rejectedFunc func(certs ServerCerts, err error)) ServerCertsStoreOption {
+	return func(s *ServerCertsStore) {
+		s.rejectedFunc = rejectedFunc
+	}
+}
+
+// WithServerCertsRetryInterval sets the interval in which the last rejected certificates are validated again,
+// so e.g. certificates which were not yet valid are stored once they become valid. Newer certificates replace them.
+// Zero disables the retries. The default is DefaultRejectedRetryInterval.
+func WithServerCertsRetryInterval(retryInterval time.Duration) ServerCertsStoreOption {
+	return func(s *ServerCertsStore) {
+		s.retryInterval = retryInterval
+	}
+}
+
+// WithServerCertsContext sets the context of the store. Rejected certificates are not validated again after ctx is done.
+func WithServerCertsContext(ctx context.Context) ServerCertsStoreOption {
+	return func(s *ServerCertsStore) {
+		s.ctx = ctx
+	}
 }
 
-func NewServerCertsStore(logger *slog.Logger) *ServerCertsStore {
+func NewServerCertsStore(logger *slog.Logger, opts ...ServerCertsStoreOption) *ServerCertsStore {
 	s := &ServerCertsStore{
-		logger: logger,
+		logger:        logger,
+		retryInterval: DefaultRejectedRetryInterval,
+		ctx:           context.Background(),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
 	s.cs.Store(&ServerCerts{})
+	context.AfterFunc(s.ctx, s.stopRetry)
 	return s
 }
 
@@ -60,9 +223,137 @@ func (s *ServerCertsStore) LoadServerCerts() ServerCerts {
 	return *s.cs.Load()
 }
 
-func (s *ServerCertsStore) SetServerCerts(certs ServerCerts) {
-	s.cs.Store(&certs)
+// CRLStatus returns the current freshness of the stored client CRLs, e.g. to alert on expired CRLs.
+func (s *ServerCertsStore) CRLStatus() CRLStatus {
+	return s.cs.Load().CRLStatus(time.Now())
+}
+
+// SetServerCerts stores the certificates if all validators accept them.
+// Otherwise, the previous certificates are kept and the rejection is returned and reported.
+// Once certificates were stored, rejected ones are validated again in the retry interval until they are accepted or replaced.
+func (s *ServerCertsStore) SetServerCerts(certs ServerCerts) error {
+	s.setMu.Lock()
+	defer s.setMu.Unlock()
+	s.clearRejected()
+	if err := s.validate(certs); err != nil {
+		err = fmt.Errorf("server certs rejected: %w", err)
+		s.logger.Error(err.Error(), slog.Any("names", names(certs.Certificates)))
+		if s.rejectedFunc != nil {
+			s.rejectedFunc(certs, err)
+		}
+		// rejected initial certificates fail the creation of the store, so they are not retried
+		if s.retryInterval > 0 && s.stored && s.ctx.Err() == nil {
+			s.rejected = &certs
+			s.retryTimer = time.AfterFunc(s.retryInterval, s.retryRejected)
+		}
+		return err
+	}
+	s.store(certs)
+	return nil
+}
+
+func (s *ServerCertsStore) retryRejected() {
+	s.setMu.Lock()
+	defer s.setMu.Unlock()
+	if s.rejected == nil || s.ctx.Err() != nil {
+		return
+	}
+	certs := *s.rejected
+	if err := s.validate(certs); err != nil {
+		s.logger.Debug("server certs are still rejected", slog.String("error", err.Error()))
+		s.retryTimer = time.AfterFunc(s.retryInterval, s.retryRejected)
+		return
+	}
+	s.rejected = nil
+	s.retryTimer = nil
+	s.logger.Info("previously rejected server certs were accepted")
+	s.store(certs)
+}
+
+// stopRetry stops validating the rejected certificates when the context of the store is done.
+func (s *ServerCertsStore) stopRetry() {
+	s.setMu.Lock()
+	defer s.setMu.Unlock()
+	s.clearRejected()
+}
+
+func (s *ServerCertsStore) clearRejected() {
+	s.rejected = nil
+	if s.retryTimer != nil {
+		s.retryTimer.Stop()
+		s.retryTimer = nil
+	}
+}
+
+// validate runs the validators. Empty certificates without a checksum are the placeholder of a source
+// which obtains the certificates in the background, e.g. the ACME source, and are not validated.
+func (s *ServerCertsStore) validate(certs ServerCerts) error {
+	if len(certs.Certificates) == 0 && certs.Checksum == nil {
+		return nil
+	}
+	for _, validate := range s.validators {
+		if err := validate(certs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// store swaps the certificates. Every change after the initial certificates is a rotation,
+// including the change from an empty placeholder to the first obtained certificates.
+func (s *ServerCertsStore) store(certs ServerCerts) {
+	rotation := s.stored
+	s.stored = true
+	old := s.cs.Swap(&certs)
 	s.logger.Info(fmt.Sprintf("stored x509 server certs for names [%s]", names(certs.Certificates)))
+	if rotation && !bytes.Equal(old.Checksum, certs.Checksum) {
+		s.mu.Lock()
+		hooks := make([]func(old, current ServerCerts), 0, len(s.hooks))
+		for _, hook := range s.hooks {
+			hooks = append(hooks, hook)
+		}
+		s.mu.Unlock()
+		for _, hook := range hooks {
+			hook(*old, certs)
+		}
+	}
+}
+
+// ServerCertsRotation is a rotation of the stored certificates.
+type ServerCertsRotation struct {
+	Old     ServerCerts
+	Current ServerCerts
+}
+
+// Subscribe returns a channel which receives every rotation of the stored certificates in order.
+// The rotations are queued, so a slow subscriber does not block the store or other subscribers.
+// The subscription ends and the channel is closed when ctx is done.
+func (s *ServerCertsStore) Subscribe(ctx context.Context) <-chan ServerCertsRotation {
+	ch, publish := subscription.New[ServerCertsRotation](ctx)
+	unregister := s.OnRotation(func(old, current ServerCerts) {
+		publish(ServerCertsRotation{Old: old, Current: current})
+	})
+	context.AfterFunc(ctx, unregister)
+	return ch
+}
+
+// OnRotation registers a function which is called with the previous and the current certificates
+// when the stored certificates change. The function is called synchronously and should not block.
+// The returned function unregisters it.
+func (s *ServerCertsStore) OnRotation(fn func(old, current ServerCerts)) (unregister func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hooks == nil {
+		s.hooks = make(map[int]func(old, current ServerCerts))
+	}
+	id := s.nextID
+	s.nextID++
+	s.hooks[id] = fn
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.hooks, id)
+	}
 }
 
 func names(certs []tls.Certificate) []string {
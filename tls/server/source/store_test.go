@@ -0,0 +1,130 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerCertsStoreSubscribe(t *testing.T) {
+	store := NewServerCertsStore(slog.Default())
+	store.SetServerCerts(ServerCerts{Checksum: []byte("v1")})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	first := store.Subscribe(ctx)
+	second := store.Subscribe(t.Context())
+
+	// a subscriber which does not receive does not block the store
+	store.SetServerCerts(ServerCerts{Checksum: []byte("v2")})
+	store.SetServerCerts(ServerCerts{Checksum: []byte("v2")})
+	store.SetServerCerts(ServerCerts{Checksum: []byte("v3")})
+
+	for _, ch := range []<-chan ServerCertsRotation{first, second} {
+		rotation := receiveServerCertsRotation(t, ch)
+		require.Equal(t, []byte("v1"), rotation.Old.Checksum)
+		require.Equal(t, []byte("v2"), rotation.Current.Checksum)
+		rotation = receiveServerCertsRotation(t, ch)
+		require.Equal(t, []byte("v2"), rotation.Old.Checksum)
+		require.Equal(t, []byte("v3"), rotation.Current.Checksum)
+	}
+
+	cancel()
+	store.SetServerCerts(ServerCerts{Checksum: []byte("v4")})
+	select {
+	case _, ok := <-first:
+		require.False(t, ok)
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected channel to be closed")
+	}
+	require.Equal(t, []byte("v4"), receiveServerCertsRotation(t, second).Current.Checksum)
+}
+
+func TestServerCertsStoreRetryRejected(t *testing.T) {
+	var valid atomic.Bool
+	valid.Store(true)
+	store := NewServerCertsStore(slog.Default(),
+		WithServerCertsValidators(func(certs ServerCerts) error {
+			if !valid.Load() {
+				return errors.New("certificate is not yet valid")
+			}
+			return nil
+		}),
+		WithServerCertsRetryInterval(50*time.Millisecond),
+	)
+	require.NoError(t, store.SetServerCerts(ServerCerts{Checksum: []byte("v1")}))
+
+	// the rejected certificates are stored once they are accepted
+	valid.Store(false)
+	require.Error(t, store.SetServerCerts(ServerCerts{Checksum: []byte("v2")}))
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, []byte("v1"), store.LoadServerCerts().Checksum)
+	valid.Store(true)
+	require.Eventually(t, func() bool {
+		return string(store.LoadServerCerts().Checksum) == "v2"
+	}, 3*time.Second, 10*time.Millisecond)
+
+	// newer certificates replace the rejected ones
+	valid.Store(false)
+	require.Error(t, store.SetServerCerts(ServerCerts{Checksum: []byte("v3")}))
+	valid.Store(true)
+	require.NoError(t, store.SetServerCerts(ServerCerts{Checksum: []byte("v4")}))
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, []byte("v4"), store.LoadServerCerts().Checksum)
+}
+
+func TestServerCertsStoreRetryStopsWhenContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	var valid atomic.Bool
+	valid.Store(true)
+	var validations atomic.Int32
+	store := NewServerCertsStore(slog.Default(),
+		WithServerCertsContext(ctx),
+		WithServerCertsValidators(func(certs ServerCerts) error {
+			validations.Add(1)
+			if !valid.Load() {
+				return errors.New("certificate is not yet valid")
+			}
+			return nil
+		}),
+		WithServerCertsRetryInterval(20*time.Millisecond),
+	)
+	require.NoError(t, store.SetServerCerts(ServerCerts{Checksum: []byte("v1")}))
+
+	valid.Store(false)
+	require.Error(t, store.SetServerCerts(ServerCerts{Checksum: []byte("v2")}))
+	require.Eventually(t, func() bool {
+		return validations.Load() > 3
+	}, 3*time.Second, 10*time.Millisecond)
+
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	stopped := validations.Load()
+	valid.Store(true)
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, stopped, validations.Load())
+	require.Equal(t, []byte("v1"), store.LoadServerCerts().Checksum)
+
+	// certificates rejected after ctx is done are not retried
+	valid.Store(false)
+	require.Error(t, store.SetServerCerts(ServerCerts{Checksum: []byte("v3")}))
+	valid.Store(true)
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, []byte("v1"), store.LoadServerCerts().Checksum)
+}
+
+func receiveServerCertsRotation(t *testing.T, ch <-chan ServerCertsRotation) ServerCertsRotation {
+	t.Helper()
+	select {
+	case rotation, ok := <-ch:
+		require.True(t, ok)
+		return rotation
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected rotation")
+	}
+	return ServerCertsRotation{}
+}
@@ -0,0 +1,150 @@
+package source
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/grepplabs/cert-source/tls/keyutil"
+)
+
+// ServerCertsValidator accepts or rejects new server certificates before they are stored.
+type ServerCertsValidator func(certs ServerCerts) error
+
+// ValidateValidity rejects certificates which are not yet valid or which expire within minRemaining.
+func ValidateValidity(minRemaining time.Duration) ServerCertsValidator {
+	return forEachLeaf(func(leaf *x509.Certificate) error {
+		now := time.Now()
+		if now.Before(leaf.NotBefore) {
+			return fmt.Errorf("not valid before %s", leaf.NotBefore.Format(time.RFC3339))
+		}
+		if leaf.NotAfter.Sub(now) < minRemaining {
+			return fmt.Errorf("expires at %s", leaf.NotAfter.Format(time.RFC3339))
+		}
+		return nil
+	})
+}
+
+// ValidateSANs rejects the certificates unless every name, e.g. a DNS name or an IP address, is valid for one of them.
+func ValidateSANs(names ...string) ServerCertsValidator {
+	return func(certs ServerCerts) error {
+		leaves := make([]*x509.Certificate, 0, len(certs.Certificates))
+		for _, cert := range certs.Certificates {
+			leaf, err := parseLeaf(cert)
+			if err != nil {
+				return err
+			}
+			leaves = append(leaves, leaf)
+		}
+		for _, name := range names {
+			if !slices.ContainsFunc(leaves, func(leaf *x509.Certificate) bool {
+				return leaf.VerifyHostname(name) == nil
+			}) {
+				return fmt.Errorf("no certificate is valid for %s", name)
+			}
+		}
+		return nil
+	}
+}
+
+// ValidateChain rejects certificates which are not signed by the roots. The intermediates are taken from the certificate chains.
+func ValidateChain(roots *x509.CertPool) ServerCertsValidator {
+	return func(certs ServerCerts) error {
+		for _, cert := range certs.Certificates {
+			leaf, err := parseLeaf(cert)
+			if err != nil {
+				return err
+			}
+			opts := x509.VerifyOptions{
+				Roots:         roots,
+				Intermediates: x509.NewCertPool(),
+				KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+			}
+			for _, der := range cert.Certificate[1:] {
+				intermediate, err := x509.ParseCertificate(der)
+				if err != nil {
+					return err
+				}
+				opts.Intermediates.AddCert(intermediate)
+			}
+			if _, err = leaf.Verify(opts); err != nil {
+				return fmt.Errorf("certificate %s: %w", serialNumber(leaf), err)
+			}
+		}
+		return nil
+	}
+}
+
+// ValidateKeySize rejects RSA keys shorter than minRSABits and ECDSA keys on curves smaller than minECDSABits.
+func ValidateKeySize(minRSABits, minECDSABits int) ServerCertsValidator {
+	return forEachLeaf(func(leaf *x509.Certificate) error {
+		switch key := leaf.PublicKey.(type) {
+		case *rsa.PublicKey:
+			if bits := key.N.BitLen(); bits < minRSABits {
+				return fmt.Errorf("RSA key size %d is less than %d", bits, minRSABits)
+			}
+		case *ecdsa.PublicKey:
+			if bits := key.Curve.Params().BitSize; bits < minECDSABits {
+				return fmt.Errorf("ECDSA key size %d is less than %d", bits, minECDSABits)
+			}
+		case ed25519.PublicKey:
+		default:
+			return fmt.Errorf("unsupported public key type %T", key)
+		}
+		return nil
+	})
+}
+
+// ValidateKeyUsage rejects certificates without the key usage bits or any of the extended key usages.
+// As in the certificate verification, a certificate without key usage or extended key usage is not restricted.
+func ValidateKeyUsage(keyUsage x509.KeyUsage, extKeyUsages ...x509.ExtKeyUsage) ServerCertsValidator {
+	return forEachLeaf(func(leaf *x509.Certificate) error {
+		if leaf.KeyUsage != 0 && leaf.KeyUsage&keyUsage != keyUsage {
+			return fmt.Errorf("key usage %b does not include %b", leaf.KeyUsage, keyUsage)
+		}
+		if len(leaf.ExtKeyUsage) == 0 || slices.Contains(leaf.ExtKeyUsage, x509.ExtKeyUsageAny) {
+			return nil
+		}
+		for _, extKeyUsage := range extKeyUsages {
+			if !slices.Contains(leaf.ExtKeyUsage, extKeyUsage) {
+				return fmt.Errorf("extended key usage %d is missing", extKeyUsage)
+			}
+		}
+		return nil
+	})
+}
+
+func forEachLeaf(fn func(leaf *x509.Certificate) error) ServerCertsValidator {
+	return func(certs ServerCerts) error {
+		for _, cert := range certs.Certificates {
+			leaf, err := parseLeaf(cert)
+			if err != nil {
+				return err
+			}
+			if err = fn(leaf); err != nil {
+				return fmt.Errorf("certificate %s: %w", serialNumber(leaf), err)
+			}
+		}
+		return nil
+	}
+}
+
+func parseLeaf(cert tls.Certificate) (*x509.Certificate, error) {
+	if cert.Leaf != nil {
+		return cert.Leaf, nil
+	}
+	if len(cert.Certificate) == 0 {
+		return nil, errors.New("empty certificate")
+	}
+	return x509.ParseCertificate(cert.Certificate[0])
+}
+
+func serialNumber(cert *x509.Certificate) string {
+	return keyutil.GetHexFormatted(cert.SerialNumber.Bytes(), ":")
+}
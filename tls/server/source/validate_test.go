@@ -0,0 +1,87 @@
+package source
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/cert-source/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidators(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+	otherBundle := testutil.NewCertsBundle()
+	defer otherBundle.Close()
+
+	serverCerts := ServerCerts{Certificates: []tls.Certificate{*bundle.ServerTLSCert}}
+	clientCerts := ServerCerts{Certificates: []tls.Certificate{*bundle.ClientTLSCert}}
+	roots := x509.NewCertPool()
+	roots.AddCert(bundle.CAX509Cert)
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(otherBundle.CAX509Cert)
+
+	tests := []struct {
+		name      string
+		validator ServerCertsValidator
+		certs     ServerCerts
+		errorText string
+	}{
+		{name: "validity", validator: ValidateValidity(24 * time.Hour), certs: serverCerts},
+		{name: "expires soon", validator: ValidateValidity(11 * 365 * 24 * time.Hour), certs: serverCerts, errorText: "expires at"},
+		{name: "SANs", validator: ValidateSANs("localhost", "127.0.0.1"), certs: serverCerts},
+		{name: "missing SAN", validator: ValidateSANs("localhost", "example.com"), certs: serverCerts, errorText: "no certificate is valid for example.com"},
+		{name: "SANs without certificates", validator: ValidateSANs("localhost"), errorText: "no certificate is valid for localhost"},
+		{name: "chain", validator: ValidateChain(roots), certs: serverCerts},
+		{name: "untrusted chain", validator: ValidateChain(otherRoots), certs: serverCerts, errorText: "unknown authority"},
+		{name: "key size", validator: ValidateKeySize(2048, 256), certs: serverCerts},
+		{name: "key size too small", validator: ValidateKeySize(3072, 256), certs: serverCerts, errorText: "RSA key size 2048 is less than 3072"},
+		{name: "key usage", validator: ValidateKeyUsage(x509.KeyUsageDigitalSignature, x509.ExtKeyUsageServerAuth), certs: serverCerts},
+		{name: "key usage missing", validator: ValidateKeyUsage(x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment), certs: serverCerts, errorText: "key usage"},
+		{name: "extended key usage missing", validator: ValidateKeyUsage(0, x509.ExtKeyUsageServerAuth), certs: clientCerts, errorText: "extended key usage"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.validator(tc.certs)
+			if tc.errorText != "" {
+				require.ErrorContains(t, err, tc.errorText)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestServerCertsStoreRejection(t *testing.T) {
+	var rejected []ServerCerts
+	store := NewServerCertsStore(slog.Default(),
+		WithServerCertsValidators(func(certs ServerCerts) error {
+			if string(certs.Checksum) == "broken" {
+				return errors.New("broken certificate")
+			}
+			return nil
+		}),
+		WithServerCertsRejectedFunc(func(certs ServerCerts, err error) {
+			require.ErrorContains(t, err, "broken certificate")
+			rejected = append(rejected, certs)
+		}),
+	)
+	var rotations int
+	store.OnRotation(func(_, _ ServerCerts) { rotations++ })
+
+	require.NoError(t, store.SetServerCerts(ServerCerts{Checksum: []byte("v1")}))
+	require.ErrorContains(t, store.SetServerCerts(ServerCerts{Checksum: []byte("broken")}), "server certs rejected")
+
+	// the previous generation is kept
+	require.Equal(t, []byte("v1"), store.LoadServerCerts().Checksum)
+	require.Len(t, rejected, 1)
+	require.Equal(t, 0, rotations)
+
+	require.NoError(t, store.SetServerCerts(ServerCerts{Checksum: []byte("v2")}))
+	require.Equal(t, []byte("v2"), store.LoadServerCerts().Checksum)
+	require.Equal(t, 1, rotations)
+}
@@ -0,0 +1,228 @@
+package tlsserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/grepplabs/cert-source/tls/keyutil"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	defaultStaplerCheckInterval = 1 * time.Minute
+	defaultStaplerRetryInterval = 1 * time.Minute
+	defaultStaplerValidity      = 1 * time.Hour
+	defaultStaplerUnusedTTL     = 24 * time.Hour
+)
+
+// OCSPStapler fetches and caches OCSP responses for server certificates and staples them to the TLS handshake.
+// Responses are refreshed before their NextUpdate; a rotated certificate is fetched for its new serial number.
+type OCSPStapler struct {
+	logger        *slog.Logger
+	client        *http.Client
+	responderURL  string
+	checkInterval time.Duration
+	retryInterval time.Duration
+	unusedTTL     time.Duration
+
+	fetchCh chan string
+	mu      sync.Mutex
+	entries map[string]*staplerEntry
+}
+
+type staplerEntry struct {
+	leaf      *x509.Certificate
+	issuer    *x509.Certificate
+	url       string
+	raw       []byte
+	response  *ocsp.Response
+	refreshAt time.Time
+	lastUsed  time.Time
+	fetching  bool
+}
+
+type OCSPStaplerOption func(*OCSPStapler)
+
+func WithOCSPStaplerHTTPClient(client *http.Client) OCSPStaplerOption {
+	return func(s *OCSPStapler) {
+		s.client = client
+	}
+}
+
+// WithOCSPStaplerResponderURL overrides the responder URL from the certificate authority information access extension.
+func WithOCSPStaplerResponderURL(responderURL string) OCSPStaplerOption {
+	return func(s *OCSPStapler) {
+		s.responderURL = responderURL
+	}
+}
+
+// WithOCSPStaplerCheckInterval sets how often the cached responses are checked for refresh.
+// A non-positive interval falls back to the default.
+func WithOCSPStaplerCheckInterval(checkInterval time.Duration) OCSPStaplerOption {
+	return func(s *OCSPStapler) {
+		s.checkInterval = checkInterval
+	}
+}
+
+// WithOCSPStaplerRetryInterval sets the delay before a failed fetch is retried.
+func WithOCSPStaplerRetryInterval(retryInterval time.Duration) OCSPStaplerOption {
+	return func(s *OCSPStapler) {
+		s.retryInterval = retryInterval
+	}
+}
+
+// NewOCSPStapler creates a stapler refreshing the cached responses until ctx is done.
+func NewOCSPStapler(ctx context.Context, logger *slog.Logger, opts ...OCSPStaplerOption) *OCSPStapler {
+	s := &OCSPStapler{
+		logger:        logger,
+		client:        &http.Client{Timeout: defaultOCSPTimeout},
+		checkInterval: defaultStaplerCheckInterval,
+		retryInterval: defaultStaplerRetryInterval,
+		unusedTTL:     defaultStaplerUnusedTTL,
+		fetchCh:       make(chan string, 64),
+		entries:       make(map[string]*staplerEntry),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.checkInterval <= 0 {
+		s.checkInterval = defaultStaplerCheckInterval
+	}
+	go s.run(ctx)
+	return s
+}
+
+// WithTLSServerOCSPStapler staples the cached OCSP responses to the server certificates.
+// Certificates without a cached response are served without a staple while the response is fetched in the background.
+func WithTLSServerOCSPStapler(stapler *OCSPStapler) TLSServerConfigOption {
+	return func(c *tls.Config) {
+		if len(c.Certificates) == 0 {
+			return
+		}
+		certs := make([]tls.Certificate, len(c.Certificates))
+		for i := range c.Certificates {
+			certs[i] = stapler.Staple(c.Certificates[i])
+		}
+		c.Certificates = certs
+	}
+}
+
+// Staple returns a copy of the certificate with the cached OCSP response.
+func (s *OCSPStapler) Staple(cert tls.Certificate) tls.Certificate {
+	leaf, issuer, err := leafAndIssuer(&cert)
+	if err != nil {
+		return cert
+	}
+	responderURL := s.responderURL
+	if responderURL == "" {
+		if len(leaf.OCSPServer) == 0 {
+			return cert
+		}
+		responderURL = leaf.OCSPServer[0]
+	}
+	key := ocspCacheKey(leaf, issuer)
+	now := time.Now()
+
+	s.mu.Lock()
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &staplerEntry{
+			leaf:   leaf,
+			issuer: issuer,
+			url:    responderURL,
+		}
+		s.entries[key] = entry
+	}
+	entry.lastUsed = now
+	staple := entry.raw
+	if entry.response != nil && !entry.response.NextUpdate.IsZero() && now.After(entry.response.NextUpdate) {
+		staple = nil
+	}
+	if !entry.fetching && !now.Before(entry.refreshAt) {
+		select {
+		case s.fetchCh <- key:
+			entry.fetching = true
+		default:
+		}
+	}
+	s.mu.Unlock()
+
+	cert.OCSPStaple = staple
+	return cert
+}
+
+func (s *OCSPStapler) fetch(ctx context.Context, key string, entry *staplerEntry) {
+	ctx, cancel := context.WithTimeout(ctx, defaultOCSPTimeout)
+	defer cancel()
+
+	resp, raw, err := fetchOCSP(ctx, s.client, entry.url, entry.leaf, entry.issuer)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry.fetching = false
+	serial := keyutil.GetHexFormatted(entry.leaf.SerialNumber.Bytes(), ":")
+	if err != nil {
+		s.logger.Warn("ocsp staple fetch failed", slog.String("serial", serial), slog.String("error", err.Error()))
+		entry.refreshAt = time.Now().Add(s.retryInterval)
+		return
+	}
+	switch resp.Status {
+	case ocsp.Good:
+	case ocsp.Revoked:
+		s.logger.Warn("ocsp staple reports certificate as revoked", slog.String("serial", serial))
+	default:
+		s.logger.Warn("ocsp staple reports unknown certificate status", slog.String("serial", serial))
+		entry.refreshAt = time.Now().Add(s.retryInterval)
+		return
+	}
+	if _, ok := s.entries[key]; !ok {
+		return
+	}
+	entry.raw = raw
+	entry.response = resp
+	entry.refreshAt = ocspRefreshTime(resp, defaultStaplerValidity)
+	s.logger.Debug("ocsp staple fetched", slog.String("serial", serial), slog.Time("refreshAt", entry.refreshAt))
+}
+
+func (s *OCSPStapler) run(ctx context.Context) {
+	ticker := time.NewTicker(s.checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case key := <-s.fetchCh:
+			s.mu.Lock()
+			entry, ok := s.entries[key]
+			s.mu.Unlock()
+			if ok {
+				go s.fetch(ctx, key, entry)
+			}
+		case <-ticker.C:
+			s.refresh(ctx)
+		}
+	}
+}
+
+func (s *OCSPStapler) refresh(ctx context.Context) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, entry := range s.entries {
+		if now.Sub(entry.lastUsed) > s.unusedTTL {
+			// certificate was rotated out
+			delete(s.entries, key)
+			continue
+		}
+		if !entry.fetching && !now.Before(entry.refreshAt) {
+			entry.fetching = true
+			go s.fetch(ctx, key, entry)
+		}
+	}
+}
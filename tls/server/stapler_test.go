@@ -0,0 +1,153 @@
+package tlsserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/cert-source/internal/testutil"
+	"github.com/grepplabs/cert-source/tls/server/filesource"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestOCSPStapler(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	responder := testutil.NewOCSPResponder(bundle.CATLSCert, bundle.CAX509Cert)
+	defer responder.Close()
+
+	dir := t.TempDir()
+	certFile, keyFile := createTempPair(t, dir)
+	_, x509Cert1, err := testutil.GenerateServerCertChain(bundle.CATLSCert, responder.URL, certFile, keyFile)
+	require.NoError(t, err)
+
+	rotatedCh := make(chan struct{}, 1)
+	src := filesource.MustNew(
+		filesource.WithX509KeyPair(certFile.Name(), keyFile.Name()),
+		filesource.WithRefresh(time.Second),
+		filesource.WithNotifyFunc(func() {
+			rotatedCh <- struct{}{}
+		}),
+	)
+	stapler := NewOCSPStapler(t.Context(), slog.Default(),
+		WithOCSPStaplerCheckInterval(100*time.Millisecond),
+		WithOCSPStaplerRetryInterval(100*time.Millisecond),
+	)
+	tlsConfig := MustNewServerConfig(t.Context(), slog.Default(), src, WithTLSServerOCSPStapler(stapler))
+	addr := serveTLS(t, tlsConfig)
+
+	requireStapledSerial(t, addr, bundle.CAX509Cert, x509Cert1.SerialNumber)
+	require.Positive(t, responder.Requests.Load())
+
+	// rotate the certificate
+	rotatedCertFile, rotatedKeyFile := createTempPair(t, t.TempDir())
+	_, x509Cert2, err := testutil.GenerateServerCertChain(bundle.CATLSCert, responder.URL, rotatedCertFile, rotatedKeyFile)
+	require.NoError(t, err)
+	require.NoError(t, os.Rename(rotatedCertFile.Name(), certFile.Name()))
+	require.NoError(t, os.Rename(rotatedKeyFile.Name(), keyFile.Name()))
+
+	select {
+	case <-rotatedCh:
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected certificate change notification")
+	}
+	requireStapledSerial(t, addr, bundle.CAX509Cert, x509Cert2.SerialNumber)
+}
+
+func TestOCSPStaplerRefresh(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	responder := testutil.NewOCSPResponder(bundle.CATLSCert, bundle.CAX509Cert)
+	defer responder.Close()
+	// refresh is due halfway through the validity
+	responder.Validity = 200 * time.Millisecond
+
+	certFile, keyFile := createTempPair(t, t.TempDir())
+	tlsCert, _, err := testutil.GenerateServerCertChain(bundle.CATLSCert, responder.URL, certFile, keyFile)
+	require.NoError(t, err)
+
+	stapler := NewOCSPStapler(t.Context(), slog.Default(), WithOCSPStaplerCheckInterval(50*time.Millisecond))
+	require.Eventually(t, func() bool {
+		return len(stapler.Staple(*tlsCert).OCSPStaple) != 0
+	}, 3*time.Second, 20*time.Millisecond)
+
+	requests := responder.Requests.Load()
+	require.Eventually(t, func() bool {
+		return responder.Requests.Load() > requests+1
+	}, 3*time.Second, 20*time.Millisecond)
+}
+
+func TestOCSPStaplerWithoutResponder(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	stapler := NewOCSPStapler(t.Context(), slog.Default())
+	// no issuer in the chain and no responder URL
+	stapled := stapler.Staple(*bundle.ServerTLSCert)
+	require.Empty(t, stapled.OCSPStaple)
+}
+
+func TestOCSPStaplerNonPositiveCheckInterval(t *testing.T) {
+	for _, checkInterval := range []time.Duration{0, -time.Second} {
+		stapler := NewOCSPStapler(t.Context(), slog.Default(), WithOCSPStaplerCheckInterval(checkInterval))
+		require.Equal(t, defaultStaplerCheckInterval, stapler.checkInterval)
+	}
+}
+
+func createTempPair(t *testing.T, dir string) (*os.File, *os.File) {
+	t.Helper()
+	certFile, err := os.CreateTemp(dir, "cert-")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = certFile.Close() })
+	keyFile, err := os.CreateTemp(dir, "key-")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = keyFile.Close() })
+	return certFile, keyFile
+}
+
+func serveTLS(t *testing.T, tlsConfig *tls.Config) string {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = conn.(*tls.Conn).Handshake()
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func requireStapledSerial(t *testing.T, addr string, caCert *x509.Certificate, serialNumber *big.Int) {
+	t.Helper()
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(caCert)
+	require.Eventually(t, func() bool {
+		conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: rootCAs, ServerName: "localhost"})
+		if err != nil {
+			return false
+		}
+		defer conn.Close()
+		staple := conn.ConnectionState().OCSPResponse
+		if len(staple) == 0 {
+			return false
+		}
+		resp, err := ocsp.ParseResponse(staple, caCert)
+		require.NoError(t, err)
+		return resp.SerialNumber.Cmp(serialNumber) == 0 && resp.Status == ocsp.Good
+	}, 5*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,48 @@
+package spiffesource
+
+import (
+	"log/slog"
+)
+
+type Option func(*spiffeSource)
+
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *spiffeSource) {
+		s.logger = logger
+	}
+}
+
+// WithAddr sets the Workload API address, e.g. unix:///run/spire/agent.sock. A plain socket path is accepted as well.
+// The default is taken from the SPIFFE_ENDPOINT_SOCKET environment variable.
+func WithAddr(addr string) Option {
+	return func(s *spiffeSource) {
+		s.addr = addr
+	}
+}
+
+// WithSPIFFEID selects the SVID with the SPIFFE ID when the workload is issued more than one. The default is the first SVID.
+func WithSPIFFEID(spiffeID string) Option {
+	return func(s *spiffeSource) {
+		s.spiffeID = spiffeID
+	}
+}
+
+// WithFederatedBundles enables trusting the bundles of the federated trust domains. It is enabled by default.
+func WithFederatedBundles(federated bool) Option {
+	return func(s *spiffeSource) {
+		s.federated = federated
+	}
+}
+
+func WithNotifyFunc(notifyFunc func()) Option {
+	return func(s *spiffeSource) {
+		s.notifyFunc = notifyFunc
+	}
+}
+
+// WithErrorFunc sets the function called with every load or Workload API watch error.
+func WithErrorFunc(errorFunc func(error)) Option {
+	return func(s *spiffeSource) {
+		s.errorFunc = errorFunc
+	}
+}
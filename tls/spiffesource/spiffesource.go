@@ -0,0 +1,256 @@
+package spiffesource
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	clientsource "github.com/grepplabs/cert-source/tls/client/source"
+	serversource "github.com/grepplabs/cert-source/tls/server/source"
+	"github.com/grepplabs/cert-source/tls/watcher"
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"github.com/spiffe/go-spiffe/v2/workloadapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// endpointSocketEnv is the environment variable with the default Workload API address.
+const endpointSocketEnv = "SPIFFE_ENDPOINT_SOCKET"
+
+// Source provides X.509 SVIDs and trust bundles streamed from the SPIFFE Workload API.
+// The server certificates verify clients against the bundles and the client certificates verify servers against them.
+type Source interface {
+	serversource.ServerCertsSource
+	clientsource.ClientCertsSource
+	watcher.StatusProvider
+}
+
+type spiffeSource struct {
+	addr       string
+	spiffeID   string
+	federated  bool
+	logger     *slog.Logger
+	notifyFunc func()
+	errorFunc  func(error)
+	status     watcher.Status
+
+	id spiffeid.ID
+}
+
+func New(opts ...Option) (Source, error) {
+	s := &spiffeSource{
+		federated: true,
+		logger:    slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.addr == "" && os.Getenv(endpointSocketEnv) == "" {
+		return nil, fmt.Errorf("spiffe source: workload API address is required, set it or %s", endpointSocketEnv)
+	}
+	if strings.HasPrefix(s.addr, "/") {
+		s.addr = "unix://" + s.addr
+	}
+	if s.spiffeID != "" {
+		id, err := spiffeid.FromString(s.spiffeID)
+		if err != nil {
+			return nil, fmt.Errorf("spiffe source: %w", err)
+		}
+		s.id = id
+	}
+	return s, nil
+}
+
+func MustNew(opts ...Option) Source {
+	source, err := New(opts...)
+	if err != nil {
+		panic(`spiffesource: New(): ` + err.Error())
+	}
+	return source
+}
+
+func (s *spiffeSource) ServerCerts(ctx context.Context) chan serversource.ServerCerts {
+	ch := make(chan serversource.ServerCerts, 1)
+	go func() {
+		defer close(ch)
+		watch(ctx, s, ch, s.serverCerts)
+	}()
+	return ch
+}
+
+func (s *spiffeSource) ClientCerts(ctx context.Context) chan clientsource.ClientCerts {
+	ch := make(chan clientsource.ClientCerts, 1)
+	go func() {
+		defer close(ch)
+		watch(ctx, s, ch, s.clientCerts)
+	}()
+	return ch
+}
+
+// Status returns the status of the certificate loads. The failures of the Workload API watch are counted as well.
+func (s *spiffeSource) Status() *watcher.Status {
+	return &s.status
+}
+
+func (s *spiffeSource) recordFailure(err error) {
+	s.status.RecordFailure(err)
+	if s.errorFunc != nil {
+		s.errorFunc(err)
+	}
+}
+
+func (s *spiffeSource) serverCerts(x509Context *workloadapi.X509Context) (*serversource.ServerCerts, error) {
+	certPEMBlock, keyPEMBlock, bundlesPEMBlock, err := s.pems(x509Context)
+	if err != nil {
+		return nil, err
+	}
+	return serversource.NewServerCerts(&serversource.ServerPEMs{
+		CertPEMBlock:       certPEMBlock,
+		KeyPEMBlock:        keyPEMBlock,
+		ClientAuthPEMBlock: bundlesPEMBlock,
+	})
+}
+
+func (s *spiffeSource) clientCerts(x509Context *workloadapi.X509Context) (*clientsource.ClientCerts, error) {
+	certPEMBlock, keyPEMBlock, bundlesPEMBlock, err := s.pems(x509Context)
+	if err != nil {
+		return nil, err
+	}
+	return clientsource.NewClientCerts(&clientsource.ClientPEMs{
+		CertPEMBlock:    certPEMBlock,
+		KeyPEMBlock:     keyPEMBlock,
+		RootCAsPEMBlock: bundlesPEMBlock,
+	}, false)
+}
+
+// pems returns the selected SVID and the trusted bundles in PEM format.
+func (s *spiffeSource) pems(x509Context *workloadapi.X509Context) ([]byte, []byte, []byte, error) {
+	svid, err := s.selectSVID(x509Context.SVIDs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	certPEMBlock, keyPEMBlock, err := svid.Marshal()
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("spiffe source: %w", err)
+	}
+	bundlesPEMBlock, err := s.bundlesPEM(x509Context.Bundles, svid.ID.TrustDomain())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return certPEMBlock, keyPEMBlock, bundlesPEMBlock, nil
+}
+
+// selectSVID returns the SVID with the configured SPIFFE ID or the default SVID.
+func (s *spiffeSource) selectSVID(svids []*x509svid.SVID) (*x509svid.SVID, error) {
+	if len(svids) == 0 {
+		return nil, errors.New("spiffe source: no SVIDs received")
+	}
+	if s.id.IsZero() {
+		return svids[0], nil
+	}
+	for _, svid := range svids {
+		if svid.ID == s.id {
+			return svid, nil
+		}
+	}
+	return nil, fmt.Errorf("spiffe source: SVID %s not received", s.id)
+}
+
+// bundlesPEM concatenates the bundle of the trust domain and, if enabled, the federated bundles sorted by trust domain.
+func (s *spiffeSource) bundlesPEM(bundles *x509bundle.Set, trustDomain spiffeid.TrustDomain) ([]byte, error) {
+	if !s.federated {
+		bundle, ok := bundles.Get(trustDomain)
+		if !ok {
+			return nil, fmt.Errorf("spiffe source: bundle for trust domain %s not received", trustDomain)
+		}
+		return bundle.Marshal()
+	}
+	var result []byte
+	for _, bundle := range bundles.Bundles() {
+		pemBlock, err := bundle.Marshal()
+		if err != nil {
+			return nil, fmt.Errorf("spiffe source: marshal bundle %s: %w", bundle.TrustDomain(), err)
+		}
+		result = append(result, pemBlock...)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("spiffe source: bundle for trust domain %s not received", trustDomain)
+	}
+	return result, nil
+}
+
+// watch streams the X.509 contexts pushed by the Workload API and sends the certificates to ch when the checksum changes.
+// It returns when ctx is done or the Workload API watch fails permanently.
+func watch[T any, PT interface {
+	GetChecksum() []byte
+	*T
+}](ctx context.Context, s *spiffeSource, ch chan T, convertFn func(*workloadapi.X509Context) (PT, error)) {
+	var clientOptions []workloadapi.ClientOption
+	if s.addr != "" {
+		clientOptions = append(clientOptions, workloadapi.WithAddr(s.addr))
+	}
+	client, err := workloadapi.New(ctx, clientOptions...)
+	if err != nil {
+		s.logger.Error("cannot create workload API client", slog.String("error", err.Error()))
+		s.recordFailure(err)
+		return
+	}
+	defer func() { _ = client.Close() }()
+	s.logger.Info("cert watch is started, workload API updates enabled")
+
+	var last PT
+	err = client.WatchX509Context(ctx, &x509ContextWatcher{
+		onUpdate: func(x509Context *workloadapi.X509Context) {
+			next, err := convertFn(x509Context)
+			if err != nil {
+				s.logger.Error("cannot load certificates", slog.String("error", err.Error()))
+				s.recordFailure(err)
+				return
+			}
+			s.status.RecordSuccess()
+			if last != nil && bytes.Equal(next.GetChecksum(), last.GetChecksum()) {
+				return
+			}
+			select {
+			case ch <- *next:
+			case <-ctx.Done():
+				return
+			}
+			last = next
+			if s.notifyFunc != nil {
+				s.notifyFunc()
+			}
+		},
+		onError: func(err error) {
+			if status.Code(err) != codes.Canceled {
+				s.logger.Warn("workload API watch error", slog.String("error", err.Error()))
+				s.recordFailure(err)
+			}
+		},
+	})
+	if err != nil && ctx.Err() == nil {
+		s.logger.Error("workload API watch failed", slog.String("error", err.Error()))
+		s.recordFailure(err)
+		return
+	}
+	s.logger.Info("cert watch is stopped")
+}
+
+type x509ContextWatcher struct {
+	onUpdate func(*workloadapi.X509Context)
+	onError  func(error)
+}
+
+func (w *x509ContextWatcher) OnX509ContextUpdate(x509Context *workloadapi.X509Context) {
+	w.onUpdate(x509Context)
+}
+
+func (w *x509ContextWatcher) OnX509ContextWatchError(err error) {
+	w.onError(err)
+}
@@ -0,0 +1,158 @@
+package spiffesource
+
+import (
+	"crypto/x509"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/cert-source/internal/testutil"
+	tlsclient "github.com/grepplabs/cert-source/tls/client"
+	tlsserver "github.com/grepplabs/cert-source/tls/server"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	serverID = "spiffe://example.org/server"
+	clientID = "spiffe://example.org/client"
+)
+
+func newWorkloadAPI(t *testing.T) *testutil.WorkloadAPI {
+	t.Helper()
+	api, err := testutil.NewWorkloadAPI()
+	require.NoError(t, err)
+	t.Cleanup(api.Close)
+	return api
+}
+
+func startServer(t *testing.T, src Source) string {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Client-ID", r.TLS.PeerCertificates[0].URIs[0].String())
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(ts.Close)
+	ts.TLS = tlsserver.MustNewServerConfig(t.Context(), slog.Default(), src)
+	ts.StartTLS()
+	// the SVIDs have no IP SANs
+	return strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)
+}
+
+func newClient(t *testing.T, src Source) *http.Client {
+	t.Helper()
+	store, err := tlsclient.NewTLSClientCertsStore(t.Context(), slog.Default(), src)
+	require.NoError(t, err)
+	return &http.Client{Transport: tlsclient.NewDefaultRoundTripper(tlsclient.WithClientCertsStore(store))}
+}
+
+func TestServerAndClientCerts(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	serverAPI := newWorkloadAPI(t)
+	serverSVID, _, err := testutil.GenerateSVID(bundle.CATLSCert, serverID, "localhost")
+	require.NoError(t, err)
+	require.NoError(t, serverAPI.SetX509SVID(serverID, serverSVID, []*x509.Certificate{bundle.CAX509Cert}, nil))
+
+	clientAPI := newWorkloadAPI(t)
+	clientSVID, _, err := testutil.GenerateSVID(bundle.CATLSCert, clientID)
+	require.NoError(t, err)
+	require.NoError(t, clientAPI.SetX509SVID(clientID, clientSVID, []*x509.Certificate{bundle.CAX509Cert}, nil))
+
+	serverURL := startServer(t, MustNew(WithAddr(serverAPI.Addr)))
+	resp, err := newClient(t, MustNew(WithAddr(clientAPI.Addr))).Get(serverURL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, clientID, resp.Header.Get("X-Client-ID"))
+}
+
+func TestPushedUpdate(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	api := newWorkloadAPI(t)
+	svid, _, err := testutil.GenerateSVID(bundle.CATLSCert, serverID, "localhost")
+	require.NoError(t, err)
+	require.NoError(t, api.SetX509SVID(serverID, svid, []*x509.Certificate{bundle.CAX509Cert}, nil))
+
+	var notified atomic.Int32
+	src := MustNew(WithAddr(api.Addr), WithNotifyFunc(func() { notified.Add(1) }))
+	store, err := tlsserver.NewServerCertsStore(t.Context(), slog.Default(), src)
+	require.NoError(t, err)
+	first := store.LoadServerCerts().Checksum
+
+	// the same SVID pushed again is not an update
+	require.NoError(t, api.SetX509SVID(serverID, svid, []*x509.Certificate{bundle.CAX509Cert}, nil))
+	time.Sleep(200 * time.Millisecond)
+	require.Equal(t, first, store.LoadServerCerts().Checksum)
+
+	rotated, _, err := testutil.GenerateSVID(bundle.CATLSCert, serverID, "localhost")
+	require.NoError(t, err)
+	require.NoError(t, api.SetX509SVID(serverID, rotated, []*x509.Certificate{bundle.CAX509Cert}, nil))
+	require.Eventually(t, func() bool {
+		return string(store.LoadServerCerts().Checksum) != string(first)
+	}, 5*time.Second, 20*time.Millisecond)
+	require.Equal(t, rotated.Certificate[0], store.LoadServerCerts().Certificates[0].Certificate[0])
+	require.Equal(t, int32(2), notified.Load())
+}
+
+func TestFederatedBundles(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+	federatedBundle := testutil.NewCertsBundle()
+	defer federatedBundle.Close()
+
+	serverAPI := newWorkloadAPI(t)
+	serverSVID, _, err := testutil.GenerateSVID(bundle.CATLSCert, serverID, "localhost")
+	require.NoError(t, err)
+	federated := map[string][]*x509.Certificate{"spiffe://partner.org": {federatedBundle.CAX509Cert}}
+	require.NoError(t, serverAPI.SetX509SVID(serverID, serverSVID, []*x509.Certificate{bundle.CAX509Cert}, federated))
+
+	clientAPI := newWorkloadAPI(t)
+	partnerID := "spiffe://partner.org/client"
+	clientSVID, _, err := testutil.GenerateSVID(federatedBundle.CATLSCert, partnerID)
+	require.NoError(t, err)
+	require.NoError(t, clientAPI.SetX509SVID(partnerID, clientSVID, []*x509.Certificate{federatedBundle.CAX509Cert}, map[string][]*x509.Certificate{"spiffe://example.org": {bundle.CAX509Cert}}))
+	client := newClient(t, MustNew(WithAddr(clientAPI.Addr)))
+
+	resp, err := client.Get(startServer(t, MustNew(WithAddr(serverAPI.Addr))))
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, partnerID, resp.Header.Get("X-Client-ID"))
+
+	// nolint:bodyclose
+	_, err = client.Get(startServer(t, MustNew(WithAddr(serverAPI.Addr), WithFederatedBundles(false))))
+	require.Error(t, err)
+}
+
+func TestSelectSPIFFEID(t *testing.T) {
+	bundle := testutil.NewCertsBundle()
+	defer bundle.Close()
+
+	api := newWorkloadAPI(t)
+	svid, _, err := testutil.GenerateSVID(bundle.CATLSCert, serverID, "localhost")
+	require.NoError(t, err)
+	require.NoError(t, api.SetX509SVID(serverID, svid, []*x509.Certificate{bundle.CAX509Cert}, nil))
+
+	store, err := tlsserver.NewServerCertsStore(t.Context(), slog.Default(), MustNew(WithAddr(api.Addr), WithSPIFFEID(serverID)))
+	require.NoError(t, err)
+	require.Len(t, store.LoadServerCerts().Certificates, 1)
+	require.Equal(t, serverID, store.LoadServerCerts().Certificates[0].Leaf.URIs[0].String())
+}
+
+func TestNewValidation(t *testing.T) {
+	t.Setenv(endpointSocketEnv, "")
+	_, err := New()
+	require.ErrorContains(t, err, "workload API address is required")
+
+	_, err = New(WithAddr("/tmp/agent.sock"), WithSPIFFEID("https://example.org/server"))
+	require.Error(t, err)
+
+	t.Setenv(endpointSocketEnv, "unix:///tmp/agent.sock")
+	_, err = New()
+	require.NoError(t, err)
+}
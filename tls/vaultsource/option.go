@@ -0,0 +1,159 @@
+package vaultsource
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/grepplabs/cert-source/tls/watcher"
+)
+
+type Option func(*vaultSource)
+
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *vaultSource) {
+		s.logger = logger
+	}
+}
+
+// WithAddress sets the Vault address, e.g. https://vault:8200.
+func WithAddress(address string) Option {
+	return func(s *vaultSource) {
+		s.client.address = address
+	}
+}
+
+func WithNamespace(namespace string) Option {
+	return func(s *vaultSource) {
+		s.client.namespace = namespace
+	}
+}
+
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *vaultSource) {
+		s.client.httpClient = client
+	}
+}
+
+// WithTimeout sets the timeout of a single Vault request.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *vaultSource) {
+		s.client.timeout = timeout
+	}
+}
+
+// WithToken authenticates with a Vault token.
+func WithToken(token string) Option {
+	return func(s *vaultSource) {
+		s.client.token = token
+	}
+}
+
+// WithAppRole authenticates with the AppRole auth method. The login is repeated before the token expires.
+func WithAppRole(roleID, secretID string) Option {
+	return func(s *vaultSource) {
+		s.client.roleID = roleID
+		s.client.secretID = secretID
+	}
+}
+
+// WithAppRoleMount sets the mount path of the AppRole auth method. Defaults to approle.
+func WithAppRoleMount(mount string) Option {
+	return func(s *vaultSource) {
+		s.client.appRoleMount = mount
+	}
+}
+
+// WithMount sets the mount path of the PKI secrets engine. Defaults to pki.
+func WithMount(mount string) Option {
+	return func(s *vaultSource) {
+		s.mount = mount
+	}
+}
+
+// WithRole sets the PKI role used to issue the certificates.
+func WithRole(role string) Option {
+	return func(s *vaultSource) {
+		s.role = role
+	}
+}
+
+func WithCommonName(commonName string) Option {
+	return func(s *vaultSource) {
+		s.commonName = commonName
+	}
+}
+
+func WithAltNames(altNames ...string) Option {
+	return func(s *vaultSource) {
+		s.altNames = append(s.altNames, altNames...)
+	}
+}
+
+func WithIPSANs(ipSANs ...string) Option {
+	return func(s *vaultSource) {
+		s.ipSANs = append(s.ipSANs, ipSANs...)
+	}
+}
+
+// WithTTL sets the requested certificate lifetime. The role default is used if not set.
+func WithTTL(ttl time.Duration) Option {
+	return func(s *vaultSource) {
+		s.ttl = ttl
+	}
+}
+
+// WithLocalKey generates the private key locally and lets Vault sign a CSR, so the key never leaves the process.
+func WithLocalKey(localKey bool) Option {
+	return func(s *vaultSource) {
+		s.localKey = localKey
+	}
+}
+
+// WithKeyType sets the type of the locally generated key. Defaults to KeyTypeEC.
+func WithKeyType(keyType KeyType) Option {
+	return func(s *vaultSource) {
+		s.keyType = keyType
+	}
+}
+
+// WithRenewFraction sets the fraction of the certificate lifetime after which the certificate is renewed. Defaults to 2/3.
+func WithRenewFraction(fraction float64) Option {
+	return func(s *vaultSource) {
+		s.renewFraction = fraction
+	}
+}
+
+// WithCheckInterval sets how often the renewal time is checked. Failures are retried with the backoff up to the interval.
+func WithCheckInterval(interval time.Duration) Option {
+	return func(s *vaultSource) {
+		s.checkInterval = interval
+	}
+}
+
+// WithClientAuth uses the CA chain of the PKI mount as server client CAs, so client certificates are required.
+func WithClientAuth(clientAuth bool) Option {
+	return func(s *vaultSource) {
+		s.clientAuth = clientAuth
+	}
+}
+
+func WithNotifyFunc(notifyFunc func()) Option {
+	return func(s *vaultSource) {
+		s.notifyFunc = notifyFunc
+	}
+}
+
+// WithErrorFunc sets the function called with every load error.
+func WithErrorFunc(errorFunc func(error)) Option {
+	return func(s *vaultSource) {
+		s.errorFunc = errorFunc
+	}
+}
+
+// WithBackoff sets the retries of failed loads. The default is watcher.DefaultBackoff.
+func WithBackoff(backoff watcher.Backoff) Option {
+	return func(s *vaultSource) {
+		s.backoff = backoff
+	}
+}
@@ -0,0 +1,212 @@
+package vaultsource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxResponseSize limits the size of the Vault responses, which carry a few certificates at most.
+const maxResponseSize = 4 << 20
+
+// vaultClient is a minimal client of the Vault HTTP API covering the PKI secrets engine and the token and AppRole auth methods.
+type vaultClient struct {
+	address      string
+	namespace    string
+	httpClient   *http.Client
+	timeout      time.Duration
+	appRoleMount string
+	roleID       string
+	secretID     string
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+type issueRequest struct {
+	CommonName string `json:"common_name"`
+	AltNames   string `json:"alt_names,omitempty"`
+	IPSANs     string `json:"ip_sans,omitempty"`
+	TTL        string `json:"ttl,omitempty"`
+	CSR        string `json:"csr,omitempty"`
+}
+
+type issueResponse struct {
+	Certificate  string   `json:"certificate"`
+	PrivateKey   string   `json:"private_key"`
+	IssuingCA    string   `json:"issuing_ca"`
+	CAChain      []string `json:"ca_chain"`
+	SerialNumber string   `json:"serial_number"`
+}
+
+type loginResponse struct {
+	ClientToken   string `json:"client_token"`
+	LeaseDuration int    `json:"lease_duration"`
+}
+
+type errorResponse struct {
+	Errors []string `json:"errors"`
+}
+
+type statusError struct {
+	method     string
+	path       string
+	statusCode int
+	messages   []string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("vault: %s %s: status %d: %s", e.method, e.path, e.statusCode, strings.Join(e.messages, "; "))
+}
+
+func (c *vaultClient) usesAppRole() bool {
+	return c.roleID != ""
+}
+
+// issue issues a certificate and a private key, or signs the CSR if it is set in the request.
+func (c *vaultClient) issue(ctx context.Context, mount, role string, req *issueRequest) (*issueResponse, error) {
+	op := "issue"
+	if req.CSR != "" {
+		op = "sign"
+	}
+	var resp struct {
+		Data issueResponse `json:"data"`
+	}
+	if err := c.authenticatedDo(ctx, http.MethodPost, fmt.Sprintf("/v1/%s/%s/%s", mount, op, role), req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Data.Certificate == "" {
+		return nil, fmt.Errorf("vault: %s: response without certificate", op)
+	}
+	return &resp.Data, nil
+}
+
+// caChain returns the PEM encoded CA chain of the PKI mount.
+func (c *vaultClient) caChain(ctx context.Context, mount string) ([]byte, error) {
+	body, err := c.do(ctx, http.MethodGet, fmt.Sprintf("/v1/%s/ca_chain", mount), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func (c *vaultClient) authenticatedDo(ctx context.Context, method, path string, in any, out any) error {
+	token, err := c.getToken(ctx)
+	if err != nil {
+		return err
+	}
+	err = c.doJSON(ctx, method, path, token, in, out)
+	var se *statusError
+	if c.usesAppRole() && errors.As(err, &se) && se.statusCode == http.StatusForbidden {
+		// the token could be revoked or expired before its lease, login again
+		c.resetToken(token)
+		if token, err = c.getToken(ctx); err != nil {
+			return err
+		}
+		err = c.doJSON(ctx, method, path, token, in, out)
+	}
+	return err
+}
+
+func (c *vaultClient) getToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.usesAppRole() {
+		if c.token == "" {
+			return "", errors.New("vault: token or AppRole credentials are required")
+		}
+		return c.token, nil
+	}
+	if c.token != "" && (c.tokenExpiry.IsZero() || time.Now().Before(c.tokenExpiry)) {
+		return c.token, nil
+	}
+	var resp struct {
+		Auth loginResponse `json:"auth"`
+	}
+	in := map[string]string{"role_id": c.roleID, "secret_id": c.secretID}
+	if err := c.doJSON(ctx, http.MethodPost, fmt.Sprintf("/v1/auth/%s/login", c.appRoleMount), "", in, &resp); err != nil {
+		return "", err
+	}
+	if resp.Auth.ClientToken == "" {
+		return "", errors.New("vault: AppRole login response without client token")
+	}
+	c.token = resp.Auth.ClientToken
+	c.tokenExpiry = time.Time{}
+	if resp.Auth.LeaseDuration > 0 {
+		// login again before the token expires
+		lease := time.Duration(resp.Auth.LeaseDuration) * time.Second
+		c.tokenExpiry = time.Now().Add(lease * 9 / 10)
+	}
+	return c.token, nil
+}
+
+func (c *vaultClient) resetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == token {
+		c.token = ""
+	}
+}
+
+func (c *vaultClient) doJSON(ctx context.Context, method, path, token string, in any, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	data, err := c.do(ctx, method, path, token, body)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("vault: %s %s: decode response: %w", method, path, err)
+	}
+	return nil
+}
+
+func (c *vaultClient) do(ctx context.Context, method, path, token string, body io.Reader) ([]byte, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.address, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if c.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.namespace)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vault: %s %s: %w", method, path, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("vault: %s %s: read response: %w", method, path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var errResp errorResponse
+		_ = json.Unmarshal(data, &errResp)
+		return nil, &statusError{method: method, path: path, statusCode: resp.StatusCode, messages: errResp.Errors}
+	}
+	return data, nil
+}
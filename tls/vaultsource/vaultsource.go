@@ -0,0 +1,293 @@
+package vaultsource
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	clientsource "github.com/grepplabs/cert-source/tls/client/source"
+	"github.com/grepplabs/cert-source/tls/keyutil"
+	serversource "github.com/grepplabs/cert-source/tls/server/source"
+	"github.com/grepplabs/cert-source/tls/watcher"
+)
+
+type KeyType string
+
+const (
+	KeyTypeEC  KeyType = "ec"
+	KeyTypeRSA KeyType = "rsa"
+)
+
+const (
+	defaultMount         = "pki"
+	defaultAppRoleMount  = "approle"
+	defaultRenewFraction = 2.0 / 3.0
+	defaultCheckInterval = 10 * time.Second
+	defaultTimeout       = 30 * time.Second
+)
+
+// Source provides server and client certificates issued by the Vault PKI secrets engine.
+type Source interface {
+	serversource.ServerCertsSource
+	clientsource.ClientCertsSource
+	watcher.StatusProvider
+}
+
+type vaultSource struct {
+	client        *vaultClient
+	mount         string
+	role          string
+	commonName    string
+	altNames      []string
+	ipSANs        []string
+	ttl           time.Duration
+	localKey      bool
+	keyType       KeyType
+	renewFraction float64
+	checkInterval time.Duration
+	clientAuth    bool
+	logger        *slog.Logger
+	notifyFunc    func()
+	errorFunc     func(error)
+	backoff       watcher.Backoff
+	status        watcher.Status
+
+	mu      sync.Mutex
+	current *issued
+}
+
+// issued is a certificate issued by Vault.
+type issued struct {
+	certPEMBlock []byte
+	keyPEMBlock  []byte
+	caPEMBlock   []byte
+	renewAt      time.Time
+}
+
+func New(opts ...Option) (Source, error) {
+	s := &vaultSource{
+		client: &vaultClient{
+			httpClient:   http.DefaultClient,
+			timeout:      defaultTimeout,
+			appRoleMount: defaultAppRoleMount,
+		},
+		mount:         defaultMount,
+		keyType:       KeyTypeEC,
+		renewFraction: defaultRenewFraction,
+		checkInterval: defaultCheckInterval,
+		backoff:       watcher.DefaultBackoff,
+		logger:        slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.client.address == "" {
+		return nil, errors.New("vault source: address is required")
+	}
+	if s.role == "" {
+		return nil, errors.New("vault source: role is required")
+	}
+	if s.commonName == "" {
+		return nil, errors.New("vault source: common name is required")
+	}
+	if s.renewFraction <= 0 || s.renewFraction >= 1 {
+		return nil, fmt.Errorf("vault source: renew fraction must be between 0 and 1: %v", s.renewFraction)
+	}
+	if s.keyType != KeyTypeEC && s.keyType != KeyTypeRSA {
+		return nil, fmt.Errorf("vault source: unsupported key type: %q", s.keyType)
+	}
+	// fail fast on invalid configuration or credentials
+	if _, err := s.load(context.Background()); err != nil {
+		return nil, err
+	}
+	s.status.RecordSuccess()
+	return s, nil
+}
+
+func MustNew(opts ...Option) Source {
+	source, err := New(opts...)
+	if err != nil {
+		panic(`vaultsource: New(): ` + err.Error())
+	}
+	return source
+}
+
+func (s *vaultSource) ServerCerts(ctx context.Context) chan serversource.ServerCerts {
+	ch := make(chan serversource.ServerCerts, 1)
+	go func() {
+		defer close(ch)
+		watcher.Watch(ctx, s.logger, ch, s.checkInterval, nil, func() (*serversource.ServerCerts, error) {
+			return s.serverCerts(ctx)
+		}, s.notifyFunc, s.watchOptions()...)
+	}()
+	return ch
+}
+
+func (s *vaultSource) ClientCerts(ctx context.Context) chan clientsource.ClientCerts {
+	ch := make(chan clientsource.ClientCerts, 1)
+	go func() {
+		defer close(ch)
+		watcher.Watch(ctx, s.logger, ch, s.checkInterval, nil, func() (*clientsource.ClientCerts, error) {
+			return s.clientCerts(ctx)
+		}, s.notifyFunc, s.watchOptions()...)
+	}()
+	return ch
+}
+
+// Status returns the status of the certificate loads.
+func (s *vaultSource) Status() *watcher.Status {
+	return &s.status
+}
+
+func (s *vaultSource) watchOptions() []watcher.Option {
+	return []watcher.Option{watcher.WithBackoff(s.backoff), watcher.WithErrorFunc(s.errorFunc), watcher.WithStatus(&s.status)}
+}
+
+func (s *vaultSource) serverCerts(ctx context.Context) (*serversource.ServerCerts, error) {
+	cert, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pemBlocks := &serversource.ServerPEMs{
+		CertPEMBlock: cert.certPEMBlock,
+		KeyPEMBlock:  cert.keyPEMBlock,
+	}
+	if s.clientAuth {
+		pemBlocks.ClientAuthPEMBlock = cert.caPEMBlock
+	}
+	return serversource.NewServerCerts(pemBlocks)
+}
+
+func (s *vaultSource) clientCerts(ctx context.Context) (*clientsource.ClientCerts, error) {
+	cert, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return clientsource.NewClientCerts(&clientsource.ClientPEMs{
+		CertPEMBlock:    cert.certPEMBlock,
+		KeyPEMBlock:     cert.keyPEMBlock,
+		RootCAsPEMBlock: cert.caPEMBlock,
+	}, false)
+}
+
+// load returns the current certificate and issues a new one when the renewal time is reached.
+// The certificate is shared between the server and the client certificates channels.
+func (s *vaultSource) load(ctx context.Context) (*issued, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current != nil && time.Now().Before(s.current.renewAt) {
+		return s.current, nil
+	}
+	cert, err := s.issue(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.current = cert
+	s.logger.Info(fmt.Sprintf("vault certificate for %s issued, renewal at %s", s.commonName, cert.renewAt.Format(time.RFC3339)))
+	return cert, nil
+}
+
+func (s *vaultSource) issue(ctx context.Context) (*issued, error) {
+	req := &issueRequest{
+		CommonName: s.commonName,
+		AltNames:   strings.Join(s.altNames, ","),
+		IPSANs:     strings.Join(s.ipSANs, ","),
+	}
+	if s.ttl > 0 {
+		req.TTL = s.ttl.String()
+	}
+	var keyPEMBlock []byte
+	if s.localKey {
+		var err error
+		var csr []byte
+		if keyPEMBlock, csr, err = s.newCSR(); err != nil {
+			return nil, err
+		}
+		req.CSR = string(csr)
+	}
+	resp, err := s.client.issue(ctx, s.mount, s.role, req)
+	if err != nil {
+		return nil, err
+	}
+	if !s.localKey {
+		if resp.PrivateKey == "" {
+			return nil, errors.New("vault source: issue response without private key")
+		}
+		keyPEMBlock = []byte(resp.PrivateKey)
+	}
+	caPEMBlock, err := s.client.caChain(ctx, s.mount)
+	if err != nil {
+		return nil, err
+	}
+	if len(caPEMBlock) == 0 {
+		caPEMBlock = []byte(resp.IssuingCA)
+	}
+	certs, err := keyutil.ParseCertsPEM([]byte(resp.Certificate))
+	if err != nil {
+		return nil, fmt.Errorf("vault source: parse issued certificate: %w", err)
+	}
+	leaf := certs[0]
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+	return &issued{
+		certPEMBlock: appendChain([]byte(resp.Certificate), resp.CAChain),
+		keyPEMBlock:  keyPEMBlock,
+		caPEMBlock:   caPEMBlock,
+		renewAt:      leaf.NotBefore.Add(time.Duration(float64(lifetime) * s.renewFraction)),
+	}, nil
+}
+
+func (s *vaultSource) newCSR() ([]byte, []byte, error) {
+	var (
+		privateKey  any
+		keyPEMBlock []byte
+		err         error
+	)
+	switch s.keyType {
+	case KeyTypeRSA:
+		privateKey, keyPEMBlock, _, _, err = keyutil.GenerateRSAKeys()
+	default:
+		privateKey, keyPEMBlock, _, _, err = keyutil.GenerateECKeys()
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: s.commonName},
+		DNSNames: s.altNames,
+	}
+	for _, ipSAN := range s.ipSANs {
+		if ip := net.ParseIP(ipSAN); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		}
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, privateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("vault source: create CSR: %w", err)
+	}
+	return keyPEMBlock, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
+
+// appendChain appends the intermediate certificates which are not the certificate itself.
+func appendChain(certPEMBlock []byte, chain []string) []byte {
+	result := append([]byte{}, certPEMBlock...)
+	for _, cert := range chain {
+		if strings.TrimSpace(cert) == strings.TrimSpace(string(certPEMBlock)) {
+			continue
+		}
+		if len(result) != 0 && result[len(result)-1] != '\n' {
+			result = append(result, '\n')
+		}
+		result = append(result, cert...)
+	}
+	return result
+}
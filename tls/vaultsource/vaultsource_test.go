@@ -0,0 +1,192 @@
+package vaultsource
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/cert-source/internal/testutil"
+	tlsclient "github.com/grepplabs/cert-source/tls/client"
+	"github.com/grepplabs/cert-source/tls/keyutil"
+	tlsserver "github.com/grepplabs/cert-source/tls/server"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testRole  = "web"
+	testToken = "root-token"
+)
+
+func newVault(t *testing.T) *testutil.VaultPKI {
+	t.Helper()
+	bundle := testutil.NewCertsBundle()
+	t.Cleanup(bundle.Close)
+	vault := testutil.NewVaultPKI(bundle.CATLSCert, bundle.CAX509Cert, testRole, testToken)
+	t.Cleanup(vault.Close)
+	return vault
+}
+
+func TestServerAndClientCerts(t *testing.T) {
+	vault := newVault(t)
+
+	src := MustNew(
+		WithAddress(vault.URL),
+		WithToken(testToken),
+		WithRole(testRole),
+		WithCommonName("localhost"),
+		WithAltNames("localhost"),
+		WithIPSANs("127.0.0.1"),
+		WithClientAuth(true),
+	)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Client-CN", r.TLS.PeerCertificates[0].Subject.CommonName)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	ts.TLS = tlsserver.MustNewServerConfig(t.Context(), slog.Default(), src)
+	ts.StartTLS()
+
+	clientStore, err := tlsclient.NewTLSClientCertsStore(t.Context(), slog.Default(), src)
+	require.NoError(t, err)
+	require.NotNil(t, clientStore.LoadClientCerts().Certificate)
+	require.NotNil(t, clientStore.LoadClientCerts().RootCAs)
+
+	client := &http.Client{Transport: tlsclient.NewDefaultRoundTripper(tlsclient.WithClientCertsStore(clientStore))}
+	resp, err := client.Get(ts.URL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, "localhost", resp.Header.Get("X-Client-CN"))
+
+	// server and client share the issued certificate
+	require.Equal(t, int32(1), vault.Issued.Load())
+	require.Equal(t, int32(0), vault.Signed.Load())
+}
+
+func TestLocalKey(t *testing.T) {
+	vault := newVault(t)
+
+	src := MustNew(
+		WithAddress(vault.URL),
+		WithToken(testToken),
+		WithRole(testRole),
+		WithCommonName("localhost"),
+		WithLocalKey(true),
+	)
+	store, err := tlsserver.NewServerCertsStore(t.Context(), slog.Default(), src)
+	require.NoError(t, err)
+
+	require.Equal(t, int32(0), vault.Issued.Load())
+	require.Equal(t, int32(1), vault.Signed.Load())
+
+	cs := store.LoadServerCerts()
+	require.Len(t, cs.Certificates, 1)
+	require.Nil(t, cs.ClientCAs)
+	require.True(t, keyutil.KeysMatch(cs.Certificates[0].PrivateKey, vault.LastIssued().PublicKey))
+	require.Equal(t, "localhost", vault.LastIssued().Subject.CommonName)
+}
+
+func TestRenewal(t *testing.T) {
+	vault := newVault(t)
+
+	src := MustNew(
+		WithAddress(vault.URL),
+		WithToken(testToken),
+		WithRole(testRole),
+		WithCommonName("localhost"),
+		WithTTL(2*time.Second),
+		WithRenewFraction(0.5),
+		WithCheckInterval(time.Second),
+	)
+	ch := src.ServerCerts(t.Context())
+	initial := <-ch
+	select {
+	case renewed := <-ch:
+		require.NotEqual(t, initial.Checksum, renewed.Checksum)
+		require.NotEqual(t, initial.Certificates[0].Leaf.SerialNumber, renewed.Certificates[0].Leaf.SerialNumber)
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected renewed certificate")
+	}
+	require.GreaterOrEqual(t, vault.Issued.Load(), int32(2))
+}
+
+func TestAppRole(t *testing.T) {
+	vault := newVault(t)
+	vault.SetAppRole("role-id", "secret-id")
+
+	src := MustNew(
+		WithAddress(vault.URL),
+		WithAppRole("role-id", "secret-id"),
+		WithRole(testRole),
+		WithCommonName("localhost"),
+		WithTTL(2*time.Second),
+		WithRenewFraction(0.5),
+		WithCheckInterval(time.Second),
+	)
+	require.Equal(t, int32(1), vault.Logins.Load())
+
+	// the token is revoked, so the renewal logs in again
+	vault.RevokeTokens()
+	ch := src.ServerCerts(t.Context())
+	<-ch
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected renewed certificate")
+	}
+	require.Equal(t, int32(2), vault.Logins.Load())
+}
+
+func TestNewErrors(t *testing.T) {
+	vault := newVault(t)
+	vault.SetAppRole("role-id", "secret-id")
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		errorText string
+	}{
+		{
+			name:      "missing address",
+			opts:      []Option{WithToken(testToken), WithRole(testRole), WithCommonName("localhost")},
+			errorText: "address is required",
+		},
+		{
+			name:      "missing role",
+			opts:      []Option{WithAddress(vault.URL), WithToken(testToken), WithCommonName("localhost")},
+			errorText: "role is required",
+		},
+		{
+			name:      "missing credentials",
+			opts:      []Option{WithAddress(vault.URL), WithRole(testRole), WithCommonName("localhost")},
+			errorText: "token or AppRole credentials are required",
+		},
+		{
+			name:      "invalid token",
+			opts:      []Option{WithAddress(vault.URL), WithToken("invalid"), WithRole(testRole), WithCommonName("localhost")},
+			errorText: "status 403: permission denied",
+		},
+		{
+			name:      "invalid secret ID",
+			opts:      []Option{WithAddress(vault.URL), WithAppRole("role-id", "invalid"), WithRole(testRole), WithCommonName("localhost")},
+			errorText: "invalid role or secret ID",
+		},
+		{
+			name:      "unknown role",
+			opts:      []Option{WithAddress(vault.URL), WithToken(testToken), WithRole("unknown"), WithCommonName("localhost")},
+			errorText: "unknown role",
+		},
+		{
+			name:      "invalid renew fraction",
+			opts:      []Option{WithAddress(vault.URL), WithToken(testToken), WithRole(testRole), WithCommonName("localhost"), WithRenewFraction(1)},
+			errorText: "renew fraction must be between 0 and 1",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(tc.opts...)
+			require.ErrorContains(t, err, tc.errorText)
+		})
+	}
+}
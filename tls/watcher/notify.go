@@ -0,0 +1,122 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// DefaultDebounce is the quiet period after the last file system event before a reload is triggered.
+	DefaultDebounce = 100 * time.Millisecond
+	// DefaultFallbackRefresh is the polling interval used as a safety net when file events are enabled without refresh.
+	DefaultFallbackRefresh = 1 * time.Minute
+
+	dataLink = "..data"
+)
+
+// FileEvents delivers debounced notifications about changes of the watched files.
+type FileEvents struct {
+	C         <-chan struct{}
+	watcher   *fsnotify.Watcher
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Close stops watching the files.
+func (e *FileEvents) Close() error {
+	var err error
+	e.closeOnce.Do(func() {
+		close(e.done)
+		err = e.watcher.Close()
+	})
+	return err
+}
+
+// WatchFiles watches the parent directories of the given files and signals on C after writes, renames or
+// symlink swaps (e.g. Kubernetes ..data) settle for the debounce window.
+func WatchFiles(logger *slog.Logger, files []string, debounce time.Duration) (*FileEvents, error) {
+	if len(files) == 0 {
+		return nil, errors.New("file watch: no files to watch")
+	}
+	if debounce <= 0 {
+		debounce = DefaultDebounce
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]struct{}, len(files))
+	dirs := make(map[string]struct{})
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		file = filepath.Clean(file)
+		names[file] = struct{}{}
+		dirs[filepath.Dir(file)] = struct{}{}
+	}
+	for dir := range dirs {
+		if err = w.Add(dir); err != nil {
+			_ = w.Close()
+			return nil, fmt.Errorf("file watch: watch dir %s: %w", dir, err)
+		}
+	}
+	ch := make(chan struct{}, 1)
+	e := &FileEvents{
+		C:       ch,
+		watcher: w,
+		done:    make(chan struct{}),
+	}
+	go e.run(logger, ch, names, debounce)
+	return e, nil
+}
+
+func (e *FileEvents) run(logger *slog.Logger, ch chan struct{}, names map[string]struct{}, debounce time.Duration) {
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-e.done:
+			return
+		case event, ok := <-e.watcher.Events:
+			if !ok {
+				return
+			}
+			if !isRelevant(event, names) {
+				continue
+			}
+			logger.Debug("cert file event", slog.String("event", event.String()))
+			timer.Reset(debounce)
+		case err, ok := <-e.watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Warn("cert file watch error", slog.String("error", err.Error()))
+		case <-timer.C:
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func isRelevant(event fsnotify.Event, names map[string]struct{}) bool {
+	if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Rename) && !event.Has(fsnotify.Remove) {
+		return false
+	}
+	name := filepath.Clean(event.Name)
+	if filepath.Base(name) == dataLink {
+		return true
+	}
+	_, ok := names[name]
+	return ok
+}
@@ -0,0 +1,90 @@
+package watcher
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/grepplabs/cert-source/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchFilesWrite(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "cert.pem")
+	other := filepath.Join(dir, "other.pem")
+	require.NoError(t, os.WriteFile(file, []byte("v1"), 0o600))
+
+	events, err := WatchFiles(slog.Default(), []string{file}, 50*time.Millisecond)
+	require.NoError(t, err)
+	defer events.Close()
+
+	// unrelated file in the same directory
+	require.NoError(t, os.WriteFile(other, []byte("v1"), 0o600))
+	requireNoEvent(t, events.C)
+
+	// several writes are debounced into a single event
+	for range 3 {
+		require.NoError(t, os.WriteFile(file, []byte("v2"), 0o600))
+	}
+	requireEvent(t, events.C)
+	requireNoEvent(t, events.C)
+}
+
+func TestWatchFilesRename(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "cert.pem")
+	tmp := filepath.Join(t.TempDir(), "cert.pem")
+	require.NoError(t, os.WriteFile(file, []byte("v1"), 0o600))
+	require.NoError(t, os.WriteFile(tmp, []byte("v2"), 0o600))
+
+	events, err := WatchFiles(slog.Default(), []string{file}, 0)
+	require.NoError(t, err)
+	defer events.Close()
+
+	require.NoError(t, os.Rename(tmp, file))
+	requireEvent(t, events.C)
+}
+
+func TestWatchFilesDataLinkSwap(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, testutil.WriteDataDir(dir, map[string][]byte{"tls.crt": []byte("v1")}))
+
+	events, err := WatchFiles(slog.Default(), []string{filepath.Join(dir, "tls.crt")}, 0)
+	require.NoError(t, err)
+	defer events.Close()
+
+	require.NoError(t, testutil.WriteDataDir(dir, map[string][]byte{"tls.crt": []byte("v2")}))
+	requireEvent(t, events.C)
+}
+
+func TestWatchFilesClose(t *testing.T) {
+	dir := t.TempDir()
+	events, err := WatchFiles(slog.Default(), []string{filepath.Join(dir, "cert.pem")}, 0)
+	require.NoError(t, err)
+	require.NoError(t, events.Close())
+	require.NoError(t, events.Close())
+
+	_, err = WatchFiles(slog.Default(), nil, 0)
+	require.Error(t, err)
+}
+
+func requireEvent(t *testing.T, ch <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected file event")
+	}
+}
+
+func requireNoEvent(t *testing.T, ch <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-ch:
+		t.Fatal("unexpected file event")
+	case <-time.After(300 * time.Millisecond):
+	}
+}
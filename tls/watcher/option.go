@@ -0,0 +1,77 @@
+package watcher
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// DefaultBackoff retries failed loads after 1s, doubling the delay up to the refresh interval.
+var DefaultBackoff = Backoff{Initial: time.Second, Multiplier: 2, Jitter: 0.2}
+
+// Backoff configures the retries of failed loads. The delay starts at Initial and is multiplied by Multiplier
+// after every consecutive failure up to Max, which is capped by the refresh interval.
+// Jitter randomizes the delay by the fraction, e.g. 0.2 is ±20%. If Initial is not set, the refresh interval is used.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64
+}
+
+func (b Backoff) delay(failures int, refresh time.Duration) time.Duration {
+	if b.Initial <= 0 {
+		return refresh
+	}
+	maxDelay := b.Max
+	if maxDelay <= 0 || maxDelay > refresh {
+		maxDelay = refresh
+	}
+	d := float64(b.Initial)
+	for i := 1; i < failures && b.Multiplier > 1 && d < float64(maxDelay); i++ {
+		d *= b.Multiplier
+	}
+	d = min(d, float64(maxDelay))
+	if b.Jitter > 0 {
+		// nolint:gosec
+		d += d * b.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+type options struct {
+	backoff   Backoff
+	errorFunc func(error)
+	status    *Status
+	reloadAt  func() time.Time
+}
+
+type Option func(*options)
+
+// WithBackoff sets the retries of failed loads. The default is DefaultBackoff.
+func WithBackoff(backoff Backoff) Option {
+	return func(o *options) {
+		o.backoff = backoff
+	}
+}
+
+// WithErrorFunc sets the function called with every load error.
+func WithErrorFunc(errorFunc func(error)) Option {
+	return func(o *options) {
+		o.errorFunc = errorFunc
+	}
+}
+
+// WithStatus records the outcome of the loads in the status.
+func WithStatus(status *Status) Option {
+	return func(o *options) {
+		o.status = status
+	}
+}
+
+// WithReloadAt schedules an additional load at the time returned by reloadAt, which is called after every successful load.
+// The zero time schedules no load. The watch keeps running for the scheduled loads when no refresh interval is set.
+func WithReloadAt(reloadAt func() time.Time) Option {
+	return func(o *options) {
+		o.reloadAt = reloadAt
+	}
+}
@@ -0,0 +1,57 @@
+package watcher
+
+import (
+	"sync"
+	"time"
+)
+
+// StatusProvider is implemented by the sources which report the status of their loads, e.g. for health checks.
+type StatusProvider interface {
+	Status() *Status
+}
+
+// Status records the outcome of the loads of a source. It is safe for concurrent use.
+type Status struct {
+	mu          sync.RWMutex
+	lastSuccess time.Time
+	lastError   error
+	failures    int
+}
+
+// RecordSuccess records a successful load and resets the consecutive failures.
+func (s *Status) RecordSuccess() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastSuccess = time.Now()
+	s.lastError = nil
+	s.failures = 0
+}
+
+// RecordFailure records a failed load.
+func (s *Status) RecordFailure(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastError = err
+	s.failures++
+}
+
+// LastSuccess returns the time of the last successful load. It is zero if no load succeeded.
+func (s *Status) LastSuccess() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastSuccess
+}
+
+// LastError returns the error of the last load, or nil if it succeeded.
+func (s *Status) LastError() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastError
+}
+
+// ConsecutiveFailures returns the number of failed loads since the last successful one.
+func (s *Status) ConsecutiveFailures() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.failures
+}
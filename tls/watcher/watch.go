@@ -1,31 +1,107 @@
 package watcher
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"reflect"
 	"time"
 )
 
+// Watch loads the certificates every refresh interval and sends them to ch when the checksum changes.
+// It returns when ctx is done or, if refresh is not positive, after the first load.
+// Failed loads are retried with the backoff, see WithBackoff.
 func Watch[T any, PT interface {
 	GetChecksum() []byte
 	*T
-}](logger *slog.Logger, ch chan T, refresh time.Duration, init PT, loadFn func() (PT, error), changedFn func()) {
-	once := refresh <= 0
+}](ctx context.Context, logger *slog.Logger, ch chan T, refresh time.Duration, init PT, loadFn func() (PT, error), changedFn func(), opts ...Option) {
+	WatchEvents(ctx, logger, ch, refresh, nil, init, loadFn, changedFn, opts...)
+}
+
+// WatchEvents is like Watch, but additionally reloads as soon as a signal is received on events.
+// The refresh interval is kept as a fallback for missed events; if it is not set, DefaultFallbackRefresh is used.
+func WatchEvents[T any, PT interface {
+	GetChecksum() []byte
+	*T
+}](ctx context.Context, logger *slog.Logger, ch chan T, refresh time.Duration, events <-chan struct{}, init PT, loadFn func() (PT, error), changedFn func(), opts ...Option) {
+	o := options{backoff: DefaultBackoff}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	once := refresh <= 0 && events == nil && o.reloadAt == nil
 
+	if events != nil && refresh <= 0 {
+		refresh = DefaultFallbackRefresh
+	}
+	// without refresh interval, only the scheduled loads are awaited
+	poll := refresh > 0
 	if refresh < time.Second {
 		refresh = time.Second
 	}
-	logger.Info(fmt.Sprintf("cert watch is started, refresh interval %s", refresh))
+	switch {
+	case events != nil:
+		logger.Info(fmt.Sprintf("cert watch is started, file events enabled, refresh interval %s", refresh))
+	case !poll && !once:
+		logger.Info("cert watch is started, scheduled loads only")
+	default:
+		logger.Info(fmt.Sprintf("cert watch is started, refresh interval %s", refresh))
+	}
+	// wait waits for d, the next event or ctx; a negative d waits without timeout
+	wait := func(d time.Duration) bool {
+		var timeout <-chan time.Time
+		if d >= 0 {
+			timer := time.NewTimer(d)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			logger.Info("cert watch is stopped")
+			return false
+		case <-timeout:
+		case <-events:
+		}
+		return true
+	}
+	// nextLoad returns the wait after a successful load
+	nextLoad := func() time.Duration {
+		d := time.Duration(-1)
+		if poll {
+			d = refresh
+		}
+		if o.reloadAt != nil {
+			if at := o.reloadAt(); !at.IsZero() {
+				if until := max(time.Until(at), 0); d < 0 || until < d {
+					d = until
+				}
+			}
+		}
+		return d
+	}
 
 	var last = init
+	failures := 0
 	for {
 		next, err := loadFn()
 		if err != nil {
-			logger.Error("cannot load certificates", slog.String("error", err.Error()))
-			time.Sleep(refresh)
+			failures++
+			if o.status != nil {
+				o.status.RecordFailure(err)
+			}
+			if o.errorFunc != nil {
+				o.errorFunc(err)
+			}
+			delay := o.backoff.delay(failures, refresh)
+			logger.Error("cannot load certificates", slog.String("error", err.Error()), slog.Int("failures", failures), slog.Duration("retry", delay))
+			if !wait(delay) {
+				return
+			}
 			continue
 		}
+		failures = 0
+		if o.status != nil {
+			o.status.RecordSuccess()
+		}
 		if last != nil {
 			if reflect.DeepEqual(next.GetChecksum(), last.GetChecksum()) {
 				if once && init != nil {
@@ -33,12 +109,19 @@ func Watch[T any, PT interface {
 					logger.Info("cert watch is disabled")
 					return
 				}
-				time.Sleep(refresh)
+				if !wait(nextLoad()) {
+					return
+				}
 				continue
 			}
 		}
 
-		ch <- *next
+		select {
+		case ch <- *next:
+		case <-ctx.Done():
+			logger.Info("cert watch is stopped")
+			return
+		}
 		last = next
 
 		if changedFn != nil {
@@ -48,6 +131,31 @@ func Watch[T any, PT interface {
 			logger.Info("cert watch is disabled")
 			return
 		}
-		time.Sleep(refresh)
+		if !wait(nextLoad()) {
+			return
+		}
+	}
+}
+
+// WatchFilesEvents is like Watch, but additionally reloads on file system events of the given files.
+// If no files are given or the file watch cannot be set up, only the polling is used.
+func WatchFilesEvents[T any, PT interface {
+	GetChecksum() []byte
+	*T
+}](ctx context.Context, logger *slog.Logger, ch chan T, refresh time.Duration, files []string, debounce time.Duration, init PT, loadFn func() (PT, error), changedFn func(), opts ...Option) {
+	if len(files) == 0 {
+		Watch(ctx, logger, ch, refresh, init, loadFn, changedFn, opts...)
+		return
+	}
+	events, err := WatchFiles(logger, files, debounce)
+	if err != nil {
+		logger.Error("cannot watch cert files, falling back to polling", slog.String("error", err.Error()))
+		if refresh <= 0 {
+			refresh = DefaultFallbackRefresh
+		}
+		Watch(ctx, logger, ch, refresh, init, loadFn, changedFn, opts...)
+		return
 	}
+	defer func() { _ = events.Close() }()
+	WatchEvents(ctx, logger, ch, refresh, events.C, init, loadFn, changedFn, opts...)
 }
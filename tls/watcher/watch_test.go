@@ -0,0 +1,115 @@
+package watcher
+
+import (
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testValue struct {
+	checksum []byte
+}
+
+func (v *testValue) GetChecksum() []byte {
+	return v.checksum
+}
+
+func TestBackoffDelay(t *testing.T) {
+	backoff := Backoff{Initial: time.Second, Multiplier: 2}
+	require.Equal(t, time.Second, backoff.delay(1, time.Minute))
+	require.Equal(t, 2*time.Second, backoff.delay(2, time.Minute))
+	require.Equal(t, 8*time.Second, backoff.delay(4, time.Minute))
+	require.Equal(t, time.Minute, backoff.delay(100, time.Minute))
+
+	backoff.Max = 5 * time.Second
+	require.Equal(t, 5*time.Second, backoff.delay(4, time.Minute))
+
+	require.Equal(t, time.Minute, Backoff{}.delay(3, time.Minute))
+
+	backoff = Backoff{Initial: 10 * time.Second, Jitter: 0.2}
+	for range 100 {
+		d := backoff.delay(1, time.Minute)
+		require.GreaterOrEqual(t, d, 8*time.Second)
+		require.LessOrEqual(t, d, 12*time.Second)
+	}
+}
+
+func TestWatchLoadErrors(t *testing.T) {
+	var loads atomic.Int32
+	loadFn := func() (*testValue, error) {
+		// the first three loads fail
+		if loads.Add(1) <= 3 {
+			return nil, errors.New("broken key file")
+		}
+		return &testValue{checksum: []byte("v1")}, nil
+	}
+	var reported atomic.Int32
+	status := &Status{}
+	ch := make(chan testValue, 1)
+	go Watch(t.Context(), slog.Default(), ch, time.Hour, nil, loadFn, nil,
+		WithBackoff(Backoff{Initial: 10 * time.Millisecond, Multiplier: 2}),
+		WithErrorFunc(func(err error) {
+			require.EqualError(t, err, "broken key file")
+			reported.Add(1)
+		}),
+		WithStatus(status),
+	)
+
+	// the failed loads are retried long before the refresh interval
+	select {
+	case v := <-ch:
+		require.Equal(t, []byte("v1"), v.checksum)
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected certificates")
+	}
+	require.Equal(t, int32(3), reported.Load())
+	require.Equal(t, 0, status.ConsecutiveFailures())
+	require.NoError(t, status.LastError())
+	require.WithinDuration(t, time.Now(), status.LastSuccess(), time.Second)
+}
+
+func TestWatchReloadAt(t *testing.T) {
+	var loads atomic.Int32
+	loadFn := func() (*testValue, error) {
+		n := loads.Add(1)
+		return &testValue{checksum: []byte{byte(n)}}, nil
+	}
+	ch := make(chan testValue, 1)
+	// no refresh interval, only the second load is scheduled
+	go Watch(t.Context(), slog.Default(), ch, 0, nil, loadFn, nil, WithReloadAt(func() time.Time {
+		if loads.Load() == 1 {
+			return time.Now().Add(100 * time.Millisecond)
+		}
+		return time.Time{}
+	}))
+
+	for _, want := range []byte{1, 2} {
+		select {
+		case v := <-ch:
+			require.Equal(t, []byte{want}, v.checksum)
+		case <-time.After(3 * time.Second):
+			t.Fatal("expected scheduled load")
+		}
+	}
+	time.Sleep(200 * time.Millisecond)
+	require.Equal(t, int32(2), loads.Load())
+}
+
+func TestStatus(t *testing.T) {
+	status := &Status{}
+	require.True(t, status.LastSuccess().IsZero())
+
+	status.RecordFailure(errors.New("first"))
+	status.RecordFailure(errors.New("second"))
+	require.Equal(t, 2, status.ConsecutiveFailures())
+	require.EqualError(t, status.LastError(), "second")
+
+	status.RecordSuccess()
+	require.Equal(t, 0, status.ConsecutiveFailures())
+	require.NoError(t, status.LastError())
+	require.False(t, status.LastSuccess().IsZero())
+}